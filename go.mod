@@ -5,7 +5,11 @@ go 1.15
 require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/Melenium2/Murlog v0.0.11
+	github.com/alicebob/miniredis/v2 v2.14.1
+	github.com/go-redis/redis/v7 v7.4.0
 	github.com/mailru/go-clickhouse v1.3.0
 	github.com/stretchr/testify v1.6.1
+	github.com/xitongsys/parquet-go v1.5.1
+	go.etcd.io/bbolt v1.3.5
 	gopkg.in/yaml.v2 v2.3.0
 )
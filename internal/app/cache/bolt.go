@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"log"
+	"time"
+)
+
+var boltBucket = []byte("cache")
+
+// boltItem is stored Item which value is decoded on demand
+type boltItem struct {
+	V       json.RawMessage `json:"V,omitempty"`
+	Expired int64           `json:"Expired,omitempty"`
+}
+
+// BoltStorage keeps cache in the embedded bolt database. Every change is
+// committed to the disk, so nothing is lost on crash
+type BoltStorage struct {
+	db *bbolt.DB
+}
+
+func (b *BoltStorage) Set(key string, value interface{}) {
+	b.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL store value which expires after ttl
+// @params
+//	key: string
+//	value: interface{}
+//	ttl: time.Duration (time to live, 0 or less means value never expires)
+func (b *BoltStorage) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	var expired int64
+	if ttl > 0 {
+		expired = time.Now().Add(ttl).UnixNano()
+	}
+	v, err := json.Marshal(Item{value, expired})
+	if err != nil {
+		log.Printf("can not marshal value with key %s: %s", key, err)
+		return
+	}
+
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), v)
+	})
+	if err != nil {
+		log.Printf("can not set value with key %s to bolt: %s", key, err)
+	}
+}
+
+func (b *BoltStorage) GetV(key string) (interface{}, error) {
+	var v interface{}
+	if err := b.Get(key, &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Get decodes json value with key to out
+// @params
+//	key: string
+//	out: interface{} (pointer to value)
+// @return
+//	error
+func (b *BoltStorage) Get(key string, out interface{}) error {
+	var item *boltItem
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		item = &boltItem{}
+
+		return json.Unmarshal(v, item)
+	})
+	if err != nil {
+		return err
+	}
+	if item != nil && (Item{Expired: item.Expired}).IsExpired(time.Now()) {
+		b.delete(key)
+		item = nil
+	}
+	if item == nil {
+		return fmt.Errorf("value with key %s not found", key)
+	}
+	if len(item.V) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(item.V, out)
+}
+
+// Keys return sorted keys which start with prefix
+// @params
+//	prefix: string (empty prefix matches all keys)
+// @return
+//	[]string
+//	error
+func (b *BoltStorage) Keys(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	now := time.Now()
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			var item boltItem
+			if json.Unmarshal(v, &item) == nil && (Item{Expired: item.Expired}).IsExpired(now) {
+				continue
+			}
+			keys = append(keys, string(k))
+		}
+
+		return nil
+	})
+
+	return keys, err
+}
+
+// Delete removes values with keys
+func (b *BoltStorage) Delete(keys ...string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for _, v := range keys {
+			if err := bucket.Delete([]byte(v)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// CompareAndSwap set new value if the current value equals old or value does
+// not exist if old is nil. Swap is done in one write transaction
+// @params
+//	key: string
+//	old: interface{} (expected current value, nil if value must not exist)
+//	new: interface{}
+// @return
+//	bool (false if current value is not old)
+//	error
+func (b *BoltStorage) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	v, err := json.Marshal(Item{new, 0})
+	if err != nil {
+		return false, err
+	}
+
+	swapped := false
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		var item boltItem
+		current := bucket.Get([]byte(key))
+		exists := current != nil && json.Unmarshal(current, &item) == nil &&
+			!(Item{Expired: item.Expired}).IsExpired(time.Now())
+		if exists != (old != nil) {
+			return nil
+		}
+		if exists {
+			var value interface{}
+			if len(item.V) > 0 {
+				value = item.V
+			}
+			same, err := sameValue(value, old)
+			if err != nil || !same {
+				return err
+			}
+		}
+		swapped = true
+
+		return bucket.Put([]byte(key), v)
+	})
+
+	return swapped && err == nil, err
+}
+
+// Append adds values to the end of the list stored with key, list is created
+// if it does not exist. Values are appended in one write transaction
+// @params
+//	key: string
+//	values: ...interface{} (items of list)
+// @return
+//	error (stored value is not a list)
+func (b *BoltStorage) Append(key string, values ...interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		var item boltItem
+		current := bucket.Get([]byte(key))
+		if current == nil || json.Unmarshal(current, &item) != nil ||
+			(Item{Expired: item.Expired}).IsExpired(time.Now()) {
+			item = boltItem{}
+		}
+		list, err := appendJSON(item.V, values)
+		if err != nil {
+			return fmt.Errorf("can not append to value with key %s: %s", key, err)
+		}
+		item.V = list
+		v, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(key), v)
+	})
+}
+
+// Dump does nothing, every change is already committed to the disk
+func (b *BoltStorage) Dump() {}
+
+// Close bolt database
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
+
+// delete removes value with key
+func (b *BoltStorage) delete(key string) {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+	if err != nil {
+		log.Printf("can not delete value with key %s from bolt: %s", key, err)
+	}
+}
+
+// cleanup removes expired items
+func (b *BoltStorage) cleanup() error {
+	now := time.Now()
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		keys := make([][]byte, 0)
+		err := bucket.ForEach(func(k, v []byte) error {
+			var item Item
+			if json.Unmarshal(v, &item) != nil || item.IsExpired(now) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Create new instance of BoltStorage. Expired and broken items are removed
+// when database is opened
+// @params
+//	path: string (path to database file)
+// @return
+//	*BoltStorage
+//	error (database can not be opened)
+func NewBolt(path string) (*BoltStorage, error) {
+	db, err := bbolt.Open(path, 0644, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	b := &BoltStorage{db: db}
+	if err := b.cleanup(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
@@ -1,23 +1,40 @@
 package cache
 
 import (
+	"Nani/internal/app/config"
 	"Nani/internal/app/file"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
 	"path"
+	"reflect"
 	"sync"
 	"syscall"
+	"time"
 )
 
 var debug bool = false
 
+// How often expired items are removed from the cache
+var CleanupInterval = time.Minute
+
 type Storage interface {
 	Set(key string, value interface{})
+	SetWithTTL(key string, value interface{}, ttl time.Duration)
 	GetV(key string) (interface{}, error)
+	Get(key string, out interface{}) error
+	Keys(prefix string) ([]string, error)
+	Delete(keys ...string) error
+	// CompareAndSwap atomically set new value if the current value equals old,
+	// nil old means value must not exist. Values are compared by json encoding
+	CompareAndSwap(key string, old, new interface{}) (bool, error)
+	// Append adds values to the end of the list stored with key, list is
+	// created if it does not exist
+	Append(key string, values ...interface{}) error
 	Dump()
 }
 
@@ -25,18 +42,59 @@ type Cache struct {
 	Clear     bool
 	Debug     bool
 	cachename string
-	store     map[string]Item
-	mutex     sync.Mutex
+	store     shards
+	// Guards lifecycle of background goroutines
+	mutex sync.Mutex
+	stop  chan struct{}
+	// Number of snapshots kept on disk, including the current one
+	keep int
+	// Serializes writes of snapshots
+	saving sync.Mutex
+	// Log of changes made after the last snapshot in journal mode
+	journal *journal
+	// Cache opened by other process is only read, snapshot is never written
+	readonly bool
 }
 
 func (c *Cache) Set(key string, value interface{}) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	c.store[key] = Item{value, 0}
+	c.set(key, Item{value, 0})
+}
+
+// SetWithTTL store value which expires after ttl
+// @params
+//	key: string
+//	value: interface{}
+//	ttl: time.Duration (time to live, 0 or less means value never expires)
+func (c *Cache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	var expired int64
+	if ttl > 0 {
+		expired = time.Now().Add(ttl).UnixNano()
+	}
+	c.set(key, Item{value, expired})
+}
+
+// set stores item and appends it to the journal under the lock of shard,
+// so the journal has the same order of changes as the store
+func (c *Cache) set(key string, item Item) {
+	s := c.store.get(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.items[key] = item
+	c.log(record{Op: opSet, Key: key, Item: item})
+}
+
+// log appends change to the journal in journal mode
+func (c *Cache) log(r record) {
+	if c.journal == nil {
+		return
+	}
+	if err := c.journal.append(r); err != nil {
+		log.Printf("can not append %s to cache journal: %s", r.Key, err)
+	}
 }
 
 func (c *Cache) GetV(key string) (interface{}, error) {
-	v, ok := c.store[key]
+	v, ok := c.item(key)
 	if !ok {
 		return nil, errors.New(fmt.Sprintf("value with key %s not found", key))
 	}
@@ -44,21 +102,395 @@ func (c *Cache) GetV(key string) (interface{}, error) {
 	return v.V, nil
 }
 
-func (c *Cache) Dump() {
-	if len(c.store) > 0 {
-		f := file.New(c.cachename)
-		str, err := json.Marshal(c.store)
+// Get stores copy of value with key to out, so value got by one caller is
+// never changed by other. Value of other type, like value loaded from the
+// snapshot, is converted once and kept with the type of out
+// @params
+//	key: string
+//	out: interface{} (not nil pointer to value)
+// @return
+//	error
+func (c *Cache) Get(key string, out interface{}) error {
+	dst := reflect.ValueOf(out)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return fmt.Errorf("can not get value with key %s to %T", key, out)
+	}
+
+	v, ok := c.item(key)
+	if !ok {
+		return errors.New(fmt.Sprintf("value with key %s not found", key))
+	}
+	b, err := json.Marshal(v.V)
+	if err != nil {
+		return err
+	}
+	dst.Elem().Set(reflect.Zero(dst.Elem().Type()))
+	if err := json.Unmarshal(b, out); err != nil {
+		return err
+	}
+	value := reflect.ValueOf(v.V)
+	if value.IsValid() && value.Type().AssignableTo(dst.Elem().Type()) {
+		return nil
+	}
+
+	// Conversion is done under write lock, so the newer value set by
+	// other goroutine is never replaced with the converted older one
+	s := c.store.get(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	v, ok = s.items[key]
+	if !ok || v.IsExpired(time.Now()) {
+		return nil
+	}
+	b, err = json.Marshal(v.V)
+	if err != nil {
+		return nil
+	}
+	kept := reflect.New(dst.Elem().Type())
+	if err := json.Unmarshal(b, kept.Interface()); err == nil {
+		v.V = kept.Elem().Interface()
+		s.items[key] = v
+	}
+
+	return nil
+}
+
+// Keys return sorted keys which start with prefix
+// @params
+//	prefix: string (empty prefix matches all keys)
+// @return
+//	[]string
+//	error
+func (c *Cache) Keys(prefix string) ([]string, error) {
+	return c.store.keys(prefix, time.Now()), nil
+}
+
+// CompareAndSwap set new value if the current value equals old or value does
+// not exist if old is nil. Swap is done under the lock of shard, so it is
+// atomic for all goroutines of the process
+// @params
+//	key: string
+//	old: interface{} (expected current value, nil if value must not exist)
+//	new: interface{}
+// @return
+//	bool (false if current value is not old)
+//	error
+func (c *Cache) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	s := c.store.get(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, ok := s.items[key]
+	if ok && v.IsExpired(time.Now()) {
+		ok = false
+	}
+	if ok != (old != nil) {
+		return false, nil
+	}
+	if ok {
+		same, err := sameValue(v.V, old)
+		if err != nil || !same {
+			return false, err
+		}
+	}
+	item := Item{new, 0}
+	s.items[key] = item
+	c.log(record{Op: opSet, Key: key, Item: item})
+
+	return true, nil
+}
+
+// Append adds values to the end of the list stored with key, list is created
+// if it does not exist. Only appended values are written to the journal, so
+// the journal does not grow with the whole list on every append
+// @params
+//	key: string
+//	values: ...interface{} (items of list)
+// @return
+//	error (stored value is not a list)
+func (c *Cache) Append(key string, values ...interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	s := c.store.get(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
+	if !ok || item.IsExpired(time.Now()) {
+		item = Item{}
+	}
+	list, err := appendList(item.V, values)
+	if err != nil {
+		return fmt.Errorf("can not append to value with key %s: %s", key, err)
+	}
+	item.V = list
+	s.items[key] = item
+	c.log(record{Op: opAppend, Key: key, Item: Item{V: values}})
+
+	return nil
+}
+
+// appendList return copy of list with values added to the end. List keeps
+// its type if values have type of its items, otherwise it is converted
+// to []interface{}. Nil list is created with type of values
+func appendList(list interface{}, values []interface{}) (interface{}, error) {
+	if list == nil {
+		list = reflect.MakeSlice(reflect.SliceOf(itemType(values)), 0, len(values)).Interface()
+	}
+	l := reflect.ValueOf(list)
+	if l.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%T is not a list", list)
+	}
+	if itemType(values).AssignableTo(l.Type().Elem()) {
+		out := reflect.MakeSlice(l.Type(), 0, l.Len()+len(values))
+		out = reflect.AppendSlice(out, l)
+		for _, v := range values {
+			out = reflect.Append(out, reflect.ValueOf(v))
+		}
+		return out.Interface(), nil
+	}
+
+	out := make([]interface{}, 0, l.Len()+len(values))
+	for i := 0; i < l.Len(); i++ {
+		out = append(out, l.Index(i).Interface())
+	}
+
+	return append(out, values...), nil
+}
+
+// appendJSON return json list with values added to the end of json list
+func appendJSON(list []byte, values []interface{}) ([]byte, error) {
+	var items []json.RawMessage
+	if len(list) > 0 {
+		if err := json.Unmarshal(list, &items); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, b)
+	}
+
+	return json.Marshal(items)
+}
+
+// itemType return type of values if all of them have the same type,
+// otherwise type of interface{}
+func itemType(values []interface{}) reflect.Type {
+	any := reflect.TypeOf((*interface{})(nil)).Elem()
+	if len(values) == 0 || values[0] == nil {
+		return any
+	}
+	t := reflect.TypeOf(values[0])
+	for _, v := range values[1:] {
+		if reflect.TypeOf(v) != t {
+			return any
+		}
+	}
+
+	return t
+}
+
+// sameValue check if values have the same json encoding, so value loaded
+// from json equals value of go type
+func sameValue(a, b interface{}) (bool, error) {
+	var x, y interface{}
+	for _, v := range []struct {
+		value interface{}
+		out   *interface{}
+	}{{a, &x}, {b, &y}} {
+		b, err := json.Marshal(v.value)
 		if err != nil {
-			panic(err)
+			return false, err
+		}
+		if err := json.Unmarshal(b, v.out); err != nil {
+			return false, err
 		}
-		f.WriteLines(string(str))
+	}
+
+	return reflect.DeepEqual(x, y), nil
+}
+
+// Delete removes values with keys
+func (c *Cache) Delete(keys ...string) error {
+	for _, key := range keys {
+		s := c.store.get(key)
+		s.mutex.Lock()
+		delete(s.items, key)
+		c.log(record{Op: opDel, Key: key})
+		s.mutex.Unlock()
+	}
 
+	return nil
+}
+
+// item return not expired item with key, expired item is removed
+func (c *Cache) item(key string) (Item, bool) {
+	s := c.store.get(key)
+	s.mutex.RLock()
+	v, ok := s.items[key]
+	s.mutex.RUnlock()
+	if ok && v.IsExpired(time.Now()) {
+		s.mutex.Lock()
+		if v, ok := s.items[key]; ok && v.IsExpired(time.Now()) {
+			delete(s.items, key)
+		}
+		s.mutex.Unlock()
+		ok = false
+	}
+
+	return v, ok
+}
+
+// Close stops background cleanup of expired items and autosave
+// and closes the journal
+func (c *Cache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	if c.journal != nil {
+		if err := c.journal.close(); err != nil {
+			return fmt.Errorf("can not close cache journal: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// cleanup removes expired items
+func (c *Cache) cleanup() {
+	c.store.cleanup(time.Now())
+}
+
+// autosave dumps cache every interval until cache is closed
+func (c *Cache) autosave(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Dump()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// janitor removes expired items every CleanupInterval until cache is closed
+func (c *Cache) janitor(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.cleanup()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *Cache) Dump() {
+	saved, err := c.Save()
+	if err != nil {
+		log.Printf("can not create cache dump: %s", err)
+		return
+	}
+	if saved {
 		log.Print("cache crated")
 	} else {
 		log.Print("skip creating")
+	}
+}
+
+// Save writes snapshot of cache atomically. Previous snapshots are
+// rotated to files with .1, .2 ... suffixes, only the last keep are kept.
+// In journal mode saving compacts the journal, changes stored in the
+// snapshot are removed from it only after the snapshot is written
+// @return
+//	bool (false if cache is empty and nothing was written)
+//	error
+func (c *Cache) Save() (bool, error) {
+	if c.readonly {
+		return false, errors.New("cache is opened read-only")
+	}
+	c.saving.Lock()
+	defer c.saving.Unlock()
+
+	c.cleanup()
+	// All shards are locked until snapshot is written and journal is
+	// rotated, so every change is either in the snapshot or in the new journal
+	c.store.rlock()
+	if c.store.len() == 0 && c.journal == nil {
+		c.store.runlock()
+		return false, nil
+	}
+	b, err := json.Marshal(c.store.items())
+	if err == nil {
+		c.rotate()
+		err = file.WriteAtomic(c.cachename, b)
+	}
+	if err == nil && c.journal != nil {
+		err = c.journal.rotate()
+	}
+	c.store.runlock()
+	if err != nil {
+		return false, err
+	}
+	if c.journal != nil {
+		c.journal.compacted()
+	}
+
+	return true, nil
+}
 
+// snapshots return names of snapshot files from the newest to the oldest
+func (c *Cache) snapshots() []string {
+	names := []string{c.cachename}
+	for i := 1; i < c.keep; i++ {
+		names = append(names, fmt.Sprintf("%s.%d", c.cachename, i))
+	}
+
+	return names
+}
+
+// rotate shifts snapshots to the older names, the oldest one is overwritten.
+// Current snapshot is linked to the newest backup and stays in place until
+// the new snapshot is renamed over it, so it exists if writing fails
+func (c *Cache) rotate() {
+	names := c.snapshots()
+	if len(names) < 2 {
+		return
+	}
+	for i := len(names) - 1; i > 1; i-- {
+		if err := os.Rename(names[i-1], names[i]); err != nil && !os.IsNotExist(err) {
+			log.Printf("can not rotate cache snapshot %s: %s", names[i-1], err)
+		}
+	}
+	if err := os.Remove(names[1]); err != nil && !os.IsNotExist(err) {
+		log.Printf("can not rotate cache snapshot %s: %s", names[1], err)
+		return
+	}
+	err := os.Link(names[0], names[1])
+	if err == nil || os.IsNotExist(err) {
 		return
 	}
+	// File system may not support hard links
+	b, err := ioutil.ReadFile(names[0])
+	if err == nil {
+		err = file.WriteAtomic(names[1], b)
+	}
+	if err != nil {
+		log.Printf("can not rotate cache snapshot %s: %s", names[0], err)
+	}
 }
 
 func (c *Cache) dump() {
@@ -79,24 +511,81 @@ func (c *Cache) dump() {
 	}()
 }
 
+// load restores cache from the newest snapshot which can be read and
+// replays the journal in journal mode
 func (c *Cache) load() {
 	if c.Clear {
-		err := os.Remove(c.cachename)
-		if err != nil {
-			log.Printf("Can not remove file %s. File not found", c.cachename)
+		for _, v := range c.snapshots() {
+			err := os.Remove(v)
+			if err != nil && v == c.cachename {
+				log.Printf("Can not remove file %s. File not found", c.cachename)
+			}
 		}
-	} else {
-		f := file.New(c.cachename)
-		b, err := f.ReadAll()
+		if c.journal != nil {
+			c.journal.remove()
+		}
+		return
+	}
+
+	store := c.loadSnapshot()
+	if c.journal != nil {
+		if n := c.journal.replay(store); n > 0 {
+			log.Printf("replayed %d records of cache journal", n)
+		}
+	}
+	c.store.fill(store)
+}
+
+// loadSnapshot restores cache from the newest snapshot which can be read.
+// Corrupted snapshots are skipped, so cache falls back to the older one
+func (c *Cache) loadSnapshot() map[string]Item {
+	for _, v := range c.snapshots() {
+		b, err := file.New(v).ReadAll()
 		if err != nil || len(b) == 0 {
-			log.Print("File not exist")
-			return
+			continue
+		}
+
+		store := make(map[string]Item)
+		if err := json.Unmarshal(b, &store); err != nil {
+			log.Printf("cache snapshot %s is corrupted: %s", v, err)
+			continue
+		}
+		if v != c.cachename {
+			log.Printf("cache restored from snapshot %s", v)
 		}
+		return store
+	}
+
+	log.Print("File not exist")
 
-		err = json.Unmarshal(b, &c.store)
+	return make(map[string]Item)
+}
+
+// OpenStorage create the storage of configured backend.
+// Supported backends are file (default), redis and bolt
+// @params
+//	conf: config.CacheConfig
+// @return
+//	Storage
+//	error (unknown backend or backend is not available)
+func OpenStorage(conf config.CacheConfig) (Storage, error) {
+	switch conf.Backend {
+	case "", "file":
+		return Open(conf, false), nil
+	case "redis":
+		r, err := NewRedis(conf.Redis)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "bolt":
+		b, err := NewBolt(conf.Path)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %s", conf.Backend)
 	}
 }
 
@@ -106,12 +595,80 @@ func New(new bool, cachefile ...string) *Cache {
 		filename = cachefile[0]
 	}
 
+	return Open(config.CacheConfig{Path: filename}, new)
+}
+
+// Open cache stored in configured file
+// @params
+//	conf: config.CacheConfig (path of snapshot, autosave interval, number of kept snapshots and journal mode)
+//	clear: bool (remove stored snapshots and start with empty cache)
+// @return
+//	*Cache
+func Open(conf config.CacheConfig, clear bool) *Cache {
+	if conf.Path == "" {
+		conf.Path = "./cache.json"
+	}
+	if conf.Keep < 1 {
+		conf.Keep = 1
+	}
+
 	c := &Cache{
-		cachename: filename,
-		store:     make(map[string]Item),
-		Clear:     new,
+		cachename: conf.Path,
+		store:     newShards(shardCount),
+		Clear:     clear,
+		stop:      make(chan struct{}),
+		keep:      conf.Keep,
+	}
+	if conf.Journal {
+		c.journal = newJournal(conf.Path)
 	}
 	c.load()
+	c.cleanup()
+	if c.journal != nil {
+		// Replayed journal is compacted at once, so new records are
+		// never appended after the broken one
+		if _, err := c.Save(); err != nil {
+			log.Printf("can not compact cache journal: %s", err)
+		}
+		if err := c.journal.start(); err != nil {
+			log.Printf("can not open cache journal: %s", err)
+		}
+	}
 	c.dump()
+	go c.janitor(c.stop, CleanupInterval)
+	if conf.Autosave > 0 {
+		go c.autosave(c.stop, conf.Autosave)
+	}
+	return c
+}
+
+// OpenReadOnly read cache which may be used by the running process.
+// State is restored from the snapshot and the journal files, but they are
+// never compacted, rotated or written, changes stay in memory only
+// @params
+//	conf: config.CacheConfig (path of snapshot, number of kept snapshots and journal mode)
+// @return
+//	*Cache
+func OpenReadOnly(conf config.CacheConfig) *Cache {
+	if conf.Path == "" {
+		conf.Path = "./cache.json"
+	}
+	if conf.Keep < 1 {
+		conf.Keep = 1
+	}
+
+	c := &Cache{
+		cachename: conf.Path,
+		store:     newShards(shardCount),
+		keep:      conf.Keep,
+		readonly:  true,
+	}
+	store := c.loadSnapshot()
+	if conf.Journal {
+		newJournal(conf.Path).replay(store)
+	}
+	c.store.fill(store)
+	c.cleanup()
+
 	return c
 }
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJanitor_ShouldRemoveExpiredItemsInBackground_NoError(t *testing.T) {
+	c := &Cache{store: newShards(shardCount), stop: make(chan struct{})}
+	go c.janitor(c.stop, time.Millisecond*10)
+	defer c.Close()
+
+	c.SetWithTTL("expired", "value", time.Millisecond)
+	c.Set("key", "value")
+	time.Sleep(time.Millisecond * 50)
+
+	c.store.rlock()
+	defer c.store.runlock()
+	items := c.store.items()
+	assert.NotContains(t, items, "expired")
+	assert.Contains(t, items, "key")
+}
+
+func TestShards_ShouldSpreadKeysOverShards_NoError(t *testing.T) {
+	s := newShards(shardCount)
+	used := make(map[*shard]struct{})
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		assert.Same(t, s.get(key), s.get(key))
+		used[s.get(key)] = struct{}{}
+	}
+
+	assert.Len(t, used, shardCount)
+}
+
+func TestSave_ShouldTakeConsistentSnapshotWhileWriting_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := &Cache{
+		cachename: filepath.Join(dir, "cache.json"),
+		store:     newShards(shardCount),
+		keep:      1,
+		journal:   newJournal(filepath.Join(dir, "cache.json")),
+	}
+	assert.NoError(t, c.journal.start())
+	defer c.journal.close()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c.Set(fmt.Sprintf("key%d", i), j)
+				c.GetV(fmt.Sprintf("key%d", (i+1)%8))
+			}
+		}(i)
+	}
+	for i := 0; i < 5; i++ {
+		_, err := c.Save()
+		assert.NoError(t, err)
+	}
+	close(stop)
+	wg.Wait()
+
+	// Snapshot and journal together restore the last written values
+	b, err := ioutil.ReadFile(c.cachename)
+	assert.NoError(t, err)
+	restored := make(map[string]Item)
+	assert.NoError(t, json.Unmarshal(b, &restored))
+	c.journal.replay(restored)
+
+	c.store.rlock()
+	defer c.store.runlock()
+	items := c.store.items()
+	assert.Len(t, restored, len(items))
+	for k, v := range items {
+		assert.EqualValues(t, v.V, restored[k].V, k)
+	}
+}
+
+func TestJournalRotate_ShouldAppendToCompactingJournalLeftBySave_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	j := newJournal(filepath.Join(dir, "cache.json"))
+	compacting := `{"op":"set","key":"left","item":{"V":"value"}}` + "\n" + `{"op":"set","key":"broken","it`
+	assert.NoError(t, ioutil.WriteFile(j.compacting(), []byte(compacting), 0644))
+
+	assert.NoError(t, j.start())
+	assert.NoError(t, j.append(record{Op: opSet, Key: "key", Item: Item{V: "value"}}))
+	assert.NoError(t, j.rotate())
+	assert.NoError(t, j.append(record{Op: opDel, Key: "left"}))
+	assert.NoError(t, j.close())
+
+	store := make(map[string]Item)
+	assert.Equal(t, 3, j.replay(store))
+	assert.Equal(t, map[string]Item{"key": {V: "value"}}, store)
+
+	store = make(map[string]Item)
+	os.Remove(j.name)
+	assert.Equal(t, 2, j.replay(store))
+	assert.Equal(t, map[string]Item{"left": {V: "value"}, "key": {V: "value"}}, store)
+}
+
+func TestRotate_ShouldKeepCurrentSnapshotUntilItIsReplaced_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := &Cache{cachename: filepath.Join(dir, "cache.json"), keep: 3}
+	assert.NoError(t, ioutil.WriteFile(c.cachename, []byte("current"), 0644))
+	assert.NoError(t, ioutil.WriteFile(c.cachename+".1", []byte("previous"), 0644))
+
+	c.rotate()
+	for name, content := range map[string]string{
+		c.cachename:        "current",
+		c.cachename + ".1": "current",
+		c.cachename + ".2": "previous",
+	} {
+		b, err := ioutil.ReadFile(name)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(b), name)
+	}
+}
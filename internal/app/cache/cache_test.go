@@ -2,11 +2,16 @@ package cache_test
 
 import (
 	"Nani/internal/app/cache"
+	"Nani/internal/app/config"
 	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestSetV_ShouldStoreToCacheNewValue_NoErrors(t *testing.T) {
@@ -51,13 +56,18 @@ func TestLoad_ShouldStoreAllJsonToCache_NoError(t *testing.T) {
 	assert.Equal(t, "value", v.(string))
 }
 
-func TestLoad_ShouldThrowPanicCozInalidJosn_Error(t *testing.T) {
-	assert.Panics(t, func() {
-		j, _ := json.Marshal(`{"123" "1321323}`)
-		ioutil.WriteFile("./cache.json", j, 0644)
-		cache.New(false)
+func TestLoad_ShouldStartEmptyCozInalidJosn_Error(t *testing.T) {
+	j, _ := json.Marshal(`{"123" "1321323}`)
+	ioutil.WriteFile("./cache.json", j, 0644)
+	defer os.Remove("./cache.json")
+
+	var c *cache.Cache
+	assert.NotPanics(t, func() {
+		c = cache.New(false)
 	})
-	os.Remove("./cache.json")
+	defer c.Close()
+	_, err := c.GetV("123")
+	assert.Error(t, err)
 }
 
 func TestLoad_ShouldReturnCorrectErrorsObject_Error(t *testing.T) {
@@ -105,3 +115,439 @@ func TestDump_ShouldSaveValidDump_NoError(t *testing.T) {
 
 
 
+
+func TestSetWithTTL_ShouldReturnValueUntilTtlIsOver_NoError(t *testing.T) {
+	c := cache.New(true)
+	defer c.Close()
+	c.SetWithTTL("short", "value", time.Millisecond*50)
+	c.SetWithTTL("forever", "value", 0)
+
+	v, err := c.GetV("short")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+
+	time.Sleep(time.Millisecond * 60)
+	_, err = c.GetV("short")
+	assert.Error(t, err)
+	_, err = c.GetV("forever")
+	assert.NoError(t, err)
+}
+
+func TestDump_ShouldSkipExpiredItems_NoError(t *testing.T) {
+	c := cache.New(true)
+	defer c.Close()
+	c.Set("key", "value")
+	c.SetWithTTL("expired", "value", time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	c.Dump()
+	defer os.Remove("./cache.json")
+
+	f, err := ioutil.ReadFile("./cache.json")
+	assert.NoError(t, err)
+	var m map[string]cache.Item
+	assert.NoError(t, json.Unmarshal(f, &m))
+	assert.Contains(t, m, "key")
+	assert.NotContains(t, m, "expired")
+}
+
+func TestItemIsExpired_ShouldCheckTtl_NoError(t *testing.T) {
+	now := time.Now()
+
+	assert.False(t, cache.Item{V: 1}.IsExpired(now))
+	assert.False(t, cache.Item{V: 1, Expired: now.Add(time.Second).UnixNano()}.IsExpired(now))
+	assert.True(t, cache.Item{V: 1, Expired: now.UnixNano()}.IsExpired(now))
+}
+
+func TestSave_ShouldKeepLastSnapshots_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "cache.json")
+
+	c := cache.Open(config.CacheConfig{Path: name, Keep: 3}, false)
+	defer c.Close()
+	for _, v := range []string{"first", "second", "third", "fourth"} {
+		c.Set("key", v)
+		saved, err := c.Save()
+		assert.NoError(t, err)
+		assert.True(t, saved)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+	for name, v := range map[string]string{name: "fourth", name + ".1": "third", name + ".2": "second"} {
+		f, err := ioutil.ReadFile(name)
+		assert.NoError(t, err)
+		var m map[string]cache.Item
+		assert.NoError(t, json.Unmarshal(f, &m))
+		assert.Equal(t, v, m["key"].V)
+	}
+}
+
+func TestSave_ShouldSkipEmptyCache_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := cache.Open(config.CacheConfig{Path: filepath.Join(dir, "cache.json")}, false)
+	defer c.Close()
+	saved, err := c.Save()
+	assert.NoError(t, err)
+	assert.False(t, saved)
+}
+
+func TestLoad_ShouldFallbackToPreviousSnapshot_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Keep: 2}
+
+	c := cache.Open(conf, false)
+	c.Set("key", "value")
+	_, err = c.Save()
+	assert.NoError(t, err)
+	_, err = c.Save()
+	assert.NoError(t, err)
+	c.Close()
+	assert.NoError(t, ioutil.WriteFile(conf.Path, []byte(`{"key": {"V": "val`), 0644))
+
+	c = cache.Open(conf, false)
+	defer c.Close()
+	v, err := c.GetV("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+}
+
+func TestOpen_ShouldRemoveAllSnapshotsOnClear_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Keep: 2}
+	assert.NoError(t, ioutil.WriteFile(conf.Path, []byte(`{"key": {"V": "value"}}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(conf.Path+".1", []byte(`{"key": {"V": "value"}}`), 0644))
+
+	c := cache.Open(conf, true)
+	defer c.Close()
+	_, err = c.GetV("key")
+	assert.Error(t, err)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 0)
+}
+
+func TestOpen_ShouldAutosaveCache_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Autosave: time.Millisecond * 10}
+
+	c := cache.Open(conf, false)
+	c.Set("key", "value")
+	time.Sleep(time.Millisecond * 50)
+	c.Close()
+
+	f, err := ioutil.ReadFile(conf.Path)
+	assert.NoError(t, err)
+	var m map[string]cache.Item
+	assert.NoError(t, json.Unmarshal(f, &m))
+	assert.Equal(t, "value", m["key"].V)
+}
+
+func TestOpen_ShouldReplayJournalAfterCrash_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Journal: true}
+
+	c := cache.Open(conf, false)
+	c.Set("saved", "value")
+	_, err = c.Save()
+	assert.NoError(t, err)
+	c.Set("key", "value")
+	c.Set("key", "changed")
+	c.SetWithTTL("ttl", "value", time.Hour)
+	c.Close()
+
+	c = cache.Open(conf, false)
+	defer c.Close()
+	for k, v := range map[string]string{"saved": "value", "key": "changed", "ttl": "value"} {
+		res, err := c.GetV(k)
+		assert.NoError(t, err)
+		assert.Equal(t, v, res)
+	}
+}
+
+func TestOpenReadOnly_ShouldReadJournalWithoutCompacting_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Journal: true}
+
+	c := cache.Open(conf, false)
+	defer c.Close()
+	c.Set("key", "value")
+	journal, err := ioutil.ReadFile(conf.Path + ".wal")
+	assert.NoError(t, err)
+
+	r := cache.OpenReadOnly(conf)
+	defer r.Close()
+	res, err := r.GetV("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", res)
+	_, err = r.Save()
+	assert.Error(t, err)
+
+	current, err := ioutil.ReadFile(conf.Path + ".wal")
+	assert.NoError(t, err)
+	assert.Equal(t, journal, current)
+	_, err = os.Stat(conf.Path + ".wal.1")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOpen_ShouldSkipBrokenJournalRecord_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Journal: true}
+	journal := `{"op":"set","key":"key","item":{"V":"value"}}` + "\n" + `{"op":"set","key":"broken","it`
+	assert.NoError(t, ioutil.WriteFile(conf.Path+".wal", []byte(journal), 0644))
+
+	c := cache.Open(conf, false)
+	c.Set("next", "value")
+	c.Close()
+
+	c = cache.Open(conf, false)
+	defer c.Close()
+	_, err = c.GetV("broken")
+	assert.Error(t, err)
+	for _, k := range []string{"key", "next"} {
+		res, err := c.GetV(k)
+		assert.NoError(t, err)
+		assert.Equal(t, "value", res)
+	}
+}
+
+func TestAppend_ShouldWriteOnlyAppendedValuesToJournal_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Journal: true}
+
+	c := cache.Open(conf, false)
+	sizes := make([]int64, 0)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Append("list", cache.Lease{Key: "value"}))
+		info, err := os.Stat(conf.Path + ".wal")
+		assert.NoError(t, err)
+		sizes = append(sizes, info.Size())
+	}
+	assert.Equal(t, sizes[1]-sizes[0], sizes[2]-sizes[1])
+	c.Close()
+
+	c = cache.Open(conf, false)
+	defer c.Close()
+	var leases []cache.Lease
+	assert.NoError(t, c.Get("list", &leases))
+	assert.Len(t, leases, 3)
+}
+
+func TestSave_ShouldCompactJournal_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Journal: true}
+
+	c := cache.Open(conf, false)
+	defer c.Close()
+	c.Set("key", "value")
+	info, err := os.Stat(conf.Path + ".wal")
+	assert.NoError(t, err)
+	assert.Greater(t, info.Size(), int64(0))
+
+	_, err = c.Save()
+	assert.NoError(t, err)
+	info, err = os.Stat(conf.Path + ".wal")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+	_, err = os.Stat(conf.Path + ".wal.1")
+	assert.True(t, os.IsNotExist(err))
+
+	f, err := ioutil.ReadFile(conf.Path)
+	assert.NoError(t, err)
+	var m map[string]cache.Item
+	assert.NoError(t, json.Unmarshal(f, &m))
+	assert.Equal(t, "value", m["key"].V)
+}
+
+func TestSave_ShouldKeepJournalIfSnapshotIsNotWritten_Error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Journal: true}
+
+	c := cache.Open(conf, false)
+	defer c.Close()
+	c.Set("key", "value")
+	// Snapshot can not replace not empty directory
+	assert.NoError(t, os.Remove(conf.Path))
+	assert.NoError(t, os.MkdirAll(filepath.Join(conf.Path, "dir"), 0755))
+	_, err = c.Save()
+	assert.Error(t, err)
+
+	_, err = os.Stat(conf.Path + ".wal.1")
+	assert.True(t, os.IsNotExist(err))
+	store := cache.OpenReadOnly(conf)
+	defer store.Close()
+	res, err := store.GetV("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", res)
+}
+
+func TestGet_ShouldKeepConvertedType_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json")}
+
+	c := cache.Open(conf, false)
+	c.Set("bundles", []string{"com.first", "com.second"})
+	c.Dump()
+	c.Close()
+
+	c = cache.Open(conf, false)
+	defer c.Close()
+	v, err := c.GetV("bundles")
+	assert.NoError(t, err)
+	assert.IsType(t, []interface{}{}, v)
+
+	var bundles []string
+	assert.NoError(t, c.Get("bundles", &bundles))
+	assert.Equal(t, []string{"com.first", "com.second"}, bundles)
+	v, err = c.GetV("bundles")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"com.first", "com.second"}, v)
+}
+
+func TestGet_ShouldReturnCopyOfStoredValue_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := cache.Open(config.CacheConfig{Path: filepath.Join(dir, "cache.json")}, false)
+	defer c.Close()
+	c.Set("leases", []cache.Lease{{Key: "first"}})
+
+	var leases []cache.Lease
+	assert.NoError(t, c.Get("leases", &leases))
+	leases[0].Key = "changed"
+
+	var stored []cache.Lease
+	assert.NoError(t, c.Get("leases", &stored))
+	assert.Equal(t, "first", stored[0].Key)
+}
+
+func TestGet_ShouldReturnErrorCozOutIsNotPointer_Error(t *testing.T) {
+	c := cache.New(true)
+	defer c.Close()
+	c.Set("key", "value")
+
+	var out string
+	assert.Error(t, c.Get("key", out))
+	assert.Error(t, c.Get("key", nil))
+	assert.Error(t, c.Get("key", &[]int{}))
+}
+
+func benchmarkCache(b *testing.B) *cache.Cache {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+	c := cache.Open(config.CacheConfig{Path: filepath.Join(dir, "cache.json")}, false)
+	b.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func BenchmarkCache_SetParallel(b *testing.B) {
+	c := benchmarkCache(b)
+	var n int64
+	b.RunParallel(func(pb *testing.PB) {
+		id := atomic.AddInt64(&n, 1)
+		i := 0
+		for pb.Next() {
+			c.Set(fmt.Sprintf("key%d_%d", id, i%1000), i)
+			i++
+		}
+	})
+}
+
+func BenchmarkCache_GetParallel(b *testing.B) {
+	c := benchmarkCache(b)
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.GetV(fmt.Sprintf("key%d", i%1000))
+			i++
+		}
+	})
+}
+
+func BenchmarkCache_SetParallelWhileSave(b *testing.B) {
+	c := benchmarkCache(b)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				c.Save()
+			}
+		}
+	}()
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		id := atomic.AddInt64(&n, 1)
+		i := 0
+		for pb.Next() {
+			c.Set(fmt.Sprintf("key%d_%d", id, i%1000), i)
+			i++
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
+
+func TestOpen_ShouldReplayDeletedKeysFromJournal_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Journal: true}
+
+	c := cache.Open(conf, false)
+	c.Set("saved", "value")
+	c.Set("key", "value")
+	_, err = c.Save()
+	assert.NoError(t, err)
+	assert.NoError(t, c.Delete("saved", "key"))
+	c.Set("key", "changed")
+	c.Close()
+
+	c = cache.Open(conf, false)
+	defer c.Close()
+	_, err = c.GetV("saved")
+	assert.Error(t, err)
+	v, err := c.GetV("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", v)
+}
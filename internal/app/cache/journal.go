@@ -0,0 +1,243 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operations of journal records
+const (
+	opSet    = "set"
+	opDel    = "del"
+	opAppend = "append"
+)
+
+// record is a single change of the cache appended to the journal
+type record struct {
+	Op   string `json:"op"`
+	Key  string `json:"key"`
+	Item Item   `json:"item,omitempty"`
+}
+
+// journal appends changes of the cache to the log file, so the state can be
+// restored from the last snapshot and changes made after it
+type journal struct {
+	name  string
+	file  *os.File
+	w     *bufio.Writer
+	mutex sync.Mutex
+}
+
+// append writes record to the journal. Record is flushed to the file
+// immediately, so it survives crash of the process. Records are skipped
+// while journal is not started or closed
+func (j *journal) append(r record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	if _, err := j.w.Write(b); err != nil {
+		return err
+	}
+
+	return j.w.Flush()
+}
+
+// rotate moves current journal to the compacting file and starts the new one.
+// Journal is rotated after snapshot with its changes is written and compacting
+// journal is removed right after it. If compacting journal is left because
+// process stopped before it was removed, current journal is appended to it,
+// so its changes are not lost
+func (j *journal) rotate() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if err := j.closeFile(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(j.compacting()); err == nil {
+		if err := j.merge(); err != nil {
+			return err
+		}
+	} else if err := os.Rename(j.name, j.compacting()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return j.open()
+}
+
+// merge appends current journal to the compacting one and removes it.
+// Partially written record at the end of compacting journal is dropped,
+// replay would stop on it and skip the appended records
+func (j *journal) merge() error {
+	b, err := ioutil.ReadFile(j.name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.compacting(), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if err := truncateBroken(f); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(j.name)
+}
+
+// truncateBroken cuts file after its last complete record and moves
+// offset to the end of file
+func truncateBroken(f *os.File) error {
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	size := int64(bytes.LastIndexByte(b, '\n') + 1)
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	_, err = f.Seek(size, io.SeekStart)
+
+	return err
+}
+
+// compacted removes journal which changes are stored in the snapshot
+func (j *journal) compacted() {
+	if err := os.Remove(j.compacting()); err != nil && !os.IsNotExist(err) {
+		log.Printf("can not remove compacted journal %s: %s", j.compacting(), err)
+	}
+}
+
+// compacting return name of journal which is being compacted
+func (j *journal) compacting() string {
+	return j.name + ".1"
+}
+
+// start opens journal for appending if it is not opened yet
+func (j *journal) start() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.file != nil {
+		return nil
+	}
+
+	return j.open()
+}
+
+func (j *journal) open() error {
+	f, err := os.OpenFile(j.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	j.file = f
+	j.w = bufio.NewWriter(f)
+
+	return nil
+}
+
+func (j *journal) close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.closeFile()
+}
+
+func (j *journal) closeFile() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.w.Flush()
+	if e := j.file.Close(); err == nil {
+		err = e
+	}
+	j.file = nil
+
+	return err
+}
+
+// remove deletes all journal files
+func (j *journal) remove() {
+	os.Remove(j.compacting())
+	os.Remove(j.name)
+}
+
+// replay applies records of the compacting and current journals to the store.
+// Replay of journal stops at the first broken record which is written
+// partially if process crashed during append
+// @return
+//	int (number of applied records)
+func (j *journal) replay(store map[string]Item) int {
+	count := 0
+	for _, name := range []string{j.compacting(), j.name} {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for sc.Scan() {
+			var r record
+			if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+				log.Printf("cache journal %s is broken after %d records: %s", name, count, err)
+				break
+			}
+			switch r.Op {
+			case opSet:
+				store[r.Key] = r.Item
+			case opDel:
+				delete(store, r.Key)
+			case opAppend:
+				item := store[r.Key]
+				if item.IsExpired(time.Now()) {
+					item = Item{}
+				}
+				values, _ := r.Item.V.([]interface{})
+				list, err := appendList(item.V, values)
+				if err != nil {
+					log.Printf("can not replay append to %s: %s", r.Key, err)
+					break
+				}
+				item.V = list
+				store[r.Key] = item
+			}
+			count++
+		}
+		if err := sc.Err(); err != nil {
+			log.Printf("can not read cache journal %s: %s", name, err)
+		}
+		f.Close()
+	}
+
+	return count
+}
+
+// Create new journal of cache snapshot
+func newJournal(cachename string) *journal {
+	return &journal{name: cachename + ".wal"}
+}
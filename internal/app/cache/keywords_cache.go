@@ -1,169 +1,613 @@
 package cache
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Prefix of all keys of keyword queue
+const KeywordsPrefix = "_keys"
+
+// Prefixes of leased and failed keywords
+const (
+	leasePrefix  = KeywordsPrefix + "_lease:"
+	failedPrefix = KeywordsPrefix + "_failed:"
+)
+
+// Default lease settings of keyword queue
+const (
+	DefaultVisibility  = time.Minute * 10
+	DefaultMaxAttempts = 3
+)
+
+// Index of keyword which normalized form is claimed, but keyword is not
+// queued yet, and how long duplicate waits for it
+const (
+	pending        = -1
+	pendingRetries = 100
+	pendingWait    = time.Millisecond * 10
+)
+
+// How many surface forms and sources are kept for keyword
+const (
+	maxForms   = 10
+	maxSources = 10
+)
+
+var (
+	ErrKeywordsEmpty      = errors.New("keywords cache is empty")
+	ErrKeywordsOutOfRange = errors.New("keywords are out of range")
+	ErrKeywordsLeased     = errors.New("keywords are leased by other workers")
 )
 
 // KeyStorage interface who manages the instance of KeywordCache
 type KeyStorage interface {
 	Set(key string) error
+	Add(k Keyword) error
 	Next() (string, error)
-	Rollback() error
-	Distinct() error
+	Lease(n int) ([]Lease, error)
+	Ack(l Lease) error
+	Nack(l Lease) error
+	Keywords() ([]Keyword, error)
+	Leases() ([]Lease, error)
+	Failed() ([]Lease, error)
+	Cursor() (int, error)
+	Seek(i int) error
 }
 
-// KeywordCache manages cache for storing key data
+// KeywordsCache is the queue of keywords stored in the cache. Every keyword
+// is a separate value of the cache, so enqueue and dequeue do not depend on
+// the length of queue. Keywords are unique, keyword which was queued once is
+// skipped. Queue may be shared by several processes through the storage
+//	_keys_tail       number of queued keywords
+//	_keys_next       index of the last returned keyword
+//	_keys:<i>        keyword with index i
+//	_keys_seen:<key> index of keyword by its normalized form, -1 while it is queued
+//	_keys_lease:<i>  lease of keyword with index i
+//	_keys_failed:<i> lease of keyword which failed MaxAttempts times
 type KeywordsCache struct {
-	cache   Storage
-	key     string
-	next    string
-	isEmpty bool
+	// How long leased keyword is hidden from other workers
+	Visibility time.Duration
+	// How many times keyword may fail before it is moved to the failed set
+	MaxAttempts int
+
+	cache Storage
+	tail  string
+	next  string
+	mutex sync.Mutex
 }
 
-// Set new key to the cache
+// Set new key to the end of queue, key which is already queued is skipped
 func (kc *KeywordsCache) Set(key string) error {
-	kc.isEmpty = false
-	keysIn, err := kc.cache.GetV(kc.key)
+	return kc.Add(Keyword{Key: key})
+}
 
-	keys := keywords(keysIn)
+// Add keyword to the end of queue. Keyword is deduplicated by Norm or by Key
+// if Norm is empty. Forms and provenance of duplicate are merged to the
+// queued keyword
+// @params
+//	k: Keyword (Pos is set by queue)
+// @return
+//	error
+func (kc *KeywordsCache) Add(k Keyword) error {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
 
+	return kc.push(k)
+}
+
+// push add keyword to the queue. Queue may be shared by several processes,
+// so normalized form and index of keyword are claimed by CompareAndSwap:
+// form is claimed first, so concurrent duplicate is merged, then the first
+// free item after the tail is claimed and the tail is moved over it. Item is
+// written before the tail, so the queue is never longer than stored items.
+// If item can not be written, claimed form is released, so duplicates do not
+// wait for keyword which is never queued
+func (kc *KeywordsCache) push(k Keyword) error {
+	norm := k.Norm
+	if norm == "" {
+		norm = k.Key
+	}
+	claimed, err := kc.cache.CompareAndSwap(kc.seen(norm), nil, pending)
 	if err != nil {
-		kc.cache.Set(kc.key, []Keyword{{Pos: len(keys) + 1, Key: key}})
-		return nil
+		return err
+	}
+	if !claimed {
+		i, err := kc.index(norm)
+		if err != nil {
+			return err
+		}
+		return kc.merge(i, k)
 	}
 
-	kc.cache.Set(kc.key, append(keys, Keyword{Pos: len(keys) + 1, Key: key}))
-	return nil
+	if len(k.Forms) > maxForms {
+		k.Forms = k.Forms[:maxForms]
+	}
+	if len(k.Sources) > maxSources {
+		k.Sources = k.Sources[:maxSources]
+	}
+	i := kc.length()
+	for {
+		k.Pos = i + 1
+		ok, err := kc.cache.CompareAndSwap(kc.item(i), nil, k)
+		if err != nil {
+			kc.cache.Delete(kc.seen(norm))
+			return err
+		}
+		if ok {
+			break
+		}
+		i++
+	}
+	kc.cache.Set(kc.seen(norm), i)
+
+	return kc.grow(i + 1)
 }
 
-func (kc *KeywordsCache) Distinct() error {
-	if kc.isEmpty {
-		return fmt.Errorf("keywords cahce is empty")
+// index return index of queued keyword by normalized form. Keyword which is
+// being pushed by other worker is waited for
+func (kc *KeywordsCache) index(norm string) (int, error) {
+	for n := 0; n < pendingRetries; n++ {
+		var i int
+		if err := kc.cache.Get(kc.seen(norm), &i); err != nil {
+			return 0, err
+		}
+		if i != pending {
+			return i, nil
+		}
+		time.Sleep(pendingWait)
 	}
 
-	keysIn, err := kc.cache.GetV(kc.key)
-	if err != nil {
-		return err
-	}
+	return 0, fmt.Errorf("keyword %s is still being queued", norm)
+}
 
-	keys := keywords(keysIn)
-	distinct := make(map[string]struct{})
+// grow move the tail forward to n. Tail is swapped only if it was not
+// changed concurrently and it is never moved back
+func (kc *KeywordsCache) grow(n int) error {
+	for {
+		var old interface{}
+		var tail int
+		if err := kc.cache.Get(kc.tail, &tail); err == nil {
+			old = tail
+		}
+		if tail >= n {
+			return nil
+		}
+		ok, err := kc.cache.CompareAndSwap(kc.tail, old, n)
+		if err != nil || ok {
+			return err
+		}
+	}
+}
 
-	for _, v := range keys {
-		distinct[v.Key] = struct{}{}
+// merge add forms and provenance of duplicate to the keyword with index i.
+// Weights are summed, the smallest depth and the first seen time are kept.
+// Keyword is swapped, so concurrent merges are not lost
+func (kc *KeywordsCache) merge(i int, k Keyword) error {
+	for {
+		var keyword Keyword
+		if err := kc.cache.Get(kc.item(i), &keyword); err != nil {
+			return err
+		}
+		merged := keyword
+		// Keyword is the old value of swap, so its slices are copied on append
+		merged.Forms = union(keyword.Forms[:len(keyword.Forms):len(keyword.Forms)], k.Forms, maxForms)
+		merged.Sources = union(keyword.Sources[:len(keyword.Sources):len(keyword.Sources)], k.Sources, maxSources)
+		merged.Weight += k.Weight
+		if merged.Locale == "" {
+			merged.Locale = k.Locale
+		}
+		if k.Depth > 0 && (merged.Depth == 0 || k.Depth < merged.Depth) {
+			merged.Depth = k.Depth
+		}
+		if !k.Seen.IsZero() && (merged.Seen.IsZero() || k.Seen.Before(merged.Seen)) {
+			merged.Seen = k.Seen
+		}
+		ok, err := kc.cache.CompareAndSwap(kc.item(i), keyword, merged)
+		if err != nil || ok {
+			return err
+		}
 	}
+}
 
-	result := make([]Keyword, len(distinct))
-	i := 0
-	for k, _ := range distinct {
-		result[i] = Keyword{Pos: i+1, Key: k}
-		i++
+// Next return keyword at the cursor and move cursor forward. Keyword is
+// not leased, so it is lost if caller fails, use Lease for workers
+func (kc *KeywordsCache) Next() (string, error) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	tail := kc.length()
+	if tail == 0 {
+		return "", ErrKeywordsEmpty
+	}
+	i, err := kc.take(tail)
+	if err != nil {
+		return "", err
+	}
+	if i < 0 {
+		return "", ErrKeywordsOutOfRange
 	}
 
-	kc.cache.Set(kc.key, result)
+	var keyword Keyword
+	if err := kc.cache.Get(kc.item(i), &keyword); err != nil {
+		return "", err
+	}
 
-	return nil
+	return keyword.Key, nil
 }
 
-// Get Next key from cache keywords slice
-func (kc *KeywordsCache) Next() (string, error) {
-	if kc.isEmpty {
-		return "", fmt.Errorf("keywords cache is empty")
+// Lease hands out up to n keywords to the worker. Returned and expired
+// leases are handed out first, then keywords at the cursor. Worker must
+// ack or nack every lease, otherwise keyword returns to the queue after
+// Visibility. Keyword which fails MaxAttempts times is moved to the failed set.
+// Leases are stored with their deadlines and claimed by CompareAndSwap, so
+// workers of several processes never get the same keyword
+// @params
+//	n: int (max number of keywords)
+// @return
+//	[]Lease
+//	error (ErrKeywordsLeased if queue is over but some keywords are still leased)
+func (kc *KeywordsCache) Lease(n int) ([]Lease, error) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	if n < 1 {
+		n = 1
+	}
+	tail := kc.length()
+	if tail == 0 {
+		return nil, ErrKeywordsEmpty
 	}
 
-	keyIn, err := kc.cache.GetV(kc.next)
+	now := time.Now()
+	current, err := kc.load(leasePrefix)
 	if err != nil {
-		kc.cache.Set(kc.next, 0)
-		k, err := kc.item(0)
+		return nil, err
+	}
+	leases := make([]Lease, 0, n)
+	for _, l := range current {
+		if len(leases) == n {
+			break
+		}
+		if l.Until.After(now) {
+			continue
+		}
+		next := l
+		next.Until = now.Add(kc.Visibility)
+		// Nacked lease is already counted, expired one fails now
+		if !l.Until.IsZero() {
+			next.Attempts++
+		}
+		ok, err := kc.cache.CompareAndSwap(kc.leaseKey(l.Pos-1), l, next)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return k.Key, nil
+		if !ok {
+			continue
+		}
+		if next.Attempts >= kc.MaxAttempts {
+			kc.fail(next)
+			continue
+		}
+		leases = append(leases, next)
 	}
-	key := key(keyIn) + 1
 
-	keyword, err := kc.item(key)
-	if err != nil {
-		kc.isEmpty = true
-		return "", errors.New("keywords are out of range")
+	for len(leases) < n {
+		i, err := kc.take(tail)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			break
+		}
+		var keyword Keyword
+		if err := kc.cache.Get(kc.item(i), &keyword); err != nil {
+			return nil, err
+		}
+		l := Lease{Pos: i + 1, Key: keyword.Key, Until: now.Add(kc.Visibility), Depth: keyword.Depth}
+		kc.cache.Set(kc.leaseKey(i), l)
+		leases = append(leases, l)
 	}
 
-	kc.cache.Set(kc.next, key)
+	if len(leases) == 0 {
+		keys, err := kc.cache.Keys(leasePrefix)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			return nil, ErrKeywordsLeased
+		}
+		return nil, ErrKeywordsOutOfRange
+	}
 
-	return keyword.Key, nil
+	return leases, nil
 }
 
-// Rollback key index to the -1
-func (kc *KeywordsCache) Rollback() error {
-	keyIn, err := kc.cache.GetV(kc.next)
-	if err != nil {
-		return nil
+// Ack removes lease of processed keyword
+func (kc *KeywordsCache) Ack(l Lease) error {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	if _, err := kc.owned(l); err != nil {
+		return err
 	}
-	key := key(keyIn)
 
-	if key == 0 {
-		return nil
+	return kc.cache.Delete(kc.leaseKey(l.Pos - 1))
+}
+
+// Nack returns keyword to the queue, so it is handed out by the next Lease.
+// Keyword which failed MaxAttempts times is moved to the failed set
+func (kc *KeywordsCache) Nack(l Lease) error {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	current, err := kc.owned(l)
+	if err != nil {
+		return err
+	}
+	next := current
+	next.Attempts++
+	next.Until = time.Time{}
+	ok, err := kc.cache.CompareAndSwap(kc.leaseKey(l.Pos-1), current, next)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("lease of keyword %s is expired", l.Key)
+	}
+	if next.Attempts >= kc.MaxAttempts {
+		kc.fail(next)
 	}
 
-	kc.cache.Set(kc.next, key-1)
 	return nil
 }
 
-// Get item with index i
-func (kc *KeywordsCache) item(i int) (Keyword, error) {
-	keyIn, err := kc.cache.GetV(kc.key)
-	if err != nil {
-		return Keyword{}, errors.New("keywords cache is empty")
+// Keywords return all keywords in order of queue
+func (kc *KeywordsCache) Keywords() ([]Keyword, error) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	tail := kc.length()
+	keys := make([]Keyword, 0, tail)
+	for i := 0; i < tail; i++ {
+		var keyword Keyword
+		if err := kc.cache.Get(kc.item(i), &keyword); err != nil {
+			return nil, err
+		}
+		keys = append(keys, keyword)
 	}
-	keys := keywords(keyIn)
 
-	if i >= len(keys) {
-		return Keyword{}, errors.New("wrong index")
+	return keys, nil
+}
+
+// Leases return keywords which are leased or wait for the next Lease
+func (kc *KeywordsCache) Leases() ([]Lease, error) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	return kc.load(leasePrefix)
+}
+
+// Failed return keywords which failed MaxAttempts times
+func (kc *KeywordsCache) Failed() ([]Lease, error) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	return kc.load(failedPrefix)
+}
+
+// Cursor return index of keyword which is returned by the next call of Next
+func (kc *KeywordsCache) Cursor() (int, error) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	return kc.cursor(), nil
+}
+
+// Seek move cursor, so the next call of Next returns keyword with index i.
+// Leases of keywords after cursor are dropped, they are handed out again
+// @params
+//	i: int (index of keyword, 0 resets cursor to the start of queue)
+// @return
+//	error
+func (kc *KeywordsCache) Seek(i int) error {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	tail := kc.length()
+	if i < 0 || i > tail {
+		return fmt.Errorf("keyword index %d is out of range 0..%d", i, tail)
+	}
+	leases, err := kc.load(leasePrefix)
+	if err != nil {
+		return err
+	}
+	for _, v := range leases {
+		if v.Pos-1 >= i {
+			kc.cache.Delete(kc.leaseKey(v.Pos - 1))
+		}
+	}
+	if i == 0 {
+		return kc.cache.Delete(kc.next)
 	}
+	kc.cache.Set(kc.next, i-1)
+
+	return nil
+}
 
-	return keys[i], nil
+// length return number of queued keywords
+func (kc *KeywordsCache) length() int {
+	var tail int
+	kc.cache.Get(kc.tail, &tail)
+
+	return tail
 }
 
-// key cast interface to int
-func key(k interface{}) int {
-	var num int
-	switch n := k.(type) {
-	case float64:
-		num = int(n)
-	case int:
-		num = n
-	default:
+// cursor return index of the next keyword
+func (kc *KeywordsCache) cursor() int {
+	var key int
+	if err := kc.cache.Get(kc.next, &key); err != nil {
+		return 0
 	}
 
-	return num
+	return key + 1
+}
+
+// take move cursor over the next keyword and return its index. Cursor is
+// swapped, so every keyword is taken once by workers of all processes
+// @return
+//	int (-1 if cursor is at the tail)
+//	error
+func (kc *KeywordsCache) take(tail int) (int, error) {
+	for {
+		var old interface{}
+		last := -1
+		var next int
+		if err := kc.cache.Get(kc.next, &next); err == nil {
+			old, last = next, next
+		}
+		if last+1 >= tail {
+			return -1, nil
+		}
+		ok, err := kc.cache.CompareAndSwap(kc.next, old, last+1)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return last + 1, nil
+		}
+	}
 }
 
-func keywords(keyIn interface{}) []Keyword {
-	if keyIn == nil {
-		return []Keyword{}
+// owned return stored lease if it is the lease handed out to the worker.
+// Expired lease may be handed out to other worker, then it is not owned
+func (kc *KeywordsCache) owned(l Lease) (Lease, error) {
+	var current Lease
+	if err := kc.cache.Get(kc.leaseKey(l.Pos-1), &current); err != nil {
+		return current, fmt.Errorf("keyword %s is not leased", l.Key)
+	}
+	if current.Attempts != l.Attempts || !current.Until.Equal(l.Until) {
+		return current, fmt.Errorf("lease of keyword %s is expired", l.Key)
 	}
-	keysJson, _ := json.Marshal(keyIn)
-	var keys []Keyword
-	json.Unmarshal(keysJson, &keys)
 
-	return keys
+	return current, nil
 }
 
-// Create new instance of keywordsCache
-func NewKeyCache(cache Storage) *KeywordsCache {
-	_, err := cache.GetV("_keys")
-	isEmpty := false
+// fail moves lease to the failed set
+func (kc *KeywordsCache) fail(l Lease) {
+	l.Until = time.Time{}
+	kc.cache.Set(failedPrefix+strconv.Itoa(l.Pos-1), l)
+	kc.cache.Delete(kc.leaseKey(l.Pos - 1))
+}
+
+// load return leases stored with prefix sorted by position
+func (kc *KeywordsCache) load(prefix string) ([]Lease, error) {
+	keys, err := kc.cache.Keys(prefix)
 	if err != nil {
-		isEmpty = true
+		return nil, err
 	}
 
+	leases := make([]Lease, 0, len(keys))
+	for _, k := range keys {
+		var l Lease
+		if err := kc.cache.Get(k, &l); err != nil {
+			continue
+		}
+		leases = append(leases, l)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].Pos < leases[j].Pos
+	})
+
+	return leases, nil
+}
+
+// item return cache key of keyword with index i
+func (kc *KeywordsCache) item(i int) string {
+	return KeywordsPrefix + ":" + strconv.Itoa(i)
+}
+
+// leaseKey return cache key of lease of keyword with index i
+func (kc *KeywordsCache) leaseKey(i int) string {
+	return leasePrefix + strconv.Itoa(i)
+}
+
+// seen return cache key of index of keyword. Keyword is escaped, so
+// cache key never contains namespace separator
+func (kc *KeywordsCache) seen(key string) string {
+	return KeywordsPrefix + "_seen:" + url.QueryEscape(key)
+}
+
+// migrate moves keywords stored as one slice by the previous versions
+// to the queue. Duplicates are removed and cursor is kept on the same keyword
+func (kc *KeywordsCache) migrate() error {
+	var keys []Keyword
+	if err := kc.cache.Get(KeywordsPrefix, &keys); err != nil {
+		return nil
+	}
+
+	last := -1
+	var next int
+	if err := kc.cache.Get(kc.next, &next); err == nil {
+		last = next
+	}
+	for i, v := range keys {
+		if err := kc.push(Keyword{Key: v.Key}); err != nil {
+			return err
+		}
+		if i == last {
+			next = kc.length() - 1
+		}
+	}
+	if last >= 0 {
+		kc.cache.Set(kc.next, next)
+	}
+
+	return kc.cache.Delete(KeywordsPrefix)
+}
+
+// Create new instance of keywordsCache. Leases which were not acked
+// before restart are handed out again after Visibility
+func NewKeyCache(cache Storage) *KeywordsCache {
 	c := &KeywordsCache{
-		cache: cache,
-		key:   "_keys",
-		next:  "_keys_next",
-		isEmpty: isEmpty,
+		Visibility:  DefaultVisibility,
+		MaxAttempts: DefaultMaxAttempts,
+		cache:       cache,
+		tail:        KeywordsPrefix + "_tail",
+		next:        KeywordsPrefix + "_next",
+	}
+	if err := c.migrate(); err != nil {
+		panic(err)
 	}
+
 	return c
 }
+
+// union append values which are not in to, to is not longer than max
+func union(to, values []string, max int) []string {
+	for _, v := range values {
+		if len(to) >= max {
+			break
+		}
+		if !contains(to, v) {
+			to = append(to, v)
+		}
+	}
+
+	return to
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,11 +1,15 @@
 package cache_test
 
 import (
+	"encoding/json"
 	"Nani/internal/app/cache"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type mockCache struct {
@@ -29,8 +33,80 @@ func (m *mockCache) GetV(key string) (interface{}, error) {
 	return v, nil
 }
 
+func (m *mockCache) Get(key string, out interface{}) error {
+	v, err := m.GetV(key)
+	if err != nil {
+		return err
+	}
+	b, _ := json.Marshal(v)
+
+	return json.Unmarshal(b, out)
+}
+
+func (m *mockCache) Keys(prefix string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	keys := make([]string, 0)
+	for k := range m.cache {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+func (m *mockCache) Delete(keys ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, k := range keys {
+		delete(m.cache, k)
+	}
+
+	return nil
+}
+
 func (m *mockCache) Dump() {}
 
+func (m *mockCache) Append(key string, values ...interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	list, ok := m.cache[key]
+	if !ok {
+		list = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(values[0])), 0, len(values)).Interface()
+	}
+	l := reflect.ValueOf(list)
+	for _, v := range values {
+		l = reflect.Append(l, reflect.ValueOf(v))
+	}
+	m.cache[key] = l.Interface()
+
+	return nil
+}
+
+func (m *mockCache) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, ok := m.cache[key]
+	if ok != (old != nil) {
+		return false, nil
+	}
+	if ok {
+		a, _ := json.Marshal(v)
+		b, _ := json.Marshal(old)
+		if string(a) != string(b) {
+			return false, nil
+		}
+	}
+	m.cache[key] = new
+
+	return true, nil
+}
+
+func (m *mockCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	m.Set(key, value)
+}
+
 func CreateCache() *mockCache {
 	return &mockCache{
 		cache: make(map[string]interface{}),
@@ -111,61 +187,316 @@ func TestNext_ShouldReturnErrorIfCacheIsEmpty_Error(t *testing.T) {
 	assert.Equal(t, "keywords are out of range", err.Error())
 }
 
-func TestRollback_ShouldRollbackToPrevPosition_NoErrors(t *testing.T) {
+func TestLease_ShouldHandOutKeywordsToWorkers_NoError(t *testing.T) {
+	kc := cache.NewKeyCache(CreateCache())
+	_, err := kc.Lease(1)
+	assert.Equal(t, cache.ErrKeywordsEmpty, err)
+	for _, v := range []string{"kry1", "kry2", "kry3"} {
+		assert.NoError(t, kc.Set(v))
+	}
+
+	first, err := kc.Lease(2)
+	assert.NoError(t, err)
+	assert.Len(t, first, 2)
+	assert.Equal(t, "kry1", first[0].Key)
+	assert.Equal(t, "kry2", first[1].Key)
+	second, err := kc.Lease(2)
+	assert.NoError(t, err)
+	assert.Len(t, second, 1)
+	assert.Equal(t, "kry3", second[0].Key)
+
+	_, err = kc.Lease(1)
+	assert.Equal(t, cache.ErrKeywordsLeased, err)
+	for _, v := range append(first, second...) {
+		assert.NoError(t, kc.Ack(v))
+	}
+	assert.Error(t, kc.Ack(first[0]))
+	_, err = kc.Lease(1)
+	assert.Equal(t, cache.ErrKeywordsOutOfRange, err)
+}
+
+func TestNack_ShouldReturnKeywordToQueueAndThenFail_NoError(t *testing.T) {
 	kc := cache.NewKeyCache(CreateCache())
+	kc.MaxAttempts = 2
 	assert.NoError(t, kc.Set("kry1"))
 	assert.NoError(t, kc.Set("kry2"))
-	assert.NoError(t, kc.Set("kry3"))
-	str, err := kc.Next()
+
+	leases, err := kc.Lease(1)
 	assert.NoError(t, err)
-	assert.Equal(t, "kry1", str)
-	str, err = kc.Next()
+	assert.NoError(t, kc.Nack(leases[0]))
+
+	leases, err = kc.Lease(2)
 	assert.NoError(t, err)
-	assert.Equal(t, "kry2", str)
-	assert.NoError(t, kc.Rollback())
-	str, err = kc.Next()
+	assert.Len(t, leases, 2)
+	assert.Equal(t, "kry1", leases[0].Key)
+	assert.Equal(t, 1, leases[0].Attempts)
+	assert.Equal(t, "kry2", leases[1].Key)
+	assert.NoError(t, kc.Ack(leases[1]))
+
+	assert.NoError(t, kc.Nack(leases[0]))
+	_, err = kc.Lease(1)
+	assert.Equal(t, cache.ErrKeywordsOutOfRange, err)
+	failed, err := kc.Failed()
+	assert.NoError(t, err)
+	assert.Len(t, failed, 1)
+	assert.Equal(t, "kry1", failed[0].Key)
+	assert.Equal(t, 2, failed[0].Attempts)
+}
+
+func TestLease_ShouldReturnExpiredLeasesAfterRestart_NoError(t *testing.T) {
+	c := CreateCache()
+	kc := cache.NewKeyCache(c)
+	kc.Visibility = time.Millisecond * 50
+	assert.NoError(t, kc.Set("kry1"))
+	leases, err := kc.Lease(1)
+	assert.NoError(t, err)
+	assert.Len(t, leases, 1)
+
+	// worker crashed before ack
+	kc = cache.NewKeyCache(c)
+	kc.Visibility = time.Millisecond * 50
+	_, err = kc.Lease(1)
+	assert.Equal(t, cache.ErrKeywordsLeased, err)
+
+	time.Sleep(time.Millisecond * 60)
+	leases, err = kc.Lease(1)
 	assert.NoError(t, err)
-	assert.Equal(t, "kry2", str)
+	assert.Equal(t, "kry1", leases[0].Key)
+	assert.Equal(t, 1, leases[0].Attempts)
+	assert.NoError(t, kc.Ack(leases[0]))
+	current, err := kc.Leases()
+	assert.NoError(t, err)
+	assert.Empty(t, current)
 }
 
-func TestRollback_ShouldReturnNoErrorIfCacheIsEmpty_NoError(t *testing.T) {
+func TestLease_ShouldNotHandOutKeywordTwiceToParallelWorkers_NoError(t *testing.T) {
 	kc := cache.NewKeyCache(CreateCache())
-	assert.NoError(t, kc.Set("key1"))
-	assert.NoError(t, kc.Rollback())
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, kc.Set(fmt.Sprint("key", i)))
+	}
+
+	var mutex sync.Mutex
+	seen := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				leases, err := kc.Lease(3)
+				if err != nil {
+					return
+				}
+				for _, l := range leases {
+					mutex.Lock()
+					seen[l.Key]++
+					mutex.Unlock()
+					kc.Ack(l)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 100)
+	for _, v := range seen {
+		assert.Equal(t, 1, v)
+	}
 }
 
-func TestDistinct_ShouldRemoveDuplicatesFromCache_NoError(t *testing.T) {
+func TestLease_ShouldShareLeasesBetweenProcesses_NoError(t *testing.T) {
+	c := CreateCache()
+	first, second := cache.NewKeyCache(c), cache.NewKeyCache(c)
+	first.Visibility = time.Millisecond * 50
+	second.Visibility = time.Millisecond * 50
+	assert.NoError(t, first.Set("kry1"))
+	assert.NoError(t, first.Set("kry2"))
+
+	a, err := first.Lease(1)
+	assert.NoError(t, err)
+	b, err := second.Lease(2)
+	assert.NoError(t, err)
+	assert.Len(t, b, 1)
+	assert.Equal(t, "kry1", a[0].Key)
+	assert.Equal(t, "kry2", b[0].Key)
+	leases, err := second.Leases()
+	assert.NoError(t, err)
+	assert.Len(t, leases, 2)
+	_, err = second.Lease(1)
+	assert.Equal(t, cache.ErrKeywordsLeased, err)
+
+	// lease of the first process expired and is handed out to the second one
+	time.Sleep(time.Millisecond * 60)
+	again, err := second.Lease(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "kry1", again[0].Key)
+	assert.Equal(t, 1, again[0].Attempts)
+	assert.Error(t, first.Ack(a[0]))
+	assert.NoError(t, second.Ack(again[0]))
+}
+
+func TestSet_ShouldSkipDuplicatesOnInsert_NoError(t *testing.T) {
 	kc := cache.NewKeyCache(CreateCache())
 
-	kc.Set("key1")
 	kc.Set("key1")
 	kc.Set("key1")
 	kc.Set("key2")
+	kc.Set("key1")
+	kc.Set("key/3")
 	kc.Set("key2")
-	kc.Set("key3")
-	kc.Set("key3")
+	kc.Set("key/3")
 	kc.Set("key4")
 
-	assert.NoError(t, kc.Distinct())
-	dubls := make(map[string]int)
+	keys := make([]string, 0)
 	for {
 		key, err := kc.Next()
 		if err != nil {
+			assert.Equal(t, cache.ErrKeywordsOutOfRange, err)
 			break
 		}
-		dubls[key]+=1
+		keys = append(keys, key)
 	}
+	assert.Equal(t, []string{"key1", "key2", "key/3", "key4"}, keys)
 
-	assert.Equal(t, 4, len(dubls))
+	// keyword which was already returned is not queued again
+	assert.NoError(t, kc.Set("key1"))
+	_, err := kc.Next()
+	assert.Equal(t, cache.ErrKeywordsOutOfRange, err)
+}
 
-	for _, v := range dubls {
-		assert.Equal(t, 1, v)
+func TestAdd_ShouldMergeNearDuplicatesAndKeepForms_NoError(t *testing.T) {
+	kc := cache.NewKeyCache(CreateCache())
+	assert.NoError(t, kc.Add(cache.Keyword{Key: "игры", Norm: "игр", Forms: []string{"Игры"}}))
+	assert.NoError(t, kc.Add(cache.Keyword{Key: "игра", Norm: "игр", Forms: []string{"игра"}}))
+	assert.NoError(t, kc.Add(cache.Keyword{Key: "игры", Norm: "игр", Forms: []string{"Игры"}}))
+	assert.NoError(t, kc.Add(cache.Keyword{Key: "гонки", Norm: "гонк", Forms: []string{"гонки"}}))
+
+	keys, err := kc.Keywords()
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.Keyword{
+		{Pos: 1, Key: "игры", Norm: "игр", Forms: []string{"Игры", "игра"}},
+		{Pos: 2, Key: "гонки", Norm: "гонк", Forms: []string{"гонки"}},
+	}, keys)
+	key, err := kc.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "игры", key)
+}
+
+// mockItemsDownCache fails swaps of queued keywords while it is down
+type mockItemsDownCache struct {
+	*mockCache
+	down bool
+}
+
+func (m *mockItemsDownCache) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	if m.down && strings.HasPrefix(key, cache.KeywordsPrefix+":") {
+		return false, fmt.Errorf("storage is down")
 	}
+
+	return m.mockCache.CompareAndSwap(key, old, new)
 }
 
-func TestDistinct_ShouldReturnErrorCozKeyNotFound_Error(t *testing.T) {
+func TestAdd_ShouldReleaseFormIfKeywordIsNotQueued_Error(t *testing.T) {
+	c := &mockItemsDownCache{mockCache: CreateCache(), down: true}
+	kc := cache.NewKeyCache(c)
+	assert.Error(t, kc.Add(cache.Keyword{Key: "игры", Norm: "игр"}))
+
+	c.down = false
+	assert.NoError(t, kc.Add(cache.Keyword{Key: "игры", Norm: "игр"}))
+	keys, err := kc.Keywords()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func TestAdd_ShouldMergeProvenanceOfDuplicates_NoError(t *testing.T) {
 	kc := cache.NewKeyCache(CreateCache())
+	first := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, kc.Add(cache.Keyword{Key: "games", Norm: "game", Sources: []string{"com.second"}, Weight: 2, Locale: "en", Depth: 2, Seen: first.Add(time.Hour)}))
+	assert.NoError(t, kc.Add(cache.Keyword{Key: "game", Norm: "game", Sources: []string{"com.first"}, Weight: 3, Depth: 1, Seen: first}))
+	assert.NoError(t, kc.Add(cache.Keyword{Key: "game", Norm: "game", Sources: []string{"com.first"}, Weight: 1}))
+
+	keys, err := kc.Keywords()
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.Keyword{{
+		Pos:     1,
+		Key:     "games",
+		Norm:    "game",
+		Sources: []string{"com.second", "com.first"},
+		Weight:  6,
+		Locale:  "en",
+		Depth:   1,
+		Seen:    first,
+	}}, keys)
+}
+
+func TestSet_ShouldNotCreateNamespaceKeys_NoError(t *testing.T) {
+	c := CreateCache()
+	kc := cache.NewKeyCache(c)
+	assert.NoError(t, kc.Set("key/with/slash"))
+
+	names, err := cache.Namespaces(c)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestNewKeyCache_ShouldMigrateKeywordsSlice_NoError(t *testing.T) {
+	c := CreateCache()
+	c.Set("_keys", []cache.Keyword{{Pos: 1, Key: "first"}, {Pos: 2, Key: "first"}, {Pos: 3, Key: "second"}, {Pos: 4, Key: "third"}})
+	c.Set("_keys_next", 2)
+
+	kc := cache.NewKeyCache(c)
+	_, err := c.GetV("_keys")
+	assert.Error(t, err)
+	keys, err := kc.Keywords()
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.Keyword{{Pos: 1, Key: "first"}, {Pos: 2, Key: "second"}, {Pos: 3, Key: "third"}}, keys)
+
+	key, err := kc.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "third", key)
+}
 
-	assert.Error(t, kc.Distinct())
+func BenchmarkSet_ShouldNotDependOnQueueLength(b *testing.B) {
+	for _, n := range []int{100, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			kc := cache.NewKeyCache(CreateCache())
+			for i := 0; i < n; i++ {
+				kc.Set(fmt.Sprint("key", i))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				kc.Set(fmt.Sprint("new", i))
+				kc.Next()
+			}
+		})
+	}
 }
 
+func TestSeek_ShouldMoveCursorOfKeywords_NoError(t *testing.T) {
+	kc := cache.NewKeyCache(CreateCache())
+	for _, v := range []string{"first", "second", "third"} {
+		assert.NoError(t, kc.Set(v))
+	}
+	cursor, err := kc.Cursor()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cursor)
+
+	assert.NoError(t, kc.Seek(2))
+	cursor, err = kc.Cursor()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cursor)
+	k, err := kc.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "third", k)
+
+	assert.NoError(t, kc.Seek(0))
+	k, err = kc.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", k)
+
+	assert.Error(t, kc.Seek(4))
+	assert.Error(t, kc.Seek(-1))
+	keys, err := kc.Keywords()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+}
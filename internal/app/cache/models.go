@@ -1,11 +1,46 @@
 package cache
 
+import "time"
+
+// Keyword of the queue. Key is requested from flow as api returned it first,
+// Norm is the form which is the same for near-duplicates and is used only
+// to deduplicate them, Forms are all keywords as api returned them.
+// Other fields are provenance of keyword, they explain why it was crawled
 type Keyword struct {
-	Pos int    `json:"pos,omitempty"`
-	Key string `json:"key,omitempty"`
+	Pos   int      `json:"pos,omitempty"`
+	Key   string   `json:"key,omitempty"`
+	Norm  string   `json:"norm,omitempty"`
+	Forms []string `json:"forms,omitempty"`
+	// Bundles of applications where keyword was found
+	Sources []string `json:"sources,omitempty"`
+	// Sum of weights of keyword in all sources
+	Weight int `json:"weight,omitempty"`
+	// Locale of api request which returned keyword, like ru-RU
+	Locale string `json:"locale,omitempty"`
+	// Number of hops from the seed list, keywords of seed apps have depth 1
+	// and keywords of apps found by keyword of depth d have depth d+1
+	Depth int `json:"depth,omitempty"`
+	// When keyword was found first time
+	Seen time.Time `json:"seen,omitempty"`
+}
+
+// Lease is keyword handed out to worker. Keyword returns to the queue
+// when worker nacks it or does not ack it until Until
+type Lease struct {
+	Pos      int       `json:"pos,omitempty"`
+	Key      string    `json:"key,omitempty"`
+	Attempts int       `json:"attempts,omitempty"`
+	Until    time.Time `json:"until,omitempty"`
+	// Depth of keyword, apps found by it have the same depth
+	Depth int `json:"depth,omitempty"`
 }
 
 type Item struct {
 	V       interface{} `json:"V,omitempty"`
 	Expired int64       `json:"Expired,omitempty"`
 }
+
+// IsExpired check if item has ttl and it is over. Expired is unix time in nanoseconds
+func (i Item) IsExpired(now time.Time) bool {
+	return i.Expired > 0 && now.UnixNano() >= i.Expired
+}
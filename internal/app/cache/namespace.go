@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Separator of namespace and key
+const NamespaceSeparator = "/"
+
+// Reserved prefix of namespaced keys, so keys without namespace which
+// contain NamespaceSeparator are not taken for keys of namespace
+const NamespacePrefix = "_ns:"
+
+// Namespace is the part of storage used by one job. All keys of namespace
+// are prefixed with NamespacePrefix and its name, so several jobs can
+// share one storage
+type Namespace struct {
+	storage Storage
+	name    string
+}
+
+func (n *Namespace) Set(key string, value interface{}) {
+	n.storage.Set(n.key(key), value)
+}
+
+func (n *Namespace) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	n.storage.SetWithTTL(n.key(key), value, ttl)
+}
+
+func (n *Namespace) GetV(key string) (interface{}, error) {
+	return n.storage.GetV(n.key(key))
+}
+
+func (n *Namespace) Get(key string, out interface{}) error {
+	return n.storage.Get(n.key(key), out)
+}
+
+// Keys return keys of namespace with prefix, keys are without namespace
+func (n *Namespace) Keys(prefix string) ([]string, error) {
+	keys, err := n.storage.Keys(n.key(prefix))
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range keys {
+		keys[i] = strings.TrimPrefix(v, n.key(""))
+	}
+
+	return keys, nil
+}
+
+func (n *Namespace) Delete(keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, v := range keys {
+		prefixed[i] = n.key(v)
+	}
+
+	return n.storage.Delete(prefixed...)
+}
+
+func (n *Namespace) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	return n.storage.CompareAndSwap(n.key(key), old, new)
+}
+
+func (n *Namespace) Append(key string, values ...interface{}) error {
+	return n.storage.Append(n.key(key), values...)
+}
+
+// Dump dumps the whole storage
+func (n *Namespace) Dump() {
+	n.storage.Dump()
+}
+
+// Name of namespace
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// key return key of storage
+func (n *Namespace) key(key string) string {
+	return NamespacePrefix + n.name + NamespaceSeparator + key
+}
+
+// Namespaces return sorted names of all namespaces of storage.
+// Keys without NamespacePrefix are not included
+// @params
+//	s: Storage
+// @return
+//	[]string
+//	error
+func Namespaces(s Storage) ([]string, error) {
+	keys, err := s.Keys(NamespacePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	unique := make(map[string]struct{})
+	for _, v := range keys {
+		v = strings.TrimPrefix(v, NamespacePrefix)
+		if i := strings.Index(v, NamespaceSeparator); i > 0 {
+			unique[v[:i]] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(unique))
+	for k := range unique {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// DropNamespace removes all keys of namespace from storage
+// @params
+//	s: Storage
+//	name: string (name of namespace)
+// @return
+//	int (number of removed keys)
+//	error
+func DropNamespace(s Storage, name string) (int, error) {
+	ns, err := NewNamespace(s, name)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := ns.Keys("")
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	return len(keys), ns.Delete(keys...)
+}
+
+// Create new namespace of storage. Name must not be empty and must not
+// contain NamespaceSeparator
+// @params
+//	s: Storage
+//	name: string (name of namespace, like job name)
+// @return
+//	*Namespace
+//	error (name is invalid)
+func NewNamespace(s Storage, name string) (*Namespace, error) {
+	if name == "" || strings.Contains(name, NamespaceSeparator) {
+		return nil, fmt.Errorf("invalid cache namespace %q", name)
+	}
+
+	return &Namespace{storage: s, name: name}, nil
+}
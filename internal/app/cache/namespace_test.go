@@ -0,0 +1,120 @@
+package cache_test
+
+import (
+	"Nani/internal/app/cache"
+	"Nani/internal/app/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func namespaceCache(t *testing.T) *cache.Cache {
+	dir, err := ioutil.TempDir("", "namespace")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	c := cache.Open(config.CacheConfig{Path: filepath.Join(dir, "cache.json")}, false)
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func namespace(t *testing.T, s cache.Storage, name string) *cache.Namespace {
+	ns, err := cache.NewNamespace(s, name)
+	assert.NoError(t, err)
+
+	return ns
+}
+
+func TestNamespace_ShouldIsolateKeysOfJobs_NoError(t *testing.T) {
+	c := namespaceCache(t)
+	ru := namespace(t, c, "ru")
+	en := namespace(t, c, "en")
+
+	ru.Set("last", "com.ru")
+	en.Set("last", "com.en")
+	c.Set("last", "com.global")
+
+	var last string
+	assert.NoError(t, ru.Get("last", &last))
+	assert.Equal(t, "com.ru", last)
+	v, err := en.GetV("last")
+	assert.NoError(t, err)
+	assert.Equal(t, "com.en", v)
+	v, err = c.GetV(cache.NamespacePrefix + "ru/last")
+	assert.NoError(t, err)
+	assert.Equal(t, "com.ru", v)
+
+	keys, err := ru.Keys("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"last"}, keys)
+}
+
+func TestNamespace_ShouldWorkWithKeywordsCache_NoError(t *testing.T) {
+	c := namespaceCache(t)
+	ru := cache.NewKeyCache(namespace(t, c, "ru"))
+	en := cache.NewKeyCache(namespace(t, c, "en"))
+	assert.NoError(t, ru.Set("ключ"))
+	assert.NoError(t, en.Set("key"))
+
+	k, err := ru.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "ключ", k)
+	k, err = en.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "key", k)
+}
+
+func TestNamespaces_ShouldListAndDropNamespaces_NoError(t *testing.T) {
+	c := namespaceCache(t)
+	namespace(t, c, "ru").Set("last", "com.ru")
+	namespace(t, c, "ru").Set("bundles", []string{"com.ru"})
+	namespace(t, c, "en").Set("last", "com.en")
+	c.Set("last", "com.global")
+
+	names, err := cache.Namespaces(c)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"en", "ru"}, names)
+
+	n, err := cache.DropNamespace(c, "ru")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	names, err = cache.Namespaces(c)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"en"}, names)
+	_, err = c.GetV("last")
+	assert.NoError(t, err)
+
+	n, err = cache.DropNamespace(c, "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestNamespaces_ShouldNotTakeKeysWithSeparatorForNamespace_NoError(t *testing.T) {
+	c := namespaceCache(t)
+	c.Set("ru/last", "com.global")
+	c.Set("https://example.com", "value")
+	namespace(t, c, "en").Set("last", "com.en")
+
+	names, err := cache.Namespaces(c)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"en"}, names)
+
+	n, err := cache.DropNamespace(c, "ru")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	v, err := c.GetV("ru/last")
+	assert.NoError(t, err)
+	assert.Equal(t, "com.global", v)
+}
+
+func TestNewNamespace_ShouldReturnErrorCozNameIsInvalid_Error(t *testing.T) {
+	c := namespaceCache(t)
+	_, err := cache.NewNamespace(c, "")
+	assert.Error(t, err)
+	_, err = cache.NewNamespace(c, "ru/en")
+	assert.Error(t, err)
+	_, err = cache.DropNamespace(c, "ru/en")
+	assert.Error(t, err)
+}
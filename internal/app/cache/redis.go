@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"Nani/internal/app/config"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v7"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RedisStorage keeps cache in redis, so several instances can share it.
+// Values are stored as json, so they are returned the same way as
+// values of Cache loaded from the file
+type RedisStorage struct {
+	client *redis.Client
+	prefix string
+}
+
+func (r *RedisStorage) Set(key string, value interface{}) {
+	r.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL store value which expires after ttl
+// @params
+//	key: string
+//	value: interface{}
+//	ttl: time.Duration (time to live, 0 or less means value never expires)
+func (r *RedisStorage) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("can not marshal value with key %s: %s", key, err)
+		return
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	if err := r.client.Set(r.prefix+key, b, ttl).Err(); err != nil {
+		log.Printf("can not set value with key %s to redis: %s", key, err)
+	}
+}
+
+func (r *RedisStorage) GetV(key string) (interface{}, error) {
+	var v interface{}
+	if err := r.Get(key, &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Get decodes json value with key to out
+// @params
+//	key: string
+//	out: interface{} (pointer to value)
+// @return
+//	error
+func (r *RedisStorage) Get(key string, out interface{}) error {
+	b, err := r.client.Get(r.prefix + key).Bytes()
+	if err == redis.Nil {
+		return fmt.Errorf("value with key %s not found", key)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// Keys return sorted keys which start with prefix
+// @params
+//	prefix: string (empty prefix matches all keys)
+// @return
+//	[]string
+//	error
+func (r *RedisStorage) Keys(prefix string) ([]string, error) {
+	match := globEscape(r.prefix+prefix) + "*"
+	keys := make([]string, 0)
+	// Scan may return the same key several times
+	seen := make(map[string]struct{})
+	iter := r.client.Scan(0, match, 1000).Iterator()
+	for iter.Next() {
+		if _, ok := seen[iter.Val()]; ok {
+			continue
+		}
+		seen[iter.Val()] = struct{}{}
+		keys = append(keys, strings.TrimPrefix(iter.Val(), r.prefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Delete removes values with keys
+func (r *RedisStorage) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, v := range keys {
+		prefixed[i] = r.prefix + v
+	}
+
+	return r.client.Del(prefixed...).Err()
+}
+
+// CompareAndSwap set new value if the current value equals old or value does
+// not exist if old is nil. Key is watched, so swap is atomic for all
+// instances sharing redis
+// @params
+//	key: string
+//	old: interface{} (expected current value, nil if value must not exist)
+//	new: interface{}
+// @return
+//	bool (false if current value is not old or it was changed concurrently)
+//	error
+func (r *RedisStorage) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	b, err := json.Marshal(new)
+	if err != nil {
+		return false, err
+	}
+
+	swapped := false
+	err = r.client.Watch(func(tx *redis.Tx) error {
+		current, err := tx.Get(r.prefix + key).Bytes()
+		if err == redis.Nil {
+			if old != nil {
+				return nil
+			}
+		} else if err != nil {
+			return err
+		} else {
+			if old == nil {
+				return nil
+			}
+			same, err := sameValue(json.RawMessage(current), old)
+			if err != nil || !same {
+				return err
+			}
+		}
+
+		_, err = tx.TxPipelined(func(p redis.Pipeliner) error {
+			p.Set(r.prefix+key, b, 0)
+			return nil
+		})
+		swapped = err == nil
+
+		return err
+	}, r.prefix+key)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+
+	return swapped, err
+}
+
+// Append adds values to the end of the list stored with key, list is created
+// if it does not exist. Key is watched, so values appended concurrently by
+// other instances are not lost
+// @params
+//	key: string
+//	values: ...interface{} (items of list)
+// @return
+//	error (stored value is not a list)
+func (r *RedisStorage) Append(key string, values ...interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	for {
+		err := r.client.Watch(func(tx *redis.Tx) error {
+			current, err := tx.Get(r.prefix + key).Bytes()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			ttl, err := tx.PTTL(r.prefix + key).Result()
+			if err != nil {
+				return err
+			}
+			b, err := appendJSON(current, values)
+			if err != nil {
+				return fmt.Errorf("can not append to value with key %s: %s", key, err)
+			}
+			if ttl < 0 {
+				ttl = 0
+			}
+
+			_, err = tx.TxPipelined(func(p redis.Pipeliner) error {
+				p.Set(r.prefix+key, b, ttl)
+				return nil
+			})
+
+			return err
+		}, r.prefix+key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+}
+
+// globEscape escapes special characters of redis glob pattern
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Dump does nothing, redis persists values itself
+func (r *RedisStorage) Dump() {}
+
+// Close connection to redis
+func (r *RedisStorage) Close() error {
+	return r.client.Close()
+}
+
+// Create new instance of RedisStorage
+// @params
+//	conf: config.RedisConfig (address of redis server and prefix of keys)
+// @return
+//	*RedisStorage
+//	error (redis server is not available)
+func NewRedis(conf config.RedisConfig) (*RedisStorage, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.Address,
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisStorage{
+		client: client,
+		prefix: conf.Prefix,
+	}, nil
+}
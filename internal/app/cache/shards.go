@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of shards of the in-memory store
+const shardCount = 32
+
+// shard is a part of the store guarded by its own lock
+type shard struct {
+	items map[string]Item
+	mutex sync.RWMutex
+}
+
+// shards is the in-memory store split by hash of key, so goroutines which
+// work with different keys do not wait for each other
+type shards []*shard
+
+// get return shard of key
+func (s shards) get(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return s[h.Sum32()%uint32(len(s))]
+}
+
+// rlock locks all shards for reading, so the whole store can be read
+// consistently. Shards are always locked in the same order
+func (s shards) rlock() {
+	for _, v := range s {
+		v.mutex.RLock()
+	}
+}
+
+func (s shards) runlock() {
+	for _, v := range s {
+		v.mutex.RUnlock()
+	}
+}
+
+// items return copy of all items, all shards must be locked
+func (s shards) items() map[string]Item {
+	items := make(map[string]Item, s.len())
+	for _, v := range s {
+		for k, item := range v.items {
+			items[k] = item
+		}
+	}
+
+	return items
+}
+
+// len return number of items, all shards must be locked
+func (s shards) len() int {
+	n := 0
+	for _, v := range s {
+		n += len(v.items)
+	}
+
+	return n
+}
+
+// keys return sorted keys of not expired items which start with prefix
+func (s shards) keys(prefix string, now time.Time) []string {
+	keys := make([]string, 0)
+	for _, v := range s {
+		v.mutex.RLock()
+		for k, item := range v.items {
+			if strings.HasPrefix(k, prefix) && !item.IsExpired(now) {
+				keys = append(keys, k)
+			}
+		}
+		v.mutex.RUnlock()
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// fill puts items to the shards
+func (s shards) fill(items map[string]Item) {
+	for k, v := range items {
+		sh := s.get(k)
+		sh.mutex.Lock()
+		sh.items[k] = v
+		sh.mutex.Unlock()
+	}
+}
+
+// cleanup removes expired items shard by shard
+func (s shards) cleanup(now time.Time) {
+	for _, v := range s {
+		v.mutex.Lock()
+		for k, item := range v.items {
+			if item.IsExpired(now) {
+				delete(v.items, k)
+			}
+		}
+		v.mutex.Unlock()
+	}
+}
+
+// Create new empty store with n shards
+func newShards(n int) shards {
+	s := make(shards, n)
+	for i := range s {
+		s[i] = &shard{items: make(map[string]Item)}
+	}
+
+	return s
+}
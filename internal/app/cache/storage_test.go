@@ -0,0 +1,394 @@
+package cache_test
+
+import (
+	"Nani/internal/app/cache"
+	"Nani/internal/app/config"
+	"encoding/json"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// backend opens storage and reopens it with the same data
+type backend struct {
+	name string
+	open func(t *testing.T) (s cache.Storage, reopen func() cache.Storage, wait func(d time.Duration))
+}
+
+func backends() []backend {
+	tempPath := func(t *testing.T, name string) string {
+		dir, err := ioutil.TempDir("", "storage")
+		assert.NoError(t, err)
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		return filepath.Join(dir, name)
+	}
+
+	return []backend{
+		{
+			name: "file",
+			open: func(t *testing.T) (cache.Storage, func() cache.Storage, func(d time.Duration)) {
+				conf := config.CacheConfig{Path: tempPath(t, "cache.json")}
+				open := func() cache.Storage {
+					c := cache.Open(conf, false)
+					t.Cleanup(func() { c.Close() })
+					return c
+				}
+
+				return open(), open, time.Sleep
+			},
+		},
+		{
+			name: "journal",
+			open: func(t *testing.T) (cache.Storage, func() cache.Storage, func(d time.Duration)) {
+				conf := config.CacheConfig{Path: tempPath(t, "cache.json"), Journal: true}
+				var last *cache.Cache
+				open := func() cache.Storage {
+					if last != nil {
+						last.Close()
+					}
+					c := cache.Open(conf, false)
+					t.Cleanup(func() { c.Close() })
+					last = c
+					return c
+				}
+
+				return open(), open, time.Sleep
+			},
+		},
+		{
+			name: "bolt",
+			open: func(t *testing.T) (cache.Storage, func() cache.Storage, func(d time.Duration)) {
+				path := tempPath(t, "cache.db")
+				var last *cache.BoltStorage
+				open := func() cache.Storage {
+					if last != nil {
+						last.Close()
+					}
+					var err error
+					last, err = cache.NewBolt(path)
+					assert.NoError(t, err)
+					t.Cleanup(func() { last.Close() })
+					return last
+				}
+
+				return open(), open, time.Sleep
+			},
+		},
+		{
+			name: "redis",
+			open: func(t *testing.T) (cache.Storage, func() cache.Storage, func(d time.Duration)) {
+				server, err := miniredis.Run()
+				assert.NoError(t, err)
+				t.Cleanup(server.Close)
+				open := func() cache.Storage {
+					r, err := cache.NewRedis(config.RedisConfig{Address: server.Addr(), Prefix: "test:"})
+					assert.NoError(t, err)
+					t.Cleanup(func() { r.Close() })
+					return r
+				}
+
+				return open(), open, server.FastForward
+			},
+		},
+	}
+}
+
+// jsonValue return value as it is restored from json
+func jsonValue(t *testing.T, v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+	var res interface{}
+	assert.NoError(t, json.Unmarshal(b, &res))
+
+	return res
+}
+
+// stored return value from storage as it is restored from json
+func stored(t *testing.T, s cache.Storage, key string) interface{} {
+	v, err := s.GetV(key)
+	assert.NoError(t, err)
+
+	return jsonValue(t, v)
+}
+
+func TestStorage_ShouldSetAndGetValues_NoError(t *testing.T) {
+	values := map[string]interface{}{
+		"string":   "value",
+		"number":   42,
+		"bool":     true,
+		"strings":  []string{"first", "second"},
+		"keywords": []cache.Keyword{{Pos: 1, Key: "key"}},
+	}
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, _, _ := b.open(t)
+			for k, v := range values {
+				s.Set(k, v)
+			}
+			for k, v := range values {
+				assert.Equal(t, jsonValue(t, v), stored(t, s, k), k)
+			}
+
+			s.Set("string", "changed")
+			assert.Equal(t, "changed", stored(t, s, "string"))
+		})
+	}
+}
+
+func TestStorage_ShouldReturnErrorCozKeyNotFound_Error(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, _, _ := b.open(t)
+			s.Set("key", "value")
+			v, err := s.GetV("key1")
+			assert.Error(t, err)
+			assert.Nil(t, v)
+		})
+	}
+}
+
+func TestStorage_ShouldExpireValuesWithTtl_NoError(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, _, wait := b.open(t)
+			s.SetWithTTL("short", "value", time.Millisecond*50)
+			s.SetWithTTL("forever", "value", 0)
+			assert.Equal(t, "value", stored(t, s, "short"))
+
+			wait(time.Millisecond * 60)
+			_, err := s.GetV("short")
+			assert.Error(t, err)
+			assert.Equal(t, "value", stored(t, s, "forever"))
+		})
+	}
+}
+
+func TestStorage_ShouldKeepValuesAfterReopen_NoError(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, reopen, _ := b.open(t)
+			s.Set("key", []string{"value"})
+			s.SetWithTTL("ttl", "value", time.Hour)
+			s.Dump()
+
+			s = reopen()
+			assert.Equal(t, []interface{}{"value"}, stored(t, s, "key"))
+			assert.Equal(t, "value", stored(t, s, "ttl"))
+		})
+	}
+}
+
+func TestStorage_ShouldSetValuesConcurrently_NoError(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, _, _ := b.open(t)
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 20; j++ {
+						key := fmt.Sprintf("key%d_%d", i, j)
+						s.Set(key, j)
+						s.GetV(key)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			for i := 0; i < 8; i++ {
+				assert.Equal(t, float64(19), stored(t, s, fmt.Sprintf("key%d_19", i)))
+			}
+		})
+	}
+}
+
+func TestStorage_ShouldCompareAndSwapValues_NoError(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, _, _ := b.open(t)
+			ok, err := s.CompareAndSwap("key", nil, cache.Lease{Pos: 1, Key: "first"})
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = s.CompareAndSwap("key", nil, cache.Lease{Pos: 2})
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			var l cache.Lease
+			assert.NoError(t, s.Get("key", &l))
+			ok, err = s.CompareAndSwap("key", cache.Lease{Pos: 1, Key: "other"}, cache.Lease{Pos: 2})
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			ok, err = s.CompareAndSwap("key", l, cache.Lease{Pos: 2})
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.NoError(t, s.Get("key", &l))
+			assert.Equal(t, 2, l.Pos)
+		})
+	}
+}
+
+func TestStorage_ShouldAppendValuesToList_NoError(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, reopen, _ := b.open(t)
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 5; j++ {
+						assert.NoError(t, s.Append("list", cache.Lease{Pos: i*5 + j}))
+					}
+				}(i)
+			}
+			wg.Wait()
+			assert.NoError(t, s.Append("list", cache.Lease{Pos: 20}, cache.Lease{Pos: 21}))
+			s.Dump()
+
+			var leases []cache.Lease
+			assert.NoError(t, reopen().Get("list", &leases))
+			assert.Len(t, leases, 22)
+			assert.Equal(t, 21, leases[21].Pos)
+
+			s.Set("value", "string")
+			assert.Error(t, s.Append("value", "item"))
+		})
+	}
+}
+
+func TestStorage_ShouldQueueKeywordsOfSeveralProcessesOnce_NoError(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, reopen, _ := b.open(t)
+			storages := []cache.Storage{s, s}
+			if b.name == "redis" {
+				// Every client is the separate process sharing redis
+				storages[1] = reopen()
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(kc *cache.KeywordsCache) {
+					defer wg.Done()
+					for j := 0; j < 20; j++ {
+						assert.NoError(t, kc.Add(cache.Keyword{Key: fmt.Sprintf("key%d", j), Weight: 1}))
+					}
+				}(cache.NewKeyCache(storages[i%2]))
+			}
+			wg.Wait()
+
+			keys, err := cache.NewKeyCache(s).Keywords()
+			assert.NoError(t, err)
+			assert.Len(t, keys, 20)
+			seen := make(map[string]struct{})
+			for i, v := range keys {
+				assert.Equal(t, i+1, v.Pos)
+				assert.Equal(t, 4, v.Weight, v.Key)
+				seen[v.Key] = struct{}{}
+			}
+			assert.Len(t, seen, 20)
+		})
+	}
+}
+
+func TestOpenStorage_ShouldOpenConfiguredBackend_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	server, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	file, err := cache.OpenStorage(config.CacheConfig{Path: filepath.Join(dir, "cache.json")})
+	assert.NoError(t, err)
+	assert.IsType(t, &cache.Cache{}, file)
+	file.(*cache.Cache).Close()
+
+	bolt, err := cache.OpenStorage(config.CacheConfig{Backend: "bolt", Path: filepath.Join(dir, "cache.db")})
+	assert.NoError(t, err)
+	assert.IsType(t, &cache.BoltStorage{}, bolt)
+	assert.NoError(t, bolt.(io.Closer).Close())
+
+	redis, err := cache.OpenStorage(config.CacheConfig{Backend: "redis", Redis: config.RedisConfig{Address: server.Addr()}})
+	assert.NoError(t, err)
+	assert.IsType(t, &cache.RedisStorage{}, redis)
+	assert.NoError(t, redis.(io.Closer).Close())
+
+	_, err = cache.OpenStorage(config.CacheConfig{Backend: "memcached"})
+	assert.EqualError(t, err, "unknown cache backend memcached")
+
+	addr := server.Addr()
+	server.Close()
+	_, err = cache.OpenStorage(config.CacheConfig{Backend: "redis", Redis: config.RedisConfig{Address: addr}})
+	assert.Error(t, err)
+
+	_, err = cache.OpenStorage(config.CacheConfig{Backend: "bolt", Path: dir})
+	assert.Error(t, err)
+}
+
+func TestStorage_ShouldGetTypedValuesAfterReopen_NoError(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, reopen, _ := b.open(t)
+			s.Set("strings", []string{"first", "second"})
+			s.Set("keywords", []cache.Keyword{{Pos: 1, Key: "key"}})
+			s.Set("number", 42)
+			s.Dump()
+
+			check := func(s cache.Storage) {
+				var strings []string
+				assert.NoError(t, s.Get("strings", &strings))
+				assert.Equal(t, []string{"first", "second"}, strings)
+				var keywords []cache.Keyword
+				assert.NoError(t, s.Get("keywords", &keywords))
+				assert.Equal(t, []cache.Keyword{{Pos: 1, Key: "key"}}, keywords)
+				var number int
+				assert.NoError(t, s.Get("number", &number))
+				assert.Equal(t, 42, number)
+				assert.Error(t, s.Get("missing", &number))
+			}
+			check(s)
+			check(reopen())
+		})
+	}
+}
+
+func TestStorage_ShouldListAndDeleteKeys_NoError(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			s, reopen, wait := b.open(t)
+			s.Set("job/bundles", []string{"com.app"})
+			s.Set("job/last", "com.app")
+			s.Set("job*/last", "com.app")
+			s.Set("last", "com.app")
+			s.SetWithTTL("job/expired", true, time.Millisecond*10)
+			wait(time.Millisecond * 20)
+
+			keys, err := s.Keys("job/")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"job/bundles", "job/last"}, keys)
+			keys, err = s.Keys("")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"job*/last", "job/bundles", "job/last", "last"}, keys)
+
+			assert.NoError(t, s.Delete("job/bundles", "job/last", "missing"))
+			s.Dump()
+			s = reopen()
+			keys, err = s.Keys("")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"job*/last", "last"}, keys)
+			_, err = s.GetV("job/last")
+			assert.Error(t, err)
+		})
+	}
+}
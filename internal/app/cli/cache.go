@@ -0,0 +1,481 @@
+package cli
+
+import (
+	"Nani/internal/app/cache"
+	"Nani/internal/app/config"
+	"Nani/internal/app/executor"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of executor state
+const (
+	bundlesKey = "bundles"
+	lastKey    = "last"
+	errorsKey  = "_errors"
+)
+
+// Prefixes of values cached with ttl, they are not merged
+var ttlPrefixes = []string{"_devapps_", "_flow_"}
+
+// Cache inspects and maintains the cache of executor
+//	nani cache [-config config/dev.yml] [-cache path] [-namespace job] command
+// Commands:
+//	keys [prefix]              list keys and sizes of values in bytes
+//	errors                     show saved errors grouped by type
+//	keywords                   print keyword queue with provenance, cursor, leased and failed keywords
+//	report                     print report of the last run
+//	reset [seed|keyword]       move seed or keyword cursor to the start, both by default
+//	seek seed|keyword <pos>    move cursor to the position, seed may be set by bundle
+//	merge <file>...            merge cache files of several shards to the cache
+//	compact                    remove expired values and write snapshot
+// Commands keys, errors, keywords and report only read the cache file and its
+// journal, so they can be run while the job is running
+func Cache(args []string, out io.Writer) (err error) {
+	flags := flag.NewFlagSet("cache", flag.ContinueOnError)
+	flags.SetOutput(out)
+	configPath := flags.String("config", "config/dev.yml", "Application config file")
+	path := flags.String("cache", "", "Cache file, by default path from config")
+	namespace := flags.String("namespace", "", "Cache namespace of job, by default namespace from config")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("cache command is not set")
+	}
+
+	conf := config.New(*configPath)
+	if *path != "" {
+		conf.Cache.Path = *path
+	}
+	if *namespace != "" {
+		conf.Cache.Namespace = *namespace
+	}
+	// Background autosave must not race with the command
+	conf.Cache.Autosave = 0
+
+	var storage cache.Storage
+	if readOnly(flags.Arg(0)) && (conf.Cache.Backend == "" || conf.Cache.Backend == "file") {
+		// Job may be running, its snapshot and journal must not be touched
+		storage = cache.OpenReadOnly(conf.Cache)
+	} else if storage, err = cache.OpenStorage(conf.Cache); err != nil {
+		return err
+	}
+	defer func() {
+		if e := closeStorage(storage); err == nil {
+			err = e
+		}
+	}()
+
+	job, err := jobStorage(storage, conf.Cache.Namespace)
+	if err != nil {
+		return err
+	}
+
+	return cacheCommand(job, flags.Arg(0), flags.Args()[1:], conf.Cache, out)
+}
+
+// cacheCommand run cache subcommand with given storage
+func cacheCommand(s cache.Storage, cmd string, args []string, conf config.CacheConfig, out io.Writer) error {
+	switch cmd {
+	case "keys":
+		prefix := ""
+		if len(args) > 0 {
+			prefix = args[0]
+		}
+		return cacheKeys(s, prefix, out)
+	case "errors":
+		return cacheErrors(s, out)
+	case "keywords":
+		return cacheKeywords(cache.NewKeyCache(s), out)
+	case "report":
+		return cacheReport(s, out)
+	case "reset":
+		target := "all"
+		if len(args) > 0 {
+			target = args[0]
+		}
+		if err := cacheReset(s, cache.NewKeyCache(s), target, out); err != nil {
+			return err
+		}
+	case "seek":
+		if len(args) < 2 {
+			return fmt.Errorf("seek needs cursor and position")
+		}
+		if err := cacheSeek(s, cache.NewKeyCache(s), args[0], args[1], out); err != nil {
+			return err
+		}
+	case "merge":
+		if len(args) == 0 {
+			return fmt.Errorf("merge needs cache files")
+		}
+		for _, v := range args {
+			src := cache.OpenReadOnly(config.CacheConfig{Path: v, Keep: conf.Keep, Journal: conf.Journal})
+			job, err := jobStorage(src, conf.Namespace)
+			n := 0
+			if err == nil {
+				n, err = cacheMerge(s, job)
+			}
+			src.Close()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "merged %d keys from %s\n", n, v)
+		}
+	case "compact":
+	default:
+		return fmt.Errorf("unknown cache command %s", cmd)
+	}
+
+	s.Dump()
+	keys, err := s.Keys("")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "cache saved with %d keys\n", len(keys))
+
+	return nil
+}
+
+// readOnly check if cache command only reads the cache
+func readOnly(cmd string) bool {
+	switch cmd {
+	case "keys", "errors", "keywords", "report":
+		return true
+	}
+
+	return false
+}
+
+// cacheKeys print keys with prefix and size of their json values
+func cacheKeys(s cache.Storage, prefix string, out io.Writer) error {
+	keys, err := s.Keys(prefix)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, k := range keys {
+		v, err := s.GetV(k)
+		if err != nil {
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		total += len(b)
+		fmt.Fprintf(out, "%s\t%d\n", k, len(b))
+	}
+	fmt.Fprintf(out, "%d keys, %d bytes\n", len(keys), total)
+
+	return nil
+}
+
+// cacheErrors print saved errors grouped by type with the last error of type
+func cacheErrors(s cache.Storage, out io.Writer) error {
+	var errs []executor.ExecutorError
+	if err := s.Get(errorsKey, &errs); err != nil {
+		fmt.Fprintln(out, "no errors")
+		return nil
+	}
+
+	groups := make(map[string][]executor.ExecutorError)
+	for _, v := range errs {
+		groups[v.T] = append(groups[v.T], v)
+	}
+	types := make([]string, 0, len(groups))
+	for k := range groups {
+		types = append(types, k)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if len(groups[types[i]]) != len(groups[types[j]]) {
+			return len(groups[types[i]]) > len(groups[types[j]])
+		}
+		return types[i] < types[j]
+	})
+
+	for _, t := range types {
+		last := groups[t][len(groups[t])-1]
+		fmt.Fprintf(out, "%s\t%d\tlast: %s %s\n", t, len(groups[t]), last.Bundle, last.Er)
+	}
+	fmt.Fprintf(out, "%d errors\n", len(errs))
+
+	return nil
+}
+
+// cacheKeywords print keyword queue and mark keyword at the cursor
+func cacheKeywords(kc cache.KeyStorage, out io.Writer) error {
+	keys, err := kc.Keywords()
+	if err != nil {
+		return err
+	}
+	cursor, err := kc.Cursor()
+	if err != nil {
+		return err
+	}
+
+	for i, v := range keys {
+		mark := " "
+		if i == cursor {
+			mark = ">"
+		}
+		fmt.Fprintf(out, "%s %d\t%s%s\n", mark, i, v.Key, provenance(v))
+	}
+	fmt.Fprintf(out, "%d keywords, cursor %d\n", len(keys), cursor)
+
+	leases, err := kc.Leases()
+	if err != nil {
+		return err
+	}
+	for _, v := range leases {
+		fmt.Fprintf(out, "leased %d\t%s\tattempts %d\n", v.Pos-1, v.Key, v.Attempts)
+	}
+	failed, err := kc.Failed()
+	if err != nil {
+		return err
+	}
+	for _, v := range failed {
+		fmt.Fprintf(out, "failed %d\t%s\tattempts %d\n", v.Pos-1, v.Key, v.Attempts)
+	}
+
+	return nil
+}
+
+// cacheReport print report of the last run saved by executor
+func cacheReport(s cache.Storage, out io.Writer) error {
+	var r executor.Report
+	if err := s.Get(executor.ReportKey, &r); err != nil {
+		fmt.Fprintln(out, "no report")
+		return nil
+	}
+
+	fmt.Fprintf(out, "run %s - %s\n", r.Started.Format(time.RFC3339), r.Finished.Format(time.RFC3339))
+	fmt.Fprintf(out, "%d keywords, %d leased, %d failed\n", r.Keywords, len(r.Leased), len(r.Failed))
+	depths := make([]int, 0, len(r.Depths))
+	for k := range r.Depths {
+		depths = append(depths, k)
+	}
+	sort.Ints(depths)
+	for _, d := range depths {
+		fmt.Fprintf(out, "depth %d\t%d keywords\n", d, r.Depths[d])
+	}
+	for _, v := range r.Top {
+		fmt.Fprintf(out, "%s%s\n", v.Key, provenance(v))
+	}
+	for _, v := range r.Failed {
+		fmt.Fprintf(out, "failed %s\tattempts %d\n", v.Key, v.Attempts)
+	}
+	rules := make([]string, 0, len(r.Rejected))
+	for k := range r.Rejected {
+		rules = append(rules, k)
+	}
+	sort.Strings(rules)
+	for _, v := range rules {
+		fmt.Fprintf(out, "rejected by %s\t%d\n", v, r.Rejected[v])
+	}
+	if r.Fallbacks > 0 {
+		fmt.Fprintf(out, "local extractor used %d times\n", r.Fallbacks)
+	}
+
+	return nil
+}
+
+// provenance return columns with provenance of keyword, keyword without
+// provenance has no columns
+func provenance(k cache.Keyword) string {
+	if k.Weight == 0 && k.Depth == 0 && len(k.Sources) == 0 {
+		return ""
+	}
+	p := fmt.Sprintf("\tweight %d\tdepth %d", k.Weight, k.Depth)
+	if k.Locale != "" {
+		p += "\tlocale " + k.Locale
+	}
+	if !k.Seen.IsZero() {
+		p += "\tseen " + k.Seen.Format(time.RFC3339)
+	}
+	if len(k.Sources) > 0 {
+		p += "\tfrom " + strings.Join(k.Sources, ",")
+	}
+
+	return p
+}
+
+// cacheReset move seed, keyword or all cursors to the start
+func cacheReset(s cache.Storage, kc cache.KeyStorage, target string, out io.Writer) error {
+	if target != "all" && target != "seed" && target != "keyword" {
+		return fmt.Errorf("unknown cursor %s", target)
+	}
+	if target == "all" || target == "seed" {
+		if err := s.Delete(lastKey); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "seed cursor reset")
+	}
+	if target == "all" || target == "keyword" {
+		if err := kc.Seek(0); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "keyword cursor reset")
+	}
+
+	return nil
+}
+
+// cacheSeek move seed or keyword cursor to the position. Seed position
+// is index or bundle of the seed list
+func cacheSeek(s cache.Storage, kc cache.KeyStorage, target, pos string, out io.Writer) error {
+	switch target {
+	case "seed":
+		var bundles []string
+		if err := s.Get(bundlesKey, &bundles); err != nil {
+			return fmt.Errorf("seed list is empty")
+		}
+		bundle := pos
+		if i, err := strconv.Atoi(pos); err == nil {
+			if i < 0 || i >= len(bundles) {
+				return fmt.Errorf("seed index %d is out of range 0..%d", i, len(bundles)-1)
+			}
+			bundle = bundles[i]
+		} else if !contains(bundles, bundle) {
+			return fmt.Errorf("bundle %s is not in seed list", bundle)
+		}
+		s.Set(lastKey, bundle)
+		fmt.Fprintf(out, "seed cursor moved to %s\n", bundle)
+	case "keyword":
+		i, err := strconv.Atoi(pos)
+		if err != nil {
+			return fmt.Errorf("keyword position must be index: %s", err)
+		}
+		if err := kc.Seek(i); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "keyword cursor moved to %d\n", i)
+	default:
+		return fmt.Errorf("unknown cursor %s", target)
+	}
+
+	return nil
+}
+
+// cacheMerge copy state of other shard to the storage. Seed lists and
+// keyword queues are joined without duplicates, errors are appended,
+// cursors of storage are kept and other keys are copied if they are missing.
+// Values cached with ttl are skipped, they are requested again anyway
+// @return
+//	int (number of merged keys)
+//	error
+func cacheMerge(dst, src cache.Storage) (int, error) {
+	keys, err := src.Keys("")
+	if err != nil {
+		return 0, err
+	}
+
+	merged, keywords := 0, false
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, cache.KeywordsPrefix):
+			// Keyword queue is stored in several keys, it is merged once
+			if keywords {
+				continue
+			}
+			keywords = true
+			if err := mergeKeywords(cache.NewKeyCache(dst), cache.NewKeyCache(src)); err != nil {
+				return merged, err
+			}
+		case k == bundlesKey:
+			var to, from []string
+			dst.Get(bundlesKey, &to)
+			if err := src.Get(bundlesKey, &from); err != nil {
+				return merged, err
+			}
+			for _, v := range from {
+				if !contains(to, v) {
+					to = append(to[:len(to):len(to)], v)
+				}
+			}
+			dst.Set(bundlesKey, to)
+		case k == errorsKey:
+			var to, from []executor.ExecutorError
+			dst.Get(errorsKey, &to)
+			if err := src.Get(errorsKey, &from); err != nil {
+				return merged, err
+			}
+			dst.Set(errorsKey, append(to[:len(to):len(to)], from...))
+		default:
+			if hasPrefix(k, ttlPrefixes) {
+				continue
+			}
+			if _, err := dst.GetV(k); err == nil {
+				continue
+			}
+			v, err := src.GetV(k)
+			if err != nil {
+				continue
+			}
+			dst.Set(k, v)
+		}
+		merged++
+	}
+
+	return merged, nil
+}
+
+// mergeKeywords append keywords of other queue, queue skips duplicates itself
+func mergeKeywords(to, from cache.KeyStorage) error {
+	keywords, err := from.Keywords()
+	if err != nil {
+		return err
+	}
+	for _, v := range keywords {
+		if err := to.Add(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jobStorage return namespace of storage or storage itself if namespace is empty
+func jobStorage(s cache.Storage, namespace string) (cache.Storage, error) {
+	if namespace == "" {
+		return s, nil
+	}
+
+	return cache.NewNamespace(s, namespace)
+}
+
+// closeStorage close storage if it can be closed
+func closeStorage(s cache.Storage) error {
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	for _, v := range prefixes {
+		if strings.HasPrefix(s, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
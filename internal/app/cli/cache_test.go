@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"Nani/internal/app/cache"
+	"Nani/internal/app/config"
+	"Nani/internal/app/executor"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openCache(t *testing.T, name string) (*cache.Cache, config.CacheConfig) {
+	dir, err := ioutil.TempDir("", "cli")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	conf := config.CacheConfig{Path: filepath.Join(dir, name)}
+	c := cache.Open(conf, false)
+	t.Cleanup(func() { c.Close() })
+
+	return c, conf
+}
+
+func TestCacheKeys_ShouldListKeysWithSizes_NoError(t *testing.T) {
+	c, conf := openCache(t, "cache.json")
+	c.Set("last", "com.app")
+	c.Set("bundles", []string{"com.app", "com.other"})
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, cacheCommand(c, "keys", nil, conf, out))
+	assert.Equal(t, "bundles\t23\nlast\t9\n2 keys, 32 bytes\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, cacheCommand(c, "keys", []string{"la"}, conf, out))
+	assert.Equal(t, "last\t9\n1 keys, 9 bytes\n", out.String())
+}
+
+func TestCacheErrors_ShouldGroupErrorsByType_NoError(t *testing.T) {
+	c, conf := openCache(t, "cache.json")
+	out := &bytes.Buffer{}
+	assert.NoError(t, cacheCommand(c, "errors", nil, conf, out))
+	assert.Equal(t, "no errors\n", out.String())
+
+	c.Set("_errors", []executor.ExecutorError{
+		{T: "Db", Er: "timeout", Bundle: "com.1"},
+		{T: "keys", Er: "bad request", Bundle: "com.2"},
+		{T: "Db", Er: "refused", Bundle: "com.3"},
+	})
+	out.Reset()
+	assert.NoError(t, cacheCommand(c, "errors", nil, conf, out))
+	assert.Equal(t, "Db\t2\tlast: com.3 refused\nkeys\t1\tlast: com.2 bad request\n3 errors\n", out.String())
+}
+
+func TestCacheKeywords_ShouldPrintQueueAndCursor_NoError(t *testing.T) {
+	c, conf := openCache(t, "cache.json")
+	kc := cache.NewKeyCache(c)
+	for _, v := range []string{"first", "second", "third"} {
+		assert.NoError(t, kc.Set(v))
+	}
+	_, err := kc.Next()
+	assert.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, cacheCommand(c, "keywords", nil, conf, out))
+	assert.Equal(t, "  0\tfirst\n> 1\tsecond\n  2\tthird\n3 keywords, cursor 1\n", out.String())
+}
+
+func TestCacheKeywords_ShouldPrintLeasedAndFailedKeywords_NoError(t *testing.T) {
+	c, conf := openCache(t, "cache.json")
+	kc := cache.NewKeyCache(c)
+	kc.MaxAttempts = 1
+	for _, v := range []string{"first", "second"} {
+		assert.NoError(t, kc.Set(v))
+	}
+	leases, err := kc.Lease(2)
+	assert.NoError(t, err)
+	assert.NoError(t, kc.Nack(leases[0]))
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, cacheCommand(c, "keywords", nil, conf, out))
+	assert.Equal(t, "  0\tfirst\n  1\tsecond\n2 keywords, cursor 2\nleased 1\tsecond\tattempts 0\nfailed 0\tfirst\tattempts 1\n", out.String())
+}
+
+func TestCacheReport_ShouldPrintProvenanceOfKeywords_NoError(t *testing.T) {
+	c, conf := openCache(t, "cache.json")
+	out := &bytes.Buffer{}
+	assert.NoError(t, cacheCommand(c, "report", nil, conf, out))
+	assert.Equal(t, "no report\n", out.String())
+
+	seen := time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)
+	game := cache.Keyword{Pos: 1, Key: "games", Norm: "game", Sources: []string{"com.first", "com.second"}, Weight: 5, Locale: "en", Depth: 1, Seen: seen}
+	assert.NoError(t, cache.NewKeyCache(c).Add(game))
+	c.Set(executor.ReportKey, executor.Report{
+		Started:   seen,
+		Finished:  seen.Add(time.Hour),
+		Keywords:  1,
+		Depths:    map[int]int{1: 1},
+		Top:       []cache.Keyword{game},
+		Failed:    []cache.Lease{{Pos: 2, Key: "broken", Attempts: 3}},
+		Rejected:  map[string]int{"short": 2, "brands": 1},
+		Fallbacks: 4,
+	})
+	c.Dump()
+	c.Close()
+	c = cache.Open(conf, false)
+	t.Cleanup(func() { c.Close() })
+
+	provenance := "games\tweight 5\tdepth 1\tlocale en\tseen 2020-07-01T10:00:00Z\tfrom com.first,com.second\n"
+	out.Reset()
+	assert.NoError(t, cacheCommand(c, "report", nil, conf, out))
+	assert.Equal(t, "run 2020-07-01T10:00:00Z - 2020-07-01T11:00:00Z\n"+
+		"1 keywords, 0 leased, 1 failed\n"+
+		"depth 1\t1 keywords\n"+
+		provenance+
+		"failed broken\tattempts 3\n"+
+		"rejected by brands\t1\n"+
+		"rejected by short\t2\n"+
+		"local extractor used 4 times\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, cacheCommand(c, "keywords", nil, conf, out))
+	assert.Equal(t, "> 0\t"+provenance+"1 keywords, cursor 0\n", out.String())
+}
+
+func TestCacheSeek_ShouldMoveAndResetCursors_NoError(t *testing.T) {
+	c, conf := openCache(t, "cache.json")
+	c.Set("bundles", []string{"com.1", "com.2", "com.3"})
+	kc := cache.NewKeyCache(c)
+	for _, v := range []string{"first", "second", "third"} {
+		assert.NoError(t, kc.Set(v))
+	}
+	out := &bytes.Buffer{}
+
+	assert.NoError(t, cacheCommand(c, "seek", []string{"seed", "2"}, conf, out))
+	var last string
+	assert.NoError(t, c.Get("last", &last))
+	assert.Equal(t, "com.3", last)
+	assert.NoError(t, cacheCommand(c, "seek", []string{"seed", "com.2"}, conf, out))
+	assert.NoError(t, c.Get("last", &last))
+	assert.Equal(t, "com.2", last)
+	assert.Error(t, cacheCommand(c, "seek", []string{"seed", "com.4"}, conf, out))
+	assert.Error(t, cacheCommand(c, "seek", []string{"seed", "3"}, conf, out))
+
+	assert.NoError(t, cacheCommand(c, "seek", []string{"keyword", "2"}, conf, out))
+	k, err := cache.NewKeyCache(c).Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "third", k)
+	assert.Error(t, cacheCommand(c, "seek", []string{"keyword", "4"}, conf, out))
+
+	assert.NoError(t, cacheCommand(c, "reset", nil, conf, out))
+	_, err = c.GetV("last")
+	assert.Error(t, err)
+	k, err = cache.NewKeyCache(c).Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", k)
+	assert.Error(t, cacheCommand(c, "reset", []string{"bundle"}, conf, out))
+}
+
+func TestCacheMerge_ShouldJoinStateOfShards_NoError(t *testing.T) {
+	c, conf := openCache(t, "cache.json")
+	c.Set("bundles", []string{"com.1", "com.2"})
+	c.Set("last", "com.2")
+	c.Set("_errors", []executor.ExecutorError{{T: "Db", Bundle: "com.1"}})
+	assert.NoError(t, cache.NewKeyCache(c).Set("first"))
+
+	shard, shardConf := openCache(t, "shard.json")
+	shard.Set("bundles", []string{"com.2", "com.3"})
+	shard.Set("last", "com.3")
+	shard.Set("_errors", []executor.ExecutorError{{T: "keys", Bundle: "com.3"}})
+	shard.Set("_webhooks", []string{})
+	shard.SetWithTTL("_flow_key", true, time.Hour)
+	for _, v := range []string{"first", "second"} {
+		assert.NoError(t, cache.NewKeyCache(shard).Set(v))
+	}
+	shard.Dump()
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, cacheCommand(c, "merge", []string{shardConf.Path}, conf, out))
+
+	var bundles []string
+	assert.NoError(t, c.Get("bundles", &bundles))
+	assert.Equal(t, []string{"com.1", "com.2", "com.3"}, bundles)
+	var last string
+	assert.NoError(t, c.Get("last", &last))
+	assert.Equal(t, "com.2", last)
+	var errs []executor.ExecutorError
+	assert.NoError(t, c.Get("_errors", &errs))
+	assert.Len(t, errs, 2)
+	keywords, err := cache.NewKeyCache(c).Keywords()
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.Keyword{{Pos: 1, Key: "first"}, {Pos: 2, Key: "second"}}, keywords)
+	_, err = c.GetV("_webhooks")
+	assert.NoError(t, err)
+	_, err = c.GetV("_flow_key")
+	assert.Error(t, err)
+	assert.Contains(t, out.String(), "merged 4 keys from "+shardConf.Path)
+
+	_, err = os.Stat(conf.Path)
+	assert.NoError(t, err)
+}
+
+func TestCache_ShouldReadJournalOfRunningJobWithoutRotatingIt_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	conf := config.CacheConfig{Path: filepath.Join(dir, "cache.json"), Journal: true}
+	configPath := filepath.Join(dir, "config.yml")
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte("cache:\n  path: "+conf.Path+"\n  journal: true\n"), 0644))
+
+	job := cache.Open(conf, false)
+	t.Cleanup(func() { job.Close() })
+	job.Set("last", "com.app")
+	snapshot, err := ioutil.ReadFile(conf.Path)
+	assert.NoError(t, err)
+
+	for _, cmd := range []string{"keys", "errors", "keywords", "report"} {
+		out := &bytes.Buffer{}
+		assert.NoError(t, Cache([]string{"-config", configPath, cmd}, out), cmd)
+	}
+	out := &bytes.Buffer{}
+	assert.NoError(t, Cache([]string{"-config", configPath, "keys"}, out))
+	assert.Contains(t, out.String(), "last\t9\n")
+
+	_, err = os.Stat(conf.Path + ".wal.1")
+	assert.True(t, os.IsNotExist(err))
+	current, err := ioutil.ReadFile(conf.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, snapshot, current)
+
+	// Journal of the job is still appended after commands
+	job.Set("next", "com.next")
+	out.Reset()
+	assert.NoError(t, Cache([]string{"-config", configPath, "keys"}, out))
+	assert.Contains(t, out.String(), "next\t10\n")
+}
+
+func TestCacheCommand_ShouldReturnErrorCozCommandIsUnknown_Error(t *testing.T) {
+	c, conf := openCache(t, "cache.json")
+
+	assert.Error(t, cacheCommand(c, "drop", nil, conf, &bytes.Buffer{}))
+	assert.Error(t, cacheCommand(c, "merge", nil, conf, &bytes.Buffer{}))
+	assert.Error(t, cacheCommand(c, "seek", []string{"seed"}, conf, &bytes.Buffer{}))
+}
+
+func TestCache_ShouldReturnErrorCozNamespaceIsInvalid_Error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	configPath := filepath.Join(dir, "config.yml")
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte("cache:\n  path: "+filepath.Join(dir, "cache.json")+"\n"), 0644))
+
+	err = Cache([]string{"-config", configPath, "-namespace", "ru/en", "keys"}, &bytes.Buffer{})
+	assert.EqualError(t, err, `invalid cache namespace "ru/en"`)
+}
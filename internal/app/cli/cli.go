@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// Command of the nani binary
+type Command func(args []string, out io.Writer) error
+
+var commands = map[string]Command{
+	"migrate": Migrate,
+	"export":  Export,
+	"cache":   Cache,
+}
+
+// Run command with given name
+// @params
+//	name: string (command name, for example migrate)
+//	args: []string (command arguments)
+//	out: io.Writer (command output)
+// @return
+//	error
+func Run(name string, args []string, out io.Writer) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %s", name)
+	}
+
+	return cmd(args, out)
+}
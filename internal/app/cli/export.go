@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const exportBatch = 1000
+
+// streamer reads stored applications row by row
+type streamer interface {
+	Stream(ctx context.Context, filter db.AppFilter, fn func(app db.StoredApp) error) error
+}
+
+// Export writes stored applications to parquet, jsonl or csv files
+//	nani export [-config config/dev.yml] -out data/apps.parquet [-format parquet|jsonl|csv]
+//		[-category GAME] [-developer id] [-from 2020-10-01] [-to 2020-11-01] [-max-size 104857600] [-gzip]
+func Export(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(out)
+	configPath := flags.String("config", "config/dev.yml", "Application config file")
+	path := flags.String("out", "", "Base path of export files, sequence number is added to the name")
+	format := flags.String("format", "", "Format of files parquet, jsonl or csv, by default extension of out")
+	category := flags.String("category", "", "Export only applications of category")
+	developer := flags.String("developer", "", "Export only applications of developer id")
+	from := flags.String("from", "", "Export snapshots stored from date, 2006-01-02")
+	to := flags.String("to", "", "Export snapshots stored before date, 2006-01-02")
+	maxSize := flags.Int64("max-size", 0, "Max size of file in bytes, 0 is unlimited")
+	gzip := flags.Bool("gzip", false, "Compress jsonl and csv files with gzip")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return fmt.Errorf("export path is not set, use -out")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*path), ".")
+	}
+	if *format != "parquet" && *format != "jsonl" && *format != "csv" {
+		return fmt.Errorf("unknown export format %s", *format)
+	}
+
+	filter := db.AppFilter{Category: *category, DeveloperId: *developer}
+	var err error
+	if filter.From, err = parseDate(*from); err != nil {
+		return err
+	}
+	if filter.To, err = parseDate(*to); err != nil {
+		return err
+	}
+
+	conf := config.New(*configPath)
+	url, err := db.ConnectionUrl(conf.Database)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Connect(url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	w, err := db.OpenWriter(*format, config.FileConfig{Path: *path, MaxSize: *maxSize, Gzip: *gzip})
+	if err != nil {
+		return err
+	}
+
+	return export(context.Background(), db.New(config.DBConfig{Connection: conn}), filter, w, out)
+}
+
+// export stream applications matched by filter to the writer by batches
+func export(ctx context.Context, s streamer, filter db.AppFilter, w db.StoredWriter, out io.Writer) error {
+	count := 0
+	batch := make([]db.StoredApp, 0, exportBatch)
+	err := s.Stream(ctx, filter, func(app db.StoredApp) error {
+		batch = append(batch, app)
+		if len(batch) < exportBatch {
+			return nil
+		}
+		count += len(batch)
+		err := w.WriteStored(batch)
+		batch = batch[:0]
+
+		return err
+	})
+	if err == nil && len(batch) > 0 {
+		count += len(batch)
+		err = w.WriteStored(batch)
+	}
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	files := w.Files()
+	fmt.Fprintf(out, "exported %d rows to %d files\n", count, len(files))
+	for _, v := range files {
+		fmt.Fprintln(out, v)
+	}
+
+	return nil
+}
+
+// parseDate parse date in format 2006-01-02, empty date is zero time
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse("2006-01-02", s)
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"Nani/internal/app/inhuman"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type mock_streamer struct {
+	apps   []db.StoredApp
+	filter db.AppFilter
+	err    error
+}
+
+func (m *mock_streamer) Stream(ctx context.Context, filter db.AppFilter, fn func(app db.StoredApp) error) error {
+	m.filter = filter
+	for _, v := range m.apps {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	return m.err
+}
+
+func storedApps(n int) []db.StoredApp {
+	apps := make([]db.StoredApp, n)
+	for i := range apps {
+		apps[i] = db.StoredApp{
+			App:      &inhuman.App{Bundle: fmt.Sprintf("com.%d", i), Screenshots: []string{"1", "2"}},
+			Datetime: time.Date(2020, 10, 20, 10, 0, 0, 0, time.UTC),
+		}
+	}
+
+	return apps
+}
+
+func TestExport_ShouldWriteAllRowsByBatches_NoError(t *testing.T) {
+	dir := t.TempDir()
+	s := &mock_streamer{apps: storedApps(exportBatch + 5)}
+	w, err := db.OpenWriter("jsonl", config.FileConfig{Path: filepath.Join(dir, "apps.jsonl")})
+	assert.NoError(t, err)
+	filter := db.AppFilter{Category: "GAME"}
+	out := &bytes.Buffer{}
+
+	assert.NoError(t, export(context.Background(), s, filter, w, out))
+	assert.Equal(t, filter, s.filter)
+	assert.Contains(t, out.String(), fmt.Sprintf("exported %d rows to 1 files", exportBatch+5))
+
+	f, err := os.Open(w.Files()[0])
+	assert.NoError(t, err)
+	defer f.Close()
+	lines := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines++
+	}
+	assert.Equal(t, exportBatch+5, lines)
+}
+
+func TestExport_ShouldSplitCsvFilesBySize_NoError(t *testing.T) {
+	dir := t.TempDir()
+	s := &mock_streamer{apps: storedApps(10)}
+	w, err := db.OpenWriter("csv", config.FileConfig{Path: filepath.Join(dir, "apps.csv"), MaxSize: 1})
+	assert.NoError(t, err)
+	out := &bytes.Buffer{}
+
+	assert.NoError(t, export(context.Background(), s, db.AppFilter{}, w, out))
+	assert.Len(t, w.Files(), 10)
+	assert.Contains(t, out.String(), "exported 10 rows to 10 files")
+}
+
+func TestExport_ShouldReturnErrorOfStream_Error(t *testing.T) {
+	dir := t.TempDir()
+	s := &mock_streamer{apps: storedApps(1), err: errors.New("connection lost")}
+	w, err := db.OpenWriter("parquet", config.FileConfig{Path: filepath.Join(dir, "apps.parquet")})
+	assert.NoError(t, err)
+
+	assert.EqualError(t, export(context.Background(), s, db.AppFilter{}, w, &bytes.Buffer{}), "connection lost")
+}
+
+func TestExportCommand_ShouldValidateFlags_Error(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	assert.EqualError(t, Export([]string{}, out), "export path is not set, use -out")
+	assert.EqualError(t, Export([]string{"-out", "apps.xml"}, out), "unknown export format xml")
+	assert.Error(t, Export([]string{"-out", "apps.csv", "-from", "yesterday"}, out))
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Migrate applies database migrations or prints their status
+//	nani migrate [-config config/dev.yml] [-dry-run] [up|status]
+func Migrate(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	configPath := flags.String("config", "config/dev.yml", "Application config file")
+	dryRun := flags.Bool("dry-run", false, "Print pending migrations without applying them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	conf := config.New(*configPath)
+	url, err := db.ConnectionUrl(conf.Database)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Connect(url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return migrate(context.Background(), db.NewMigrator(conn), flags.Arg(0), *dryRun, out)
+}
+
+// migrate run migrate subcommand with given migrator
+func migrate(ctx context.Context, m *db.Migrator, cmd string, dryRun bool, out io.Writer) error {
+	switch cmd {
+	case "", "up":
+		migrations, err := m.Up(ctx, dryRun)
+		for _, v := range migrations {
+			if dryRun {
+				fmt.Fprintf(out, "-- %04d %s\n%s;\n\n", v.Version, v.Name, strings.Join(v.Up, ";\n"))
+			} else {
+				fmt.Fprintf(out, "applied %04d %s\n", v.Version, v.Name)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if len(migrations) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range status {
+			applied := "pending"
+			if v.Applied {
+				applied = "applied " + v.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d %-30s %s\n", v.Version, v.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %s", cmd)
+	}
+
+	return nil
+}
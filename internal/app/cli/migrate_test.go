@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"Nani/internal/app/db"
+	"bytes"
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func migrator(t *testing.T, applied ...int) (*db.Migrator, sqlmock.Sqlmock) {
+	d, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	mock.ExpectQuery("^exists table schema_migrations$").
+		WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow(1))
+	rows := sqlmock.NewRows([]string{"version", "applied"})
+	for _, v := range applied {
+		rows.AddRow(v, time.Date(2020, 10, 20, 10, 0, 0, 0, time.UTC))
+	}
+	mock.ExpectQuery("^select version, applied from schema_migrations$").WillReturnRows(rows)
+
+	return db.NewMigrator(d,
+		db.Migration{Version: 1, Name: "first", Up: []string{"create table first"}},
+		db.Migration{Version: 2, Name: "second", Up: []string{"create table second"}},
+	), mock
+}
+
+func TestMigrate_ShouldPrintStatusOfMigrations_NoError(t *testing.T) {
+	m, mock := migrator(t, 1)
+	out := &bytes.Buffer{}
+
+	assert.NoError(t, migrate(context.Background(), m, "status", false, out))
+	assert.Contains(t, out.String(), "0001 first")
+	assert.Contains(t, out.String(), "applied 2020-10-20 10:00:00")
+	assert.Contains(t, out.String(), "0002 second")
+	assert.Contains(t, out.String(), "pending")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrate_ShouldPrintPendingSqlInDryRun_NoError(t *testing.T) {
+	m, mock := migrator(t, 1)
+	out := &bytes.Buffer{}
+
+	assert.NoError(t, migrate(context.Background(), m, "up", true, out))
+	assert.Equal(t, "-- 0002 second\ncreate table second;\n\n", out.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrate_ShouldPrintUpToDateIfNothingToApply_NoError(t *testing.T) {
+	m, mock := migrator(t, 1, 2)
+	out := &bytes.Buffer{}
+
+	assert.NoError(t, migrate(context.Background(), m, "", false, out))
+	assert.Equal(t, "schema is up to date\n", out.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrate_ShouldReturnErrorCozUnknownCommand_Error(t *testing.T) {
+	m, _ := migrator(t)
+
+	assert.Error(t, migrate(context.Background(), m, "down", false, &bytes.Buffer{}))
+}
+
+func TestRun_ShouldReturnErrorCozUnknownCommand_Error(t *testing.T) {
+	assert.EqualError(t, Run("unknown", nil, &bytes.Buffer{}), "unknown command unknown")
+}
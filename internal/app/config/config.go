@@ -6,24 +6,128 @@ import (
 	"gopkg.in/yaml.v2"
 	"log"
 	"os"
+	"time"
 )
 
+// File sink config for jsonl and csv database drivers
+type FileConfig struct {
+	Path     string        `yaml:"path"`
+	MaxSize  int64         `yaml:"max_size"`
+	Interval time.Duration `yaml:"interval"`
+	Gzip     bool          `yaml:"gzip"`
+}
+
 type DBConfig struct {
-	Database   string `yaml:"name"`
-	User       string `yaml:"user"`
-	Password   string `yaml:"password"`
-	Address    string `yaml:"address"`
-	Port       string `yaml:"port"`
-	Schema     string `yaml:"schema"`
+	Driver     string     `yaml:"driver"`
+	Database   string     `yaml:"name"`
+	User       string     `yaml:"user"`
+	Password   string     `yaml:"password"`
+	Address    string     `yaml:"address"`
+	Port       string     `yaml:"port"`
+	File       FileConfig `yaml:"file"`
 	Connection *sql.DB
 }
 
+// Secondary sink which receives copy of every stored batch
+type SinkConfig struct {
+	Database DBConfig `yaml:",inline"`
+	Buffer   int      `yaml:"buffer"`
+	Retries  int      `yaml:"retries"`
+}
+
+// Webhook endpoint for watchlist notifications
+type WebhookConfig struct {
+	Url    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+// Watchlist of bundles and developers which changes should be notified
+type WatchConfig struct {
+	Bundles    []string        `yaml:"bundles,flow"`
+	Developers []string        `yaml:"developers,flow"`
+	Webhooks   []WebhookConfig `yaml:"webhooks"`
+	Retries    int             `yaml:"retries"`
+	RetryEvery time.Duration   `yaml:"retry_every"`
+	// Delivery which failed after so many requests is moved to dead deliveries
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// Redis server of the shared cache
+type RedisConfig struct {
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	// Prefix of all keys, so several caches can share one database
+	Prefix string `yaml:"prefix"`
+}
+
+// Rule of keyword filter. Rule matches keyword if all its set conditions
+// match. Regex matches keyword as api returned it, exact words and length
+// in characters match keyword in lower case without punctuation
+type KeywordRule struct {
+	// Name of rule in metrics
+	Name   string   `yaml:"name"`
+	Exact  []string `yaml:"exact,flow"`
+	Regex  string   `yaml:"regex"`
+	MinLen int      `yaml:"min_len"`
+	MaxLen int      `yaml:"max_len"`
+}
+
+// Workers which expand keywords to developers and their applications
+type KeywordsConfig struct {
+	// Number of parallel keyword workers
+	Workers int `yaml:"workers"`
+	// How many keywords worker leases at once
+	Lease int `yaml:"lease"`
+	// How long leased keyword is hidden from other workers
+	Visibility time.Duration `yaml:"visibility"`
+	// How many times keyword may fail before it is moved to the failed set
+	MaxAttempts int `yaml:"max_attempts"`
+	// Keyword is queued only if it matches one of allow rules, empty list allows all
+	Allow []KeywordRule `yaml:"allow"`
+	// Keyword is not queued if it matches one of deny rules
+	Deny []KeywordRule `yaml:"deny"`
+	// Extractor of keywords: api (default), local or fallback which
+	// uses local extractor when api fails
+	Extractor string `yaml:"extractor"`
+	// Keywords are queued up to this depth. Seed apps have depth 0, their
+	// keywords and apps found by them have depth 1 and so on. Default 1
+	// queues only keywords of seed apps
+	MaxDepth int `yaml:"max_depth"`
+}
+
+// Cache of executor results
+type CacheConfig struct {
+	// Storage of cache file (default), redis or bolt
+	Backend string `yaml:"backend"`
+	// Redis server of redis backend
+	Redis RedisConfig `yaml:"redis"`
+	// How long developer applications are cached
+	DevAppsTTL time.Duration `yaml:"dev_apps_ttl"`
+	// How long keyword is not requested from flow again
+	FlowTTL time.Duration `yaml:"flow_ttl"`
+	// File of cache snapshot or bolt database
+	Path string `yaml:"path"`
+	// How often cache is saved to the file, 0 saves only on exit
+	Autosave time.Duration `yaml:"autosave"`
+	// How many last snapshots are kept on disk
+	Keep int `yaml:"keep"`
+	// Append every change to the journal, autosave compacts the journal
+	Journal bool `yaml:"journal"`
+	// Namespace of job keys, so several jobs can share one cache
+	Namespace string `yaml:"namespace"`
+}
+
 //Application config
 type Config struct {
-	ApiUrl    string   `yaml:"api_url"`
-	Hl        string   `yaml:"hl"`
-	Gl        string   `yaml:"gl"`
-	Database  DBConfig `yaml:"database"`
+	ApiUrl    string         `yaml:"api_url"`
+	Hl        string         `yaml:"hl"`
+	Gl        string         `yaml:"gl"`
+	Database  DBConfig       `yaml:"database"`
+	Sinks     []SinkConfig   `yaml:"sinks"`
+	Watch     WatchConfig    `yaml:"watch"`
+	Cache     CacheConfig    `yaml:"cache"`
+	Keywords  KeywordsConfig `yaml:"keywords"`
 	Key       string
 	KeysCount int
 	AppsCount int
@@ -80,6 +184,10 @@ func New(p ...string) Config {
 	if ok {
 		config.Database.User = v
 	}
+	v, ok = envs["redis_pass"]
+	if ok {
+		config.Cache.Redis.Password = v
+	}
 
 	return config
 }
@@ -12,7 +12,6 @@ func TestNew_ShouldCreateConfigInstanceWithAllFieldsFromConfigFile_NoError(t *te
 	assert.NotEmpty(t, c.ApiUrl)
 	assert.NotEmpty(t, c.Gl)
 	assert.NotEmpty(t, c.Hl)
-	assert.NotEmpty(t, c.Database.Schema)
 	assert.NotEmpty(t, c.Database.Address)
 	assert.NotEmpty(t, c.Database.Database)
 	assert.NotEmpty(t, c.Database.Port)
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"Nani/internal/app/inhuman"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ChangeRepository stores field level changes between application snapshots
+type ChangeRepository interface {
+	Snapshots(ctx context.Context, bundles []string) (map[string]*inhuman.App, error)
+	InsertChanges(ctx context.Context, changes []inhuman.Change) error
+}
+
+// Snapshots return last stored snapshot of tracked fields and developer id
+// for each given bundle
+// @params
+//	ctx: context.Context
+//	bundles: []string (applications bundles)
+// @return
+//	map[string]*inhuman.App (snapshots by bundle), error
+func (c *ClickhouseDatabase) Snapshots(ctx context.Context, bundles []string) (map[string]*inhuman.App, error) {
+	snapshots := make(map[string]*inhuman.App)
+	if len(bundles) == 0 {
+		return snapshots, nil
+	}
+
+	args := make([]interface{}, len(bundles))
+	for i, v := range bundles {
+		args[i] = v
+	}
+	rows, err := c.connection.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			"select bundle, argMax(version, datetime), argMax(rating, datetime), argMax(installs, datetime), "+
+				"argMax(price, datetime), argMax(description, datetime), argMax(developerId, datetime) "+
+				"from apps where bundle in (%s) group by bundle",
+			placeholders(len(bundles)),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		app := &inhuman.App{}
+		if err := rows.Scan(&app.Bundle, &app.Version, &app.Rating, &app.Installs, &app.Price, &app.Description, &app.DeveloperId); err != nil {
+			return nil, err
+		}
+		snapshots[app.Bundle] = app
+	}
+
+	return snapshots, rows.Err()
+}
+
+// InsertChanges save changes to app_changes table
+// @params
+//	ctx: context.Context
+//	changes: []inhuman.Change (detected changes)
+// @return
+//	error
+func (c *ClickhouseDatabase) InsertChanges(ctx context.Context, changes []inhuman.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	t, err := c.connection.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := t.PrepareContext(ctx, ChangesTable.Insert())
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, v := range changes {
+		_, err := stmt.ExecContext(ctx, ChangesTable.Args(v)...)
+		if err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	return t.Commit()
+}
+
+// placeholders return n comma separated query placeholders
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
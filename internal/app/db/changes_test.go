@@ -0,0 +1,91 @@
+package db_test
+
+import (
+	config2 "Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"Nani/internal/app/inhuman"
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSnapshotsMock_ShouldReturnLastSnapshotsByBundle_NoError(t *testing.T) {
+	ctx := context.Background()
+	d, mock := MockDb()
+	defer d.Close()
+
+	rows := sqlmock.NewRows([]string{"bundle", "version", "rating", "installs", "price", "description", "developerId"}).
+		AddRow("com.ky", "1.0", "4.3", "1000+", "", "hi", "dev1").
+		AddRow("com.ky2", "2.0", "4.1", "10+", "99", "hello", "dev2")
+	mock.ExpectQuery("^select bundle, argMax\\(version, datetime\\).+ from apps where bundle in \\(\\?, \\?\\) group by bundle$").
+		WithArgs("com.ky", "com.ky2").
+		WillReturnRows(rows)
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	snapshots, err := repo.Snapshots(ctx, []string{"com.ky", "com.ky2"})
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, "1.0", snapshots["com.ky"].Version)
+	assert.Equal(t, "99", snapshots["com.ky2"].Price)
+	assert.Equal(t, "dev2", snapshots["com.ky2"].DeveloperId)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSnapshotsMock_ShouldReturnEmptyMapWithoutQuery_NoError(t *testing.T) {
+	d, mock := MockDb()
+	defer d.Close()
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	snapshots, err := repo.Snapshots(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertChangesMock_ShouldInsertAllChanges_NoError(t *testing.T) {
+	ctx := context.Background()
+	d, mock := MockDb()
+	defer d.Close()
+
+	at := time.Now()
+	changes := []inhuman.Change{
+		{Bundle: "com.ky", Field: "version", Old: "1.0", New: "1.1", Detected: at},
+		{Bundle: "com.ky", Field: "price", Old: "", New: "99", Detected: at},
+	}
+	mock.ExpectBegin()
+	stmt := mock.ExpectPrepare("^insert into app_changes \\(bundle, field, oldValue, newValue, detected\\) values \\(\\?, \\?, \\?, \\?, \\?\\)$")
+	for _, c := range changes {
+		stmt.ExpectExec().
+			WithArgs(c.Bundle, c.Field, c.Old, c.New, c.Detected).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	assert.NoError(t, repo.InsertChanges(ctx, changes))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertChangesMock_ShouldRollbackCozExecFailed_Error(t *testing.T) {
+	ctx := context.Background()
+	d, mock := MockDb()
+	defer d.Close()
+
+	change := inhuman.Change{Bundle: "com.ky", Field: "version", Old: "1.0", New: "1.1", Detected: time.Now()}
+	mock.ExpectBegin()
+	mock.ExpectPrepare("^insert into app_changes").
+		ExpectExec().
+		WillReturnError(errors.New("exec error"))
+	mock.ExpectRollback()
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	assert.Error(t, repo.InsertChanges(ctx, []inhuman.Change{change}))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"Nani/internal/app/config"
+	"Nani/internal/app/file"
+	"Nani/internal/app/inhuman"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CsvDatabase writes applications to the csv files. Each file starts
+// with the header, array fields are stored as json arrays
+type CsvDatabase struct {
+	writer *file.RotateWriter
+	mutex  sync.Mutex
+}
+
+func (c *CsvDatabase) Insert(ctx context.Context, app *inhuman.App) error {
+	return c.InsertBatch(ctx, []*inhuman.App{app})
+}
+
+func (c *CsvDatabase) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	return c.WriteStored(stamp(apps, time.Now()))
+}
+
+// WriteStored write applications with the time they were stored
+func (c *CsvDatabase) WriteStored(apps []StoredApp) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, v := range apps {
+		// Each record is written separately, so it is never split by rotation
+		w := csv.NewWriter(c.writer)
+		if err := w.Write(append(csvRecord(v.App), v.Datetime.Format(datetimeFormat))); err != nil {
+			return err
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+
+	return c.writer.Flush()
+}
+
+// Files return names of all written files
+func (c *CsvDatabase) Files() []string {
+	return c.writer.Files()
+}
+
+// Close current file
+func (c *CsvDatabase) Close() error {
+	return c.writer.Close()
+}
+
+// csvHeader write column names to the new file
+func csvHeader(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := append(strings.Split(AppsTable.Names(), ", "), "datetime")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// csvRecord return application fields in the order of AppsTable columns,
+// arrays are encoded as json
+func csvRecord(app *inhuman.App) []string {
+	values := AppsTable.Values(app)
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch value := v.(type) {
+		case []string:
+			record[i] = jsonArray(value)
+		default:
+			record[i] = fmt.Sprint(value)
+		}
+	}
+
+	return record
+}
+
+func jsonArray(s []string) string {
+	if s == nil {
+		s = []string{}
+	}
+	b, _ := json.Marshal(s)
+
+	return string(b)
+}
+
+// Create new instance of CsvDatabase. Returns error if path is empty
+func NewCsv(config config.FileConfig) (*CsvDatabase, error) {
+	if config.Path == "" {
+		return nil, errors.New("empty csv file path")
+	}
+
+	w := file.NewRotateWriter(config.Path, config.MaxSize, config.Interval, config.Gzip)
+	w.OnOpen = csvHeader
+
+	return &CsvDatabase{
+		writer: w,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package db_test
+
+import (
+	config2 "Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"Nani/internal/app/inhuman"
+	"context"
+	"encoding/csv"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readCsv(t *testing.T, name string) [][]string {
+	f, err := os.Open(name)
+	assert.NoError(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	assert.NoError(t, err)
+
+	return records
+}
+
+func TestCsvInsertBatch_ShouldWriteEscapedRecordsWithHeader_NoError(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := db.NewCsv(config2.FileConfig{Path: filepath.Join(dir, "apps.csv")})
+	assert.NoError(t, err)
+	app := App()
+	app.Title = "title, with \"comma\""
+	app.Description = "multi\nline"
+
+	assert.NoError(t, repo.InsertBatch(context.Background(), []*inhuman.App{app, App()}))
+	assert.NoError(t, repo.Close())
+
+	files, _ := filepath.Glob(filepath.Join(dir, "apps-*.csv"))
+	assert.Len(t, files, 1)
+	records := readCsv(t, files[0])
+	assert.Len(t, records, 3)
+	assert.Equal(t, "bundle", records[0][0])
+	assert.Equal(t, "datetime", records[0][len(records[0])-1])
+	assert.Equal(t, len(records[0]), len(records[1]))
+	assert.Equal(t, app.Title, records[1][3])
+	assert.Equal(t, app.Description, records[1][11])
+	assert.Equal(t, `["1","2","3"]`, records[1][7])
+}
+
+func TestCsvInsertBatch_ShouldWriteHeaderToEachRotatedFile_NoError(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := db.NewCsv(config2.FileConfig{Path: filepath.Join(dir, "apps.csv"), MaxSize: 1})
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.InsertBatch(context.Background(), []*inhuman.App{App(), App()}))
+	assert.NoError(t, repo.Close())
+
+	files, _ := filepath.Glob(filepath.Join(dir, "apps-*.csv"))
+	assert.Len(t, files, 2)
+	for _, f := range files {
+		records := readCsv(t, f)
+		assert.Len(t, records, 2)
+		assert.Equal(t, "bundle", records[0][0])
+		assert.Equal(t, "com.ky", records[1][0])
+	}
+}
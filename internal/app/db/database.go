@@ -6,9 +6,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"github.com/mailru/go-clickhouse"
+	"sort"
 )
 
+const datetimeFormat = "2006-01-02 15:04:05"
+
 type AppRepository interface {
 	Insert(ctx context.Context, app *inhuman.App) error
 	InsertBatch(ctx context.Context, apps[] *inhuman.App) error
@@ -19,34 +21,7 @@ type ClickhouseDatabase struct {
 }
 
 func (c *ClickhouseDatabase) Insert(ctx context.Context, app *inhuman.App) error {
-	_, err := c.connection.ExecContext(
-		ctx,
-		fmt.Sprintf("insert into apps (%s) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", app.Fields()),
-		app.Bundle,
-		app.DeveloperId,
-		app.Developer,
-		app.Title,
-		app.Categories,
-		app.Price,
-		app.Picture,
-		clickhouse.Array(app.Screenshots),
-		app.Rating,
-		app.ReviewCount,
-		clickhouse.Array(app.RatingHistogram),
-		app.Description,
-		app.ShortDescription,
-		app.RecentChanges,
-		app.ReleaseDate,
-		app.LastUpdateDate,
-		app.AppSize,
-		app.Installs,
-		app.Version,
-		app.AndroidVersion,
-		app.ContentRating,
-		clickhouse.Array([]string{ app.DeveloperContacts.Email }),
-		clickhouse.Array([]string{ app.DeveloperContacts.Contacts }),
-		app.PrivacyPolicy,
-	)
+	_, err := c.connection.ExecContext(ctx, AppsTable.Insert(), AppsTable.Args(app)...)
 
 	if err != nil {
 		return err
@@ -55,59 +30,95 @@ func (c *ClickhouseDatabase) Insert(ctx context.Context, app *inhuman.App) error
 	return nil
 }
 
+// InsertBatch insert applications in one transaction. Rows which do not
+// match the table are not sent. Clickhouse driver only buffers rows until
+// commit, so if commit fails the batch is bisected and every part is inserted
+// in own transaction until the bad rows are found. All rows which were not
+// inserted are returned as BatchError
 func (c *ClickhouseDatabase) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
 	if len(apps) == 0 {
 		return nil
 	}
 
+	failed := make([]RowError, 0)
+	rows := make([]row, 0, len(apps))
+	for i, v := range apps {
+		args := AppsTable.Args(v)
+		if err := AppsTable.Validate(args); err != nil {
+			failed = append(failed, RowError{Index: i, App: v, Err: err})
+			continue
+		}
+		rows = append(rows, row{index: i, app: v, args: args})
+	}
+
+	failed = append(failed, c.insertRows(ctx, rows)...)
+	if len(failed) > 0 {
+		sort.Slice(failed, func(i, j int) bool {
+			return failed[i].Index < failed[j].Index
+		})
+		return &BatchError{Rows: failed}
+	}
+
+	return nil
+}
+
+// row is validated row of the batch
+type row struct {
+	index int
+	app   *inhuman.App
+	args  []interface{}
+}
+
+// insertRows insert rows in one transaction and bisect them if commit failed
+func (c *ClickhouseDatabase) insertRows(ctx context.Context, rows []row) []RowError {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	failed, err := c.commitRows(ctx, rows)
+	if err == nil {
+		return failed
+	}
+	if len(rows) == 1 || ctx.Err() != nil {
+		return rowErrors(rows, err)
+	}
+
+	half := len(rows) / 2
+	return append(c.insertRows(ctx, rows[:half]), c.insertRows(ctx, rows[half:])...)
+}
+
+// commitRows insert rows in one transaction. Rows which were not inserted
+// are returned and the rest is committed. Error is returned only if commit
+// failed, then none of rows was inserted
+func (c *ClickhouseDatabase) commitRows(ctx context.Context, rows []row) ([]RowError, error) {
 	t, err := c.connection.Begin()
 	if err != nil {
-		return err
+		return rowErrors(rows, err), nil
 	}
-	stmt, err := t.PrepareContext(
-		ctx,
-		fmt.Sprintf("insert into apps (%s) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", apps[0].Fields()),
-	)
+	stmt, err := t.PrepareContext(ctx, AppsTable.Insert())
 	if err != nil {
-		return err
+		t.Rollback()
+		return rowErrors(rows, err), nil
 	}
-	for _, v := range apps {
-		_, err := stmt.ExecContext(ctx,
-			v.Bundle,
-			v.DeveloperId,
-			v.Developer,
-			v.Title,
-			v.Categories,
-			v.Price,
-			v.Picture,
-			clickhouse.Array(v.Screenshots),
-			v.Rating,
-			v.ReviewCount,
-			clickhouse.Array(v.RatingHistogram),
-			v.Description,
-			v.ShortDescription,
-			v.RecentChanges,
-			v.ReleaseDate,
-			v.LastUpdateDate,
-			v.AppSize,
-			v.Installs,
-			v.Version,
-			v.AndroidVersion,
-			v.ContentRating,
-			clickhouse.Array([]string{ v.DeveloperContacts.Email }),
-			clickhouse.Array([]string{ v.DeveloperContacts.Contacts }),
-			v.PrivacyPolicy,
-		)
+	defer stmt.Close()
+
+	failed := make([]RowError, 0)
+	for _, v := range rows {
+		_, err := stmt.ExecContext(ctx, v.args...)
 		if err != nil {
-			return err
+			failed = append(failed, RowError{Index: v.index, App: v.app, Err: err})
 		}
 	}
 
+	if len(failed) == len(rows) {
+		t.Rollback()
+		return failed, nil
+	}
 	if err := t.Commit(); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return failed, nil
 }
 
 func New(config config.DBConfig) *ClickhouseDatabase {
@@ -122,16 +133,81 @@ func New(config config.DBConfig) *ClickhouseDatabase {
 		}
 	}
 
-	if config.Schema != "" {
-		err := InitSchema(config.Connection, config.Schema)
+	c := &ClickhouseDatabase{
+		connection: config.Connection,
+	}
+
+	return c
+}
+
+// Open create the repository for configured database driver.
+// Supported drivers are clickhouse (default), jsonl, csv and parquet
+// @params
+//	config: config.DBConfig
+// @return
+//	AppRepository
+//	error (unknown driver, invalid file path or connection error)
+func Open(config config.DBConfig) (AppRepository, error) {
+	switch config.Driver {
+	case "", "clickhouse":
+		if config.Connection == nil {
+			url, err := ConnectionUrl(config)
+			if err != nil {
+				return nil, err
+			}
+			if config.Connection, err = Connect(url); err != nil {
+				return nil, err
+			}
+		}
+		return New(config), nil
+	case "jsonl", "csv", "parquet":
+		w, err := OpenWriter(config.Driver, config.File)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+		return w, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %s", config.Driver)
 	}
+}
 
-	c := &ClickhouseDatabase{
-		connection: config.Connection,
+// RowError is error of the single row of the batch
+type RowError struct {
+	Index int
+	App   *inhuman.App
+	Err   error
+}
+
+// BatchError contains all rows of the batch which were not inserted
+type BatchError struct {
+	Rows []RowError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Rows) == 0 {
+		return "batch insert failed"
 	}
+	first := e.Rows[0]
 
-	return c
+	return fmt.Sprintf("%d rows of batch failed, row %d (%s): %s", len(e.Rows), first.Index, first.App.Bundle, first.Err)
+}
+
+// Apps return applications which were not inserted, so they can be retried
+func (e *BatchError) Apps() []*inhuman.App {
+	apps := make([]*inhuman.App, len(e.Rows))
+	for i, v := range e.Rows {
+		apps[i] = v.App
+	}
+
+	return apps
+}
+
+// rowErrors return errors of rows which failed with the same error
+func rowErrors(rows []row, err error) []RowError {
+	errs := make([]RowError, len(rows))
+	for i, v := range rows {
+		errs[i] = RowError{Index: v.index, App: v.app, Err: err}
+	}
+
+	return errs
 }
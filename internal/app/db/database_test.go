@@ -6,6 +6,7 @@ import (
 	"Nani/internal/app/inhuman"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/mailru/go-clickhouse"
@@ -37,7 +38,7 @@ func App() *inhuman.App {
 		Version:           "1.3.23",
 		AndroidVersion:    "4.3+",
 		ContentRating:     "12+",
-		DeveloperContacts: inhuman.DeveloperContacts{Email: "email", Contacts: "conatasdsd"},
+		DeveloperContacts: inhuman.DeveloperContacts{Email: "dev@example.com", Contacts: "conatasdsd", Website: "https://example.com"},
 		PrivacyPolicy:     "http://localhost/hello",
 	}
 }
@@ -56,13 +57,13 @@ func Db() (*sql.DB, func()) {
 		Database: "default",
 		Address:  "192.168.99.100",
 		Port:     "8123",
-		Schema:   "",
 	}
 	url, _ := db.ConnectionUrl(config)
 	driver, _ := db.Connect(url)
-	db.InitSchema(driver, "../../../config/schema.sql")
+	db.NewMigrator(driver).Up(context.Background(), false)
 	return driver, func() {
 		driver.Exec("drop table apps")
+		driver.Exec("drop table schema_migrations")
 	}
 }
 
@@ -72,7 +73,7 @@ func TestInsertMock_ShouldInsertNewRecordToDb_NoError(t *testing.T) {
 	defer d.Close()
 
 	app := App()
-	str := fmt.Sprintf("^insert into apps \\(.+\\) values \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$")
+	str := fmt.Sprintf("^insert into apps \\(.+\\) values \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$")
 	mock.ExpectExec(str).
 		WithArgs(
 			app.Bundle,
@@ -96,8 +97,12 @@ func TestInsertMock_ShouldInsertNewRecordToDb_NoError(t *testing.T) {
 			app.Version,
 			app.AndroidVersion,
 			app.ContentRating,
-			clickhouse.Array([]string{app.DeveloperContacts.Email}),
-			clickhouse.Array([]string{app.DeveloperContacts.Contacts}),
+			app.DeveloperContacts.Email,
+			app.DeveloperContacts.Website,
+			app.DeveloperContacts.Address,
+			app.DeveloperContacts.Phone,
+			app.DeveloperContacts.Domain,
+			app.DeveloperContacts.Contacts,
 			app.PrivacyPolicy).
 		WillReturnResult(sqlmock.NewErrorResult(nil))
 
@@ -117,7 +122,7 @@ func TestInsertBatchMock_ShouldInsertNewRecords_NoError(t *testing.T) {
 
 	apps := []*inhuman.App { App(), App(), App() }
 	mock.ExpectBegin()
-	str := fmt.Sprintf("^insert into apps \\(.+\\) values \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$")
+	str := fmt.Sprintf("^insert into apps \\(.+\\) values \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$")
 	stmt := mock.ExpectPrepare(str)
 	for _, app := range apps {
 		stmt.ExpectExec().
@@ -143,8 +148,12 @@ func TestInsertBatchMock_ShouldInsertNewRecords_NoError(t *testing.T) {
 				app.Version,
 				app.AndroidVersion,
 				app.ContentRating,
-				clickhouse.Array([]string{app.DeveloperContacts.Email}),
-				clickhouse.Array([]string{app.DeveloperContacts.Contacts}),
+				app.DeveloperContacts.Email,
+				app.DeveloperContacts.Website,
+				app.DeveloperContacts.Address,
+				app.DeveloperContacts.Phone,
+				app.DeveloperContacts.Domain,
+				app.DeveloperContacts.Contacts,
 				app.PrivacyPolicy).
 			WillReturnResult(sqlmock.NewErrorResult(nil))
 	}
@@ -165,7 +174,7 @@ func TestInsertBatchMock_ShouldRiseErrorCozDbConnectionLost_Error(t *testing.T)
 
 	apps := []*inhuman.App { App(), App(), App() }
 	mock.ExpectBegin()
-	str := fmt.Sprintf("^insert into apps \\(.+\\) values \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$")
+	str := fmt.Sprintf("^insert into apps \\(.+\\) values \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$")
 	stmt := mock.ExpectPrepare(str)
 	for _, app := range apps {
 		stmt.ExpectExec().
@@ -191,8 +200,12 @@ func TestInsertBatchMock_ShouldRiseErrorCozDbConnectionLost_Error(t *testing.T)
 				app.Version,
 				app.AndroidVersion,
 				app.ContentRating,
-				clickhouse.Array([]string{app.DeveloperContacts.Email}),
-				clickhouse.Array([]string{app.DeveloperContacts.Contacts}),
+				app.DeveloperContacts.Email,
+				app.DeveloperContacts.Website,
+				app.DeveloperContacts.Address,
+				app.DeveloperContacts.Phone,
+				app.DeveloperContacts.Domain,
+				app.DeveloperContacts.Contacts,
 				app.PrivacyPolicy).
 			WillReturnResult(sqlmock.NewErrorResult(nil))
 	}
@@ -267,3 +280,106 @@ func TestInsertBatch_ShouldInsertSomeItems_NoError(t *testing.T) {
 }
 
 
+
+func TestInsertBatchMock_ShouldCommitGoodRowsAndReturnFailedRows_Error(t *testing.T) {
+	ctx := context.Background()
+	d, mock := MockDb()
+	defer d.Close()
+
+	apps := []*inhuman.App{App(), App(), App()}
+	apps[1].Bundle = "com.broken"
+	mock.ExpectBegin()
+	stmt := mock.ExpectPrepare("^insert into apps")
+	stmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	stmt.ExpectExec().WillReturnError(fmt.Errorf("bad row"))
+	stmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rep := db.New(config2.DBConfig{Connection: d})
+	err := rep.InsertBatch(ctx, apps)
+	assert.Error(t, err)
+
+	var batch *db.BatchError
+	assert.True(t, errors.As(err, &batch))
+	assert.Len(t, batch.Rows, 1)
+	assert.Equal(t, 1, batch.Rows[0].Index)
+	assert.Equal(t, []*inhuman.App{apps[1]}, batch.Apps())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertBatchMock_ShouldRollbackIfPrepareFailed_Error(t *testing.T) {
+	ctx := context.Background()
+	d, mock := MockDb()
+	defer d.Close()
+
+	apps := []*inhuman.App{App(), App()}
+	mock.ExpectBegin()
+	mock.ExpectPrepare("^insert into apps").WillReturnError(fmt.Errorf("prepare failed"))
+	mock.ExpectRollback()
+
+	rep := db.New(config2.DBConfig{Connection: d})
+	err := rep.InsertBatch(ctx, apps)
+
+	var batch *db.BatchError
+	assert.True(t, errors.As(err, &batch))
+	assert.Len(t, batch.Rows, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertBatchMock_ShouldRollbackIfAllRowsFailed_Error(t *testing.T) {
+	ctx := context.Background()
+	d, mock := MockDb()
+	defer d.Close()
+
+	apps := []*inhuman.App{App(), App()}
+	mock.ExpectBegin()
+	stmt := mock.ExpectPrepare("^insert into apps")
+	stmt.ExpectExec().WillReturnError(fmt.Errorf("bad row"))
+	stmt.ExpectExec().WillReturnError(fmt.Errorf("bad row"))
+	mock.ExpectRollback()
+
+	rep := db.New(config2.DBConfig{Connection: d})
+	err := rep.InsertBatch(ctx, apps)
+
+	var batch *db.BatchError
+	assert.True(t, errors.As(err, &batch))
+	assert.Len(t, batch.Rows, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertBatchMock_ShouldBisectBatchIfCommitFailed_Error(t *testing.T) {
+	ctx := context.Background()
+	d, mock := MockDb()
+	defer d.Close()
+
+	apps := []*inhuman.App{App(), App(), App(), App()}
+	apps[2].Bundle = "com.broken"
+	commit := func(n int, err error) {
+		mock.ExpectBegin()
+		stmt := mock.ExpectPrepare("^insert into apps")
+		for i := 0; i < n; i++ {
+			stmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		if err != nil {
+			mock.ExpectCommit().WillReturnError(err)
+		} else {
+			mock.ExpectCommit()
+		}
+	}
+	// whole batch, then halves, then the half with broken row is split
+	commit(4, fmt.Errorf("cannot parse row"))
+	commit(2, nil)
+	commit(2, fmt.Errorf("cannot parse row"))
+	commit(1, fmt.Errorf("cannot parse row"))
+	commit(1, nil)
+
+	rep := db.New(config2.DBConfig{Connection: d})
+	err := rep.InsertBatch(ctx, apps)
+
+	var batch *db.BatchError
+	assert.True(t, errors.As(err, &batch))
+	assert.Len(t, batch.Rows, 1)
+	assert.Equal(t, 2, batch.Rows[0].Index)
+	assert.Equal(t, []*inhuman.App{apps[2]}, batch.Apps())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
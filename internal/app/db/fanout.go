@@ -0,0 +1,208 @@
+package db
+
+import (
+	"Nani/internal/app/inhuman"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// FanOut writes every batch to the primary repository and rows accepted by it
+// to all secondary sinks. Each secondary sink has its own buffer, retries and
+// error accounting, so slow or failing sink never blocks the primary one
+type FanOut struct {
+	Backoff time.Duration
+	primary AppRepository
+	sinks   []*sink
+}
+
+// SinkStats is error accounting of the secondary sink
+type SinkStats struct {
+	Name      string `json:"name"`
+	Written   int    `json:"written"`
+	Failed    int    `json:"failed"`
+	Dropped   int    `json:"dropped"`
+	Retries   int    `json:"retries"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+type sink struct {
+	repository AppRepository
+	batches    chan []*inhuman.App
+	retries    int
+	stats      SinkStats
+	mutex      sync.Mutex
+	done       chan struct{}
+}
+
+func (f *FanOut) Insert(ctx context.Context, app *inhuman.App) error {
+	return f.InsertBatch(ctx, []*inhuman.App{app})
+}
+
+// InsertBatch write apps to the primary repository and then pass copy of
+// stored apps to each secondary sink without waiting. Rows rejected by the
+// primary repository are not passed, so sinks keep the same apps as primary
+func (f *FanOut) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	err := f.primary.InsertBatch(ctx, apps)
+	f.forward(accepted(apps, err))
+
+	return err
+}
+
+// accepted return apps which are stored by the primary repository
+// @params
+//	apps: []*inhuman.App (batch passed to the primary repository)
+//	err: error (error of the primary repository)
+// @return
+//	[]*inhuman.App (stored apps)
+func accepted(apps []*inhuman.App, err error) []*inhuman.App {
+	if err == nil {
+		return apps
+	}
+
+	var batch *BatchError
+	if !errors.As(err, &batch) {
+		return nil
+	}
+
+	failed := make(map[*inhuman.App]struct{})
+	for _, v := range batch.Apps() {
+		failed[v] = struct{}{}
+	}
+
+	stored := make([]*inhuman.App, 0, len(apps))
+	for _, v := range apps {
+		if _, ok := failed[v]; !ok {
+			stored = append(stored, v)
+		}
+	}
+
+	return stored
+}
+
+// forward pass copy of apps to each secondary sink, if buffer of the sink
+// is full apps are dropped
+func (f *FanOut) forward(apps []*inhuman.App) {
+	if len(apps) == 0 {
+		return
+	}
+
+	for _, s := range f.sinks {
+		batch := make([]*inhuman.App, len(apps))
+		copy(batch, apps)
+		select {
+		case s.batches <- batch:
+		default:
+			s.mutex.Lock()
+			s.stats.Dropped += len(batch)
+			s.stats.LastError = "sink buffer is full"
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// AddSink add secondary repository
+// @params
+//	name: string (sink name for stats)
+//	repository: AppRepository (secondary repository)
+//	buffer: int (count of batches waiting for write, if buffer is full new batches are dropped)
+//	retries: int (count of attempts to write batch)
+func (f *FanOut) AddSink(name string, repository AppRepository, buffer, retries int) {
+	if buffer <= 0 {
+		buffer = 100
+	}
+	if retries <= 0 {
+		retries = 3
+	}
+
+	s := &sink{
+		repository: repository,
+		batches:    make(chan []*inhuman.App, buffer),
+		retries:    retries,
+		stats:      SinkStats{Name: name},
+		done:       make(chan struct{}),
+	}
+	f.sinks = append(f.sinks, s)
+	go f.run(s)
+}
+
+// Primary return primary repository
+func (f *FanOut) Primary() AppRepository {
+	return f.primary
+}
+
+// Stats return error accounting of all secondary sinks
+func (f *FanOut) Stats() []SinkStats {
+	stats := make([]SinkStats, len(f.sinks))
+	for i, s := range f.sinks {
+		s.mutex.Lock()
+		stats[i] = s.stats
+		s.mutex.Unlock()
+	}
+
+	return stats
+}
+
+// Close waits until sinks write all buffered batches and closes all repositories
+func (f *FanOut) Close() error {
+	var err error
+	for _, s := range f.sinks {
+		close(s.batches)
+		<-s.done
+		if c, ok := s.repository.(io.Closer); ok {
+			if e := c.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	if c, ok := f.primary.(io.Closer); ok {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// run write batches to the sink with retries
+func (f *FanOut) run(s *sink) {
+	defer close(s.done)
+
+	for batch := range s.batches {
+		var err error
+		for i := 0; i < s.retries; i++ {
+			if i > 0 {
+				s.mutex.Lock()
+				s.stats.Retries++
+				s.mutex.Unlock()
+				time.Sleep(f.Backoff * time.Duration(i))
+			}
+			if err = s.repository.InsertBatch(context.Background(), batch); err == nil {
+				break
+			}
+		}
+
+		s.mutex.Lock()
+		if err != nil {
+			s.stats.Failed += len(batch)
+			s.stats.LastError = err.Error()
+		} else {
+			s.stats.Written += len(batch)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Create new instance of FanOut
+func NewFanOut(primary AppRepository) *FanOut {
+	return &FanOut{
+		Backoff: time.Second,
+		primary: primary,
+	}
+}
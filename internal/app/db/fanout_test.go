@@ -0,0 +1,140 @@
+package db_test
+
+import (
+	"Nani/internal/app/db"
+	"Nani/internal/app/inhuman"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockRepo struct {
+	apps   []*inhuman.App
+	fails  int
+	delay  time.Duration
+	closed bool
+	mutex  sync.Mutex
+}
+
+func (m *mockRepo) Insert(ctx context.Context, app *inhuman.App) error {
+	return m.InsertBatch(ctx, []*inhuman.App{app})
+}
+
+func (m *mockRepo) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	time.Sleep(m.delay)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.fails != 0 {
+		m.fails--
+		return errors.New("insert error")
+	}
+	m.apps = append(m.apps, apps...)
+	return nil
+}
+
+func (m *mockRepo) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestFanOutInsertBatch_ShouldWriteBatchToAllSinks_NoError(t *testing.T) {
+	primary, secondary := &mockRepo{}, &mockRepo{}
+	f := db.NewFanOut(primary)
+	f.AddSink("secondary", secondary, 10, 1)
+
+	assert.NoError(t, f.InsertBatch(context.Background(), []*inhuman.App{App(), App()}))
+	assert.NoError(t, f.Insert(context.Background(), App()))
+	assert.NoError(t, f.Close())
+
+	assert.Len(t, primary.apps, 3)
+	assert.Len(t, secondary.apps, 3)
+	assert.True(t, primary.closed)
+	assert.True(t, secondary.closed)
+	assert.Equal(t, db.SinkStats{Name: "secondary", Written: 3}, f.Stats()[0])
+}
+
+func TestFanOutInsertBatch_ShouldNotWaitForSlowSink_NoError(t *testing.T) {
+	primary, slow := &mockRepo{}, &mockRepo{delay: time.Millisecond * 300}
+	f := db.NewFanOut(primary)
+	f.AddSink("slow", slow, 1, 1)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, f.InsertBatch(context.Background(), []*inhuman.App{App()}))
+	}
+	assert.Less(t, int64(time.Since(start)), int64(time.Millisecond*100))
+	assert.Len(t, primary.apps, 5)
+
+	assert.NoError(t, f.Close())
+	stats := f.Stats()[0]
+	assert.Greater(t, stats.Dropped, 0)
+	assert.Equal(t, 5, stats.Written+stats.Dropped)
+}
+
+func TestFanOutInsertBatch_ShouldRetryAndCountFailsOfSink_NoError(t *testing.T) {
+	primary, failing := &mockRepo{}, &mockRepo{fails: 3}
+	f := db.NewFanOut(primary)
+	f.Backoff = time.Millisecond
+	f.AddSink("failing", failing, 10, 2)
+
+	assert.NoError(t, f.InsertBatch(context.Background(), []*inhuman.App{App(), App()}))
+	assert.NoError(t, f.InsertBatch(context.Background(), []*inhuman.App{App()}))
+	assert.NoError(t, f.Close())
+
+	stats := f.Stats()[0]
+	assert.Equal(t, 2, stats.Failed)
+	assert.Equal(t, 1, stats.Written)
+	assert.Equal(t, 2, stats.Retries)
+	assert.Equal(t, "insert error", stats.LastError)
+	assert.Len(t, primary.apps, 3)
+}
+
+func TestFanOutInsertBatch_ShouldReturnErrorOfPrimaryAndNotWriteSinks_Error(t *testing.T) {
+	primary, secondary := &mockRepo{fails: 1}, &mockRepo{}
+	f := db.NewFanOut(primary)
+	f.AddSink("secondary", secondary, 10, 1)
+
+	assert.Error(t, f.InsertBatch(context.Background(), []*inhuman.App{App()}))
+	assert.NoError(t, f.Close())
+
+	assert.Len(t, primary.apps, 0)
+	assert.Len(t, secondary.apps, 0)
+}
+
+type mockRowsRepo struct {
+	mockRepo
+	reject map[string]bool
+}
+
+func (m *mockRowsRepo) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	batch := &db.BatchError{}
+	for i, v := range apps {
+		if m.reject[v.Bundle] {
+			batch.Rows = append(batch.Rows, db.RowError{Index: i, App: v, Err: errors.New("row error")})
+			continue
+		}
+		m.apps = append(m.apps, v)
+	}
+	if len(batch.Rows) != 0 {
+		return batch
+	}
+	return nil
+}
+
+func TestFanOutInsertBatch_ShouldWriteSinksOnlyWithRowsAcceptedByPrimary_Error(t *testing.T) {
+	primary := &mockRowsRepo{reject: map[string]bool{"2": true}}
+	secondary := &mockRepo{}
+	f := db.NewFanOut(primary)
+	f.AddSink("secondary", secondary, 10, 1)
+
+	apps := []*inhuman.App{{Bundle: "1"}, {Bundle: "2"}, {Bundle: "3"}}
+	assert.Error(t, f.InsertBatch(context.Background(), apps))
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, []*inhuman.App{apps[0], apps[2]}, primary.apps)
+	assert.Equal(t, []*inhuman.App{apps[0], apps[2]}, secondary.apps)
+	assert.Equal(t, db.SinkStats{Name: "secondary", Written: 2}, f.Stats()[0])
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"Nani/internal/app/config"
+	"Nani/internal/app/file"
+	"Nani/internal/app/inhuman"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// JsonlDatabase writes applications to the json lines files
+type JsonlDatabase struct {
+	writer *file.RotateWriter
+}
+
+// jsonlRecord is application with the time it was stored
+type jsonlRecord struct {
+	*inhuman.App
+	Datetime string `json:"datetime"`
+}
+
+func (j *JsonlDatabase) Insert(ctx context.Context, app *inhuman.App) error {
+	return j.InsertBatch(ctx, []*inhuman.App{app})
+}
+
+func (j *JsonlDatabase) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	return j.WriteStored(stamp(apps, time.Now()))
+}
+
+// WriteStored write applications with the time they were stored
+func (j *JsonlDatabase) WriteStored(apps []StoredApp) error {
+	for _, v := range apps {
+		b, err := json.Marshal(jsonlRecord{App: v.App, Datetime: v.Datetime.Format(datetimeFormat)})
+		if err != nil {
+			return err
+		}
+		if _, err := j.writer.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return j.writer.Flush()
+}
+
+// Files return names of all written files
+func (j *JsonlDatabase) Files() []string {
+	return j.writer.Files()
+}
+
+// Close current file
+func (j *JsonlDatabase) Close() error {
+	return j.writer.Close()
+}
+
+// Create new instance of JsonlDatabase. Returns error if path is empty
+func NewJsonl(config config.FileConfig) (*JsonlDatabase, error) {
+	if config.Path == "" {
+		return nil, errors.New("empty jsonl file path")
+	}
+
+	return &JsonlDatabase{
+		writer: file.NewRotateWriter(config.Path, config.MaxSize, config.Interval, config.Gzip),
+	}, nil
+}
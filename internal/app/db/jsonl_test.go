@@ -0,0 +1,99 @@
+package db_test
+
+import (
+	config2 "Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"Nani/internal/app/inhuman"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJsonlInsertBatch_ShouldWriteAppsLineByLine_NoError(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := db.NewJsonl(config2.FileConfig{Path: filepath.Join(dir, "apps.jsonl")})
+	assert.NoError(t, err)
+	app := App()
+	app.Description = "line\nwith \"quotes\""
+
+	assert.NoError(t, repo.InsertBatch(context.Background(), []*inhuman.App{app, App()}))
+	assert.NoError(t, repo.Insert(context.Background(), App()))
+	assert.NoError(t, repo.Close())
+
+	files, _ := filepath.Glob(filepath.Join(dir, "apps-*.jsonl"))
+	assert.Len(t, files, 1)
+	f, err := os.Open(files[0])
+	assert.NoError(t, err)
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	lines := 0
+	for sc.Scan() {
+		var res map[string]interface{}
+		assert.NoError(t, json.Unmarshal(sc.Bytes(), &res))
+		assert.Equal(t, "com.ky", res["bundle"])
+		assert.NotEmpty(t, res["datetime"])
+		if lines == 0 {
+			assert.Equal(t, app.Description, res["description"])
+		}
+		lines++
+	}
+	assert.Equal(t, 3, lines)
+}
+
+func TestJsonlInsertBatch_ShouldRotateAndCompressFiles_NoError(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := db.NewJsonl(config2.FileConfig{Path: filepath.Join(dir, "apps.jsonl"), MaxSize: 1, Gzip: true})
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.InsertBatch(context.Background(), []*inhuman.App{App(), App(), App()}))
+	assert.NoError(t, repo.Close())
+
+	files, _ := filepath.Glob(filepath.Join(dir, "apps-*.jsonl.gz"))
+	assert.Len(t, files, 3)
+	for _, name := range files {
+		f, err := os.Open(name)
+		assert.NoError(t, err)
+		gz, err := gzip.NewReader(f)
+		assert.NoError(t, err)
+		var app inhuman.App
+		assert.NoError(t, json.NewDecoder(gz).Decode(&app))
+		assert.Equal(t, App().Screenshots, app.Screenshots)
+		f.Close()
+	}
+}
+
+func TestOpen_ShouldCreateRepositoryForConfiguredDriver_NoError(t *testing.T) {
+	conf := config2.DBConfig{File: config2.FileConfig{Path: filepath.Join(t.TempDir(), "apps")}}
+
+	conf.Driver = "jsonl"
+	repo, err := db.Open(conf)
+	assert.NoError(t, err)
+	assert.IsType(t, &db.JsonlDatabase{}, repo)
+	conf.Driver = "csv"
+	repo, err = db.Open(conf)
+	assert.NoError(t, err)
+	assert.IsType(t, &db.CsvDatabase{}, repo)
+}
+
+func TestOpen_ShouldReturnErrorCozDriverOrPathIsInvalid_Error(t *testing.T) {
+	_, err := db.Open(config2.DBConfig{Driver: "mysql"})
+	assert.EqualError(t, err, "unknown database driver mysql")
+
+	_, err = db.Open(config2.DBConfig{Driver: "parquet"})
+	assert.EqualError(t, err, "empty parquet file path")
+
+	_, err = db.NewJsonl(config2.FileConfig{})
+	assert.EqualError(t, err, "empty jsonl file path")
+
+	_, err = db.NewCsv(config2.FileConfig{})
+	assert.EqualError(t, err, "empty csv file path")
+
+	_, err = db.Open(config2.DBConfig{Driver: "clickhouse"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Migration is numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+}
+
+// MigrationStatus is migration with information when it was applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// SchemaChecker checks that database schema is up to date
+type SchemaChecker interface {
+	CheckSchema(ctx context.Context) error
+}
+
+// SchemaBehindError returned if database has not applied migrations
+type SchemaBehindError struct {
+	Current int
+	Latest  int
+}
+
+func (e *SchemaBehindError) Error() string {
+	return fmt.Sprintf("database schema version %d is behind binary version %d, run migrate", e.Current, e.Latest)
+}
+
+// Migrator applies migrations and stores applied versions in schema_migrations table
+type Migrator struct {
+	connection *sql.DB
+	migrations []Migration
+}
+
+// Status return all migrations with applied flag
+// @params
+//	ctx: context.Context
+// @return
+//	[]MigrationStatus, error
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(m.migrations))
+	for i, v := range m.migrations {
+		at, ok := applied[v.Version]
+		status[i] = MigrationStatus{Migration: v, Applied: ok, AppliedAt: at}
+	}
+
+	return status, nil
+}
+
+// Pending return migrations which are not applied yet
+// @params
+//	ctx: context.Context
+// @return
+//	[]Migration, error
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]Migration, 0)
+	for _, v := range status {
+		if !v.Applied {
+			pending = append(pending, v.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies all pending migrations in order of versions. With dry run
+// pending migrations are returned but not applied
+// @params
+//	ctx: context.Context
+//	dryRun: bool (do not apply migrations)
+// @return
+//	[]Migration (applied or pending migrations), error
+func (m *Migrator) Up(ctx context.Context, dryRun bool) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+	if err := m.create(ctx); err != nil {
+		return nil, err
+	}
+
+	for i, v := range pending {
+		for _, q := range v.Up {
+			if _, err := m.connection.ExecContext(ctx, q); err != nil {
+				return pending[:i], fmt.Errorf("migration %d %s: %w", v.Version, v.Name, err)
+			}
+		}
+		_, err := m.connection.ExecContext(
+			ctx,
+			"insert into schema_migrations (version, name) values (?, ?)",
+			v.Version,
+			v.Name,
+		)
+		if err != nil {
+			return pending[:i], err
+		}
+	}
+
+	return pending, nil
+}
+
+// Check return *SchemaBehindError if some migrations are not applied
+// @params
+//	ctx: context.Context
+// @return
+//	error
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	current, behind := 0, false
+	for _, v := range status {
+		if v.Applied && v.Version > current {
+			current = v.Version
+		}
+		if !v.Applied {
+			behind = true
+		}
+	}
+	if !behind {
+		return nil
+	}
+
+	return &SchemaBehindError{Current: current, Latest: m.Latest()}
+}
+
+// Latest return the latest migration version known by binary
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// create creates schema_migrations table if it does not exist
+func (m *Migrator) create(ctx context.Context) error {
+	_, err := m.connection.ExecContext(ctx, `create table if not exists schema_migrations
+(
+    version UInt32,
+    name    String,
+    applied DateTime DEFAULT now()
+)   ENGINE = MergeTree()
+    ORDER BY version`)
+
+	return err
+}
+
+// applied return applied migrations versions with time of applying.
+// Missing schema_migrations table means nothing is applied, it is not
+// created, so status and dry run do not change database
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	var exists uint8
+	if err := m.connection.QueryRowContext(ctx, "exists table schema_migrations").Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return applied, nil
+	}
+
+	rows, err := m.connection.QueryContext(ctx, "select version, applied from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// CheckSchema return error if database schema is behind the binary
+func (c *ClickhouseDatabase) CheckSchema(ctx context.Context) error {
+	return NewMigrator(c.connection).Check(ctx)
+}
+
+// Create new instance of Migrator. If migrations are not given
+// the Migrations of the binary are used
+func NewMigrator(connection *sql.DB, migrations ...Migration) *Migrator {
+	if len(migrations) == 0 {
+		migrations = Migrations
+	}
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{
+		connection: connection,
+		migrations: sorted,
+	}
+}
@@ -0,0 +1,221 @@
+package db_test
+
+import (
+	"Nani/internal/app/db"
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMigrations = []db.Migration{
+	{Version: 2, Name: "second", Up: []string{"create table second"}},
+	{Version: 1, Name: "first", Up: []string{"create table first"}},
+	{Version: 3, Name: "third", Up: []string{"alter table first add column a String", "alter table first add column b String"}},
+}
+
+func expectApplied(mock sqlmock.Sqlmock, versions ...int) {
+	mock.ExpectQuery("^exists table schema_migrations$").
+		WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow(1))
+	rows := sqlmock.NewRows([]string{"version", "applied"})
+	for _, v := range versions {
+		rows.AddRow(v, time.Now())
+	}
+	mock.ExpectQuery("^select version, applied from schema_migrations$").WillReturnRows(rows)
+}
+
+func expectNoMigrationsTable(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("^exists table schema_migrations$").
+		WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow(0))
+}
+
+func expectCreate(mock sqlmock.Sqlmock) {
+	mock.ExpectExec("^create table if not exists schema_migrations").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestMigratorStatus_ShouldReturnSortedMigrationsWithAppliedFlag_NoError(t *testing.T) {
+	d, mock := MockDb()
+	defer d.Close()
+	expectApplied(mock, 1)
+
+	status, err := db.NewMigrator(d, testMigrations...).Status(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, status, 3)
+	assert.Equal(t, 1, status[0].Version)
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[0].AppliedAt.IsZero())
+	assert.Equal(t, 2, status[1].Version)
+	assert.False(t, status[1].Applied)
+	assert.Equal(t, 3, status[2].Version)
+	assert.False(t, status[2].Applied)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorUp_ShouldApplyPendingMigrationsInOrder_NoError(t *testing.T) {
+	d, mock := MockDb()
+	defer d.Close()
+	expectApplied(mock, 1)
+	expectCreate(mock)
+	mock.ExpectExec("^create table second$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^insert into schema_migrations \\(version, name\\) values \\(\\?, \\?\\)$").
+		WithArgs(2, "second").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^alter table first add column a String$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^alter table first add column b String$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^insert into schema_migrations").
+		WithArgs(3, "third").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	applied, err := db.NewMigrator(d, testMigrations...).Up(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 2)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorUp_ShouldReturnPendingMigrationsWithoutApplyingInDryRun_NoError(t *testing.T) {
+	d, mock := MockDb()
+	defer d.Close()
+	expectApplied(mock)
+
+	pending, err := db.NewMigrator(d, testMigrations...).Up(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 3)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorStatus_ShouldNotCreateMigrationsTableIfItIsMissing_NoError(t *testing.T) {
+	d, mock := MockDb()
+	defer d.Close()
+	expectNoMigrationsTable(mock)
+
+	status, err := db.NewMigrator(d, testMigrations...).Status(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, status, 3)
+	for _, v := range status {
+		assert.False(t, v.Applied)
+	}
+
+	expectNoMigrationsTable(mock)
+	pending, err := db.NewMigrator(d, testMigrations...).Up(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 3)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorUp_ShouldStopOnFailedMigration_Error(t *testing.T) {
+	d, mock := MockDb()
+	defer d.Close()
+	expectApplied(mock, 1)
+	expectCreate(mock)
+	mock.ExpectExec("^create table second$").WillReturnError(errors.New("syntax error"))
+
+	applied, err := db.NewMigrator(d, testMigrations...).Up(context.Background(), false)
+	assert.Error(t, err)
+	assert.Len(t, applied, 0)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorCheck_ShouldReturnSchemaBehindError_Error(t *testing.T) {
+	d, mock := MockDb()
+	defer d.Close()
+	expectApplied(mock, 1, 2)
+
+	err := db.NewMigrator(d, testMigrations...).Check(context.Background())
+	var behind *db.SchemaBehindError
+	assert.True(t, errors.As(err, &behind))
+	assert.Equal(t, 2, behind.Current)
+	assert.Equal(t, 3, behind.Latest)
+
+	expectApplied(mock, 1, 2, 3)
+	assert.NoError(t, db.NewMigrator(d, testMigrations...).Check(context.Background()))
+}
+
+func TestMigrations_ShouldHaveUniqueSequentialVersions_NoError(t *testing.T) {
+	for i, v := range db.Migrations {
+		assert.Equal(t, i+1, v.Version)
+		assert.NotEmpty(t, v.Name)
+		assert.NotEmpty(t, v.Up)
+	}
+}
+
+func TestMigrations_ShouldKeepSnapshotsOfAppsWithDifferentDatetime_NoError(t *testing.T) {
+	orderBy := regexp.MustCompile(`(?s)create table if not exists (apps|apps_snapshots)\b.*ORDER BY \(([^)]*)\)`)
+	var key string
+	for _, m := range db.Migrations {
+		for _, q := range m.Up {
+			if match := orderBy.FindStringSubmatch(q); match != nil {
+				key = match[2]
+			}
+		}
+	}
+
+	assert.Contains(t, strings.Split(key, ", "), "datetime")
+}
+
+func TestMigrations_ShouldDropLeftoversOfInterruptedCopyOfApps_NoError(t *testing.T) {
+	var up []string
+	for _, m := range db.Migrations {
+		if m.Name == "keep all snapshots of apps" {
+			up = m.Up
+		}
+	}
+
+	assert.Equal(t, "drop table if exists apps_snapshots", up[0])
+	assert.Equal(t, "drop table if exists apps_merged", up[1])
+}
+
+func TestMigrations_ShouldUpdateAppsSynchronously_NoError(t *testing.T) {
+	for _, m := range db.Migrations {
+		for _, q := range m.Up {
+			if strings.HasPrefix(q, "alter table apps update") {
+				assert.Contains(t, q, "settings mutations_sync = 2")
+			}
+		}
+	}
+}
+
+func TestMigrations_ShouldKeepAppliedCreateQueries_NoError(t *testing.T) {
+	// Queries applied to existing databases, DDL of tables must not change them
+	applied := map[int]string{
+		2: `create table if not exists app_changes
+(
+    bundle   String,
+    field    String,
+    oldValue String,
+    newValue String,
+    detected DateTime
+)   ENGINE = MergeTree()
+    ORDER BY (bundle, detected)
+    PARTITION BY toYYYYMM(detected)`,
+		3: `create table if not exists apps_normalized
+(
+    bundle          String,
+    rating          Float64,
+    reviewCount     Int64,
+    minInstalls     Int64,
+    priceMinor      Int64,
+    currency        String,
+    sizeBytes       Int64,
+    releaseDate     Nullable(Date),
+    lastUpdateDate  Nullable(Date),
+    ratingHistogram Array(Int64),
+    datetime        DateTime DEFAULT now()
+)   ENGINE = ReplacingMergeTree(datetime)
+    ORDER BY bundle`,
+	}
+	for _, m := range db.Migrations {
+		if query, ok := applied[m.Version]; ok {
+			assert.Equal(t, strings.Fields(query), strings.Fields(m.Up[0]), "migration %d", m.Version)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+// Migrations of database schema. Applied migrations must never be changed,
+// any schema change is a new migration with the next version. Tables are
+// created with DDL of their Table while it is the same as the applied query,
+// after the table is changed by the next migration its create query is kept
+// as text
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create apps",
+		Up: []string{
+			`create table if not exists apps
+(
+    bundle           String,
+    developerId      String,
+    developer        String,
+    title            String,
+    categories       String,
+    price            String,
+    picture          String,
+    screenshots      Array(String),
+    rating           String,
+    reviewCount      String,
+    ratingHistogram  Array(String),
+    description      String,
+    shortDescription String,
+    recentChanges    String,
+    releaseDate      String,
+    lastUpdateDate   String,
+    appSize          String,
+    installs         String,
+    version          String,
+    androidVersion   String,
+    contentRating    String,
+    developerContacts Nested(email String, contacts String),
+    privacyPolicy    String,
+    datetime         DateTime DEFAULT now()
+)   ENGINE = ReplacingMergeTree(datetime)
+    ORDER BY (bundle, developerId, categories)
+    PARTITION BY (categories)`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create app_changes",
+		Up: []string{
+			ChangesTable.DDL(),
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create apps_normalized",
+		Up: []string{
+			NormalizedTable.DDL(),
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add developer contacts columns",
+		Up: []string{
+			`alter table apps
+    add column if not exists developerEmail        String after contentRating,
+    add column if not exists developerWebsite      String after developerEmail,
+    add column if not exists developerAddress      String after developerWebsite,
+    add column if not exists developerPhone        String after developerAddress,
+    add column if not exists developerDomain       String after developerPhone,
+    add column if not exists developerContactsText String after developerDomain`,
+			`alter table apps update
+    developerEmail        = lower(developerContacts.email[1]),
+    developerDomain       = lower(splitByChar('@', developerContacts.email[1])[-1]),
+    developerContactsText = developerContacts.contacts[1]
+    where notEmpty(developerContacts.email) and developerEmail = ''
+    settings mutations_sync = 2`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "keep all snapshots of apps",
+		Up: []string{
+			`drop table if exists apps_snapshots`,
+			`drop table if exists apps_merged`,
+			`create table if not exists apps_snapshots as apps
+    ENGINE = ReplacingMergeTree(datetime)
+    ORDER BY (bundle, developerId, categories, datetime)
+    PARTITION BY (categories)`,
+			`insert into apps_snapshots select * from apps`,
+			`rename table apps to apps_merged, apps_snapshots to apps`,
+			`drop table if exists apps_merged`,
+		},
+	},
+}
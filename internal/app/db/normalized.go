@@ -0,0 +1,44 @@
+package db
+
+import (
+	"Nani/internal/app/inhuman"
+	"context"
+)
+
+// NormalizedRepository stores typed application records
+type NormalizedRepository interface {
+	InsertNormalized(ctx context.Context, apps []*inhuman.NormalizedApp) error
+}
+
+// InsertNormalized save typed application records to apps_normalized table
+// @params
+//	ctx: context.Context
+//	apps: []*inhuman.NormalizedApp (normalized applications)
+// @return
+//	error
+func (c *ClickhouseDatabase) InsertNormalized(ctx context.Context, apps []*inhuman.NormalizedApp) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	t, err := c.connection.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := t.PrepareContext(ctx, NormalizedTable.Insert())
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, v := range apps {
+		_, err := stmt.ExecContext(ctx, NormalizedTable.Args(v)...)
+		if err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	return t.Commit()
+}
@@ -0,0 +1,47 @@
+package db_test
+
+import (
+	config2 "Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"Nani/internal/app/inhuman"
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mailru/go-clickhouse"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestInsertNormalizedMock_ShouldInsertTypedRecords_NoError(t *testing.T) {
+	ctx := context.Background()
+	d, mock := MockDb()
+	defer d.Close()
+
+	release := time.Date(2020, time.June, 20, 0, 0, 0, 0, time.UTC)
+	n, _ := inhuman.Normalize(App(), "en")
+	n.ReleaseDate = release
+	n.LastUpdateDate = time.Time{}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("^insert into apps_normalized \\(bundle, rating, .+\\) values \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$").
+		ExpectExec().
+		WithArgs(
+			n.Bundle,
+			n.Rating,
+			n.ReviewCount,
+			n.MinInstalls,
+			n.PriceMinor,
+			n.Currency,
+			n.SizeBytes,
+			clickhouse.Date(release),
+			nil,
+			clickhouse.Array(n.RatingHistogram),
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	assert.NoError(t, repo.InsertNormalized(ctx, []*inhuman.NormalizedApp{n}))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
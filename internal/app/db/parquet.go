@@ -0,0 +1,215 @@
+package db
+
+import (
+	"Nani/internal/app/config"
+	"Nani/internal/app/file"
+	"Nani/internal/app/inhuman"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParquetDatabase writes applications to the parquet files. Each batch is
+// a row group, file is switched after the batch which makes it too big or too old
+type ParquetDatabase struct {
+	writer   *file.RotateWriter
+	parquet  *writer.JSONWriter
+	schema   string
+	maxSize  int64
+	interval time.Duration
+	opened   time.Time
+	mutex    sync.Mutex
+}
+
+func (p *ParquetDatabase) Insert(ctx context.Context, app *inhuman.App) error {
+	return p.InsertBatch(ctx, []*inhuman.App{app})
+}
+
+func (p *ParquetDatabase) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	return p.WriteStored(stamp(apps, time.Now()))
+}
+
+// WriteStored write applications with the time they were stored
+func (p *ParquetDatabase) WriteStored(apps []StoredApp) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.parquet == nil {
+		if err := p.writer.Rotate(); err != nil {
+			return err
+		}
+		w, err := writer.NewJSONWriter(p.schema, &parquetFile{w: p.writer}, 1)
+		if err != nil {
+			return err
+		}
+		p.parquet = w
+		p.opened = time.Now()
+	}
+
+	for _, v := range apps {
+		record, err := parquetRecord(v)
+		if err != nil {
+			return err
+		}
+		if err := p.parquet.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := p.parquet.Flush(true); err != nil {
+		return err
+	}
+
+	if (p.maxSize > 0 && p.writer.Size() >= p.maxSize) || (p.interval > 0 && time.Since(p.opened) >= p.interval) {
+		return p.stop()
+	}
+
+	return nil
+}
+
+// Files return names of all written files
+func (p *ParquetDatabase) Files() []string {
+	return p.writer.Files()
+}
+
+// Close write footer of the current file and close it
+func (p *ParquetDatabase) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.stop(); err != nil {
+		return err
+	}
+
+	return p.writer.Close()
+}
+
+// stop write footer of the current file
+func (p *ParquetDatabase) stop() error {
+	if p.parquet == nil {
+		return nil
+	}
+	err := p.parquet.WriteStop()
+	p.parquet = nil
+
+	return err
+}
+
+// parquetSchema return json schema of parquet file with columns of table
+// and datetime of snapshot
+func parquetSchema(table *Table) string {
+	type node struct {
+		Tag    string
+		Fields []node `json:",omitempty"`
+	}
+	leaf := func(name, typ string) node {
+		return node{Tag: fmt.Sprintf("name=%s, type=%s, repetitiontype=REQUIRED", name, typ)}
+	}
+
+	root := node{Tag: "name=parquet_go_root, repetitiontype=REQUIRED"}
+	for _, c := range table.Columns {
+		switch {
+		case strings.HasPrefix(c.Type, "Array("):
+			n := node{Tag: fmt.Sprintf("name=%s, type=LIST, repetitiontype=REQUIRED", c.Name)}
+			n.Fields = []node{leaf("element", parquetType(strings.TrimSuffix(strings.TrimPrefix(c.Type, "Array("), ")")))}
+			root.Fields = append(root.Fields, n)
+		default:
+			root.Fields = append(root.Fields, leaf(c.Name, parquetType(c.Type)))
+		}
+	}
+	root.Fields = append(root.Fields, leaf("datetime", "TIMESTAMP_MILLIS"))
+
+	b, _ := json.Marshal(root)
+
+	return string(b)
+}
+
+// parquetType return parquet type of clickhouse type
+func parquetType(typ string) string {
+	switch typ {
+	case "Int64":
+		return "INT64"
+	case "Float64":
+		return "DOUBLE"
+	case "UInt8":
+		return "BOOLEAN"
+	default:
+		return "UTF8"
+	}
+}
+
+// parquetRecord return json record of application for parquet json writer
+func parquetRecord(app StoredApp) (string, error) {
+	record := make(map[string]interface{}, len(AppsTable.Columns)+1)
+	values := AppsTable.Values(app.App)
+	for i, c := range AppsTable.Columns {
+		record[c.Name] = values[i]
+		if s, ok := values[i].([]string); ok && s == nil {
+			record[c.Name] = []string{}
+		}
+	}
+	record["datetime"] = app.Datetime.UnixNano() / int64(time.Millisecond)
+
+	b, err := json.Marshal(record)
+
+	return string(b), err
+}
+
+// parquetFile is write only parquet file over io.Writer
+type parquetFile struct {
+	w io.Writer
+}
+
+func (f *parquetFile) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+func (f *parquetFile) Read(p []byte) (int, error) {
+	return 0, errors.New("parquet file is write only")
+}
+
+func (f *parquetFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("parquet file is write only")
+}
+
+func (f *parquetFile) Open(name string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet file is write only")
+}
+
+func (f *parquetFile) Create(name string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet file is write only")
+}
+
+// Footer is written by parquet writer, file is closed by RotateWriter
+func (f *parquetFile) Close() error {
+	return nil
+}
+
+// Create new instance of ParquetDatabase. Parquet files are compressed
+// with snappy, so gzip option is ignored. Returns error if path is empty
+func NewParquet(config config.FileConfig) (*ParquetDatabase, error) {
+	if config.Path == "" {
+		return nil, errors.New("empty parquet file path")
+	}
+
+	return &ParquetDatabase{
+		writer:   file.NewRotateWriter(config.Path, 0, 0, false),
+		schema:   parquetSchema(AppsTable),
+		maxSize:  config.MaxSize,
+		interval: config.Interval,
+	}, nil
+}
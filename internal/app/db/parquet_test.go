@@ -0,0 +1,102 @@
+package db_test
+
+import (
+	config2 "Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"Nani/internal/app/inhuman"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// localFile is parquet file for reading from the disk
+type localFile struct {
+	*os.File
+}
+
+func (f *localFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.Name()
+	}
+	file, err := os.Open(name)
+	return &localFile{file}, err
+}
+
+func (f *localFile) Create(name string) (source.ParquetFile, error) {
+	file, err := os.Create(name)
+	return &localFile{file}, err
+}
+
+func readParquet(t *testing.T, path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	r, err := reader.NewParquetReader(&localFile{f}, nil, 1)
+	assert.NoError(t, err)
+	defer r.ReadStop()
+
+	rows, err := r.ReadByNumber(int(r.GetNumRows()))
+	assert.NoError(t, err)
+	b, _ := json.Marshal(rows)
+	var res []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &res))
+
+	return res
+}
+
+func TestParquetWriteStored_ShouldWriteArraysAndDatetime_NoError(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := db.NewParquet(config2.FileConfig{Path: filepath.Join(dir, "apps.parquet")})
+	assert.NoError(t, err)
+	at := time.Date(2020, 10, 20, 10, 0, 0, 0, time.UTC)
+	app := App()
+	app.RatingHistogram = nil
+
+	assert.NoError(t, repo.WriteStored([]db.StoredApp{{App: app, Datetime: at}, {App: App(), Datetime: at}}))
+	assert.NoError(t, repo.Close())
+
+	files := repo.Files()
+	assert.Len(t, files, 1)
+	rows := readParquet(t, files[0])
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "com.ky", rows[0]["Bundle"])
+	assert.Equal(t, []interface{}{"1", "2", "3"}, rows[0]["Screenshots"])
+	assert.Empty(t, rows[0]["RatingHistogram"])
+	assert.Len(t, rows[1]["RatingHistogram"], 5)
+	assert.Equal(t, float64(at.UnixNano()/int64(time.Millisecond)), rows[0]["Datetime"])
+}
+
+func TestParquetInsertBatch_ShouldSplitFilesBySize_NoError(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := db.NewParquet(config2.FileConfig{Path: filepath.Join(dir, "apps.parquet"), MaxSize: 1})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, repo.InsertBatch(context.Background(), []*inhuman.App{App()}))
+	}
+	assert.NoError(t, repo.Close())
+
+	files := repo.Files()
+	assert.Len(t, files, 3)
+	for _, f := range files {
+		assert.Len(t, readParquet(t, f), 1)
+	}
+}
+
+func TestOpenWriter_ShouldReturnErrorCozFormatOrPathIsInvalid_Error(t *testing.T) {
+	_, err := db.NewParquet(config2.FileConfig{})
+	assert.EqualError(t, err, "empty parquet file path")
+
+	_, err = db.OpenWriter("parquet", config2.FileConfig{})
+	assert.EqualError(t, err, "empty parquet file path")
+
+	_, err = db.OpenWriter("xml", config2.FileConfig{Path: "apps.xml"})
+	assert.EqualError(t, err, "unknown file format xml")
+}
@@ -0,0 +1,281 @@
+package db
+
+import (
+	"Nani/internal/app/inhuman"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound returned if application is not stored in the database
+var ErrNotFound = errors.New("application not found")
+
+// AppReader reads stored applications from apps table
+type AppReader interface {
+	Latest(ctx context.Context, bundle string) (*inhuman.App, error)
+	History(ctx context.Context, bundle string) ([]StoredApp, error)
+	ByDeveloper(ctx context.Context, developerId string, limit int) ([]*inhuman.App, error)
+	ByCategory(ctx context.Context, category string, limit int) ([]*inhuman.App, error)
+	ByDeveloperEmail(ctx context.Context, email string, limit int) ([]*inhuman.App, error)
+	ByDeveloperDomain(ctx context.Context, domain string, limit int) ([]*inhuman.App, error)
+	Bundles(ctx context.Context) ([]string, error)
+	Search(ctx context.Context, query string, limit int) ([]*inhuman.App, error)
+	Stream(ctx context.Context, filter AppFilter, fn func(app StoredApp) error) error
+}
+
+// AppFilter of stored snapshots, empty fields are not filtered
+type AppFilter struct {
+	Category    string
+	DeveloperId string
+	// From and To is range of snapshot datetime, To is exclusive
+	From time.Time
+	To   time.Time
+}
+
+// StoredApp is application snapshot with the time it was stored
+type StoredApp struct {
+	*inhuman.App
+	Datetime time.Time `json:"datetime"`
+}
+
+var appColumns = AppsTable.Names() + ", datetime"
+
+// Latest return the latest snapshot of application
+// @params
+//	ctx: context.Context
+//	bundle: string (application bundle)
+// @return
+//	*inhuman.App, error (ErrNotFound if application is not stored)
+func (c *ClickhouseDatabase) Latest(ctx context.Context, bundle string) (*inhuman.App, error) {
+	apps, err := c.queryApps(
+		ctx,
+		fmt.Sprintf("select %s from apps where bundle = ? order by datetime desc limit 1", appColumns),
+		bundle,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(apps) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return apps[0].App, nil
+}
+
+// History return all stored snapshots of application from the oldest to the newest
+// @params
+//	ctx: context.Context
+//	bundle: string (application bundle)
+// @return
+//	[]StoredApp, error
+func (c *ClickhouseDatabase) History(ctx context.Context, bundle string) ([]StoredApp, error) {
+	return c.queryApps(
+		ctx,
+		fmt.Sprintf("select %s from apps where bundle = ? order by datetime", appColumns),
+		bundle,
+	)
+}
+
+// ByDeveloper return the latest snapshots of developer applications
+// @params
+//	ctx: context.Context
+//	developerId: string (developer id)
+//	limit: int (max count of applications, 0 is unlimited)
+// @return
+//	[]*inhuman.App, error
+func (c *ClickhouseDatabase) ByDeveloper(ctx context.Context, developerId string, limit int) ([]*inhuman.App, error) {
+	return c.latestApps(ctx, "developerId = ?", limit, developerId)
+}
+
+// ByCategory return the latest snapshots of applications in the category
+// @params
+//	ctx: context.Context
+//	category: string (application category)
+//	limit: int (max count of applications, 0 is unlimited)
+// @return
+//	[]*inhuman.App, error
+func (c *ClickhouseDatabase) ByCategory(ctx context.Context, category string, limit int) ([]*inhuman.App, error) {
+	return c.latestApps(ctx, "categories = ?", limit, category)
+}
+
+// ByDeveloperEmail return the latest snapshots of applications with developer email
+// @params
+//	ctx: context.Context
+//	email: string (developer email, case insensitive)
+//	limit: int (max count of applications, 0 is unlimited)
+// @return
+//	[]*inhuman.App, error
+func (c *ClickhouseDatabase) ByDeveloperEmail(ctx context.Context, email string, limit int) ([]*inhuman.App, error) {
+	return c.latestApps(ctx, "developerEmail = ?", limit, strings.ToLower(strings.TrimSpace(email)))
+}
+
+// ByDeveloperDomain return the latest snapshots of applications which developer
+// website or email belongs to the domain
+// @params
+//	ctx: context.Context
+//	domain: string (domain like example.com)
+//	limit: int (max count of applications, 0 is unlimited)
+// @return
+//	[]*inhuman.App, error
+func (c *ClickhouseDatabase) ByDeveloperDomain(ctx context.Context, domain string, limit int) ([]*inhuman.App, error) {
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+	return c.latestApps(ctx, "developerDomain = ?", limit, domain)
+}
+
+// Bundles return all stored bundles
+// @params
+//	ctx: context.Context
+// @return
+//	[]string, error
+func (c *ClickhouseDatabase) Bundles(ctx context.Context) ([]string, error) {
+	rows, err := c.connection.QueryContext(ctx, "select distinct bundle from apps order by bundle")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bundles := make([]string, 0)
+	for rows.Next() {
+		var bundle string
+		if err := rows.Scan(&bundle); err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, bundle)
+	}
+
+	return bundles, rows.Err()
+}
+
+// Search return the latest snapshots of applications which title or description
+// contains all words of the query, case insensitive
+// @params
+//	ctx: context.Context
+//	query: string (words for search)
+//	limit: int (max count of applications, 0 is unlimited)
+// @return
+//	[]*inhuman.App, error
+func (c *ClickhouseDatabase) Search(ctx context.Context, query string, limit int) ([]*inhuman.App, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return []*inhuman.App{}, nil
+	}
+
+	conditions := make([]string, len(words))
+	args := make([]interface{}, 0, len(words)*2)
+	for i, v := range words {
+		conditions[i] = "(positionCaseInsensitiveUTF8(title, ?) > 0 or positionCaseInsensitiveUTF8(description, ?) > 0)"
+		args = append(args, v, v)
+	}
+
+	return c.latestApps(ctx, strings.Join(conditions, " and "), limit, args...)
+}
+
+// Stream read all snapshots matched by filter row by row ordered by bundle and datetime
+// and pass them to fn. Reading stops on the first error of fn
+// @params
+//	ctx: context.Context
+//	filter: AppFilter (filter of snapshots)
+//	fn: func(app StoredApp) error (snapshot handler)
+// @return
+//	error
+func (c *ClickhouseDatabase) Stream(ctx context.Context, filter AppFilter, fn func(app StoredApp) error) error {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	if filter.Category != "" {
+		conditions = append(conditions, "categories = ?")
+		args = append(args, filter.Category)
+	}
+	if filter.DeveloperId != "" {
+		conditions = append(conditions, "developerId = ?")
+		args = append(args, filter.DeveloperId)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "datetime >= ?")
+		args = append(args, filter.From.Format(datetimeFormat))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "datetime < ?")
+		args = append(args, filter.To.Format(datetimeFormat))
+	}
+	query := fmt.Sprintf("select %s from apps", appColumns)
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+	query += " order by bundle, datetime"
+
+	rows, err := c.connection.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(app); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// latestApps return the latest snapshot of each application matched by condition
+func (c *ClickhouseDatabase) latestApps(ctx context.Context, where string, limit int, args ...interface{}) ([]*inhuman.App, error) {
+	query := fmt.Sprintf(
+		"select %s from apps where %s order by bundle, datetime desc limit 1 by bundle",
+		appColumns,
+		where,
+	)
+	if limit > 0 {
+		query += fmt.Sprintf(" limit %d", limit)
+	}
+
+	stored, err := c.queryApps(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	apps := make([]*inhuman.App, len(stored))
+	for i, v := range stored {
+		apps[i] = v.App
+	}
+
+	return apps, nil
+}
+
+// queryApps execute query which selects appColumns and scan the result
+func (c *ClickhouseDatabase) queryApps(ctx context.Context, query string, args ...interface{}) ([]StoredApp, error) {
+	rows, err := c.connection.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apps := make([]StoredApp, 0)
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, rows.Err()
+}
+
+// scanApp scan row of appColumns to application
+func scanApp(rows *sql.Rows) (StoredApp, error) {
+	app := &inhuman.App{}
+	var datetime time.Time
+	err := rows.Scan(append(AppsTable.Dest(app), &datetime)...)
+	if err != nil {
+		return StoredApp{}, err
+	}
+
+	return StoredApp{App: app, Datetime: datetime}, nil
+}
@@ -0,0 +1,215 @@
+package db_test
+
+import (
+	config2 "Nani/internal/app/config"
+	"Nani/internal/app/db"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+	"time"
+)
+
+// arrayConverter passes string slices as is, like clickhouse driver returns arrays
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if s, ok := v.([]string); ok {
+		return s, nil
+	}
+
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func MockReaderDb() (*sql.DB, sqlmock.Sqlmock) {
+	d, m, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return d, m
+}
+
+var appColumns = []string{
+	"bundle", "developerId", "developer", "title", "categories", "price", "picture", "screenshots",
+	"rating", "reviewCount", "ratingHistogram", "description", "shortDescription", "recentChanges",
+	"releaseDate", "lastUpdateDate", "appSize", "installs", "version", "androidVersion", "contentRating",
+	"developerEmail", "developerWebsite", "developerAddress", "developerPhone", "developerDomain",
+	"developerContactsText", "privacyPolicy", "datetime",
+}
+
+func appRow(rows *sqlmock.Rows, bundle, version string, at time.Time) *sqlmock.Rows {
+	app := App()
+	return rows.AddRow(
+		bundle, app.DeveloperId, app.Developer, app.Title, app.Categories, app.Price, app.Picture,
+		app.Screenshots, app.Rating, app.ReviewCount, app.RatingHistogram, app.Description,
+		app.ShortDescription, app.RecentChanges, app.ReleaseDate, app.LastUpdateDate, app.AppSize,
+		app.Installs, version, app.AndroidVersion, app.ContentRating,
+		app.DeveloperContacts.Email, app.DeveloperContacts.Website, app.DeveloperContacts.Address,
+		app.DeveloperContacts.Phone, app.DeveloperContacts.Domain, app.DeveloperContacts.Contacts, app.PrivacyPolicy, at,
+	)
+}
+
+func TestLatestMock_ShouldReturnLastSnapshotOfApplication_NoError(t *testing.T) {
+	d, mock := MockReaderDb()
+	defer d.Close()
+
+	mock.ExpectQuery("^select bundle, .+, datetime from apps where bundle = \\? order by datetime desc limit 1$").
+		WithArgs("com.ky").
+		WillReturnRows(appRow(mock.NewRows(appColumns), "com.ky", "1.1", time.Now()))
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	app, err := repo.Latest(context.Background(), "com.ky")
+	assert.NoError(t, err)
+	assert.Equal(t, "com.ky", app.Bundle)
+	assert.Equal(t, "1.1", app.Version)
+	assert.Equal(t, App().Screenshots, app.Screenshots)
+	assert.Equal(t, App().DeveloperContacts, app.DeveloperContacts)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLatestMock_ShouldReturnNotFoundForUnknownBundle_Error(t *testing.T) {
+	d, mock := MockReaderDb()
+	defer d.Close()
+
+	mock.ExpectQuery("^select .+ from apps where bundle = \\?").
+		WithArgs("com.unknown").
+		WillReturnRows(mock.NewRows(appColumns))
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	_, err := repo.Latest(context.Background(), "com.unknown")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHistoryMock_ShouldReturnAllSnapshotsWithTime_NoError(t *testing.T) {
+	d, mock := MockReaderDb()
+	defer d.Close()
+
+	first, second := time.Now().Add(-time.Hour), time.Now()
+	rows := mock.NewRows(appColumns)
+	appRow(rows, "com.ky", "1.0", first)
+	appRow(rows, "com.ky", "1.1", second)
+	mock.ExpectQuery("^select .+ from apps where bundle = \\? order by datetime$").
+		WithArgs("com.ky").
+		WillReturnRows(rows)
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	history, err := repo.History(context.Background(), "com.ky")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "1.0", history[0].Version)
+	assert.Equal(t, first, history[0].Datetime)
+	assert.Equal(t, "1.1", history[1].Version)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestByDeveloperMock_ShouldReturnLatestAppsOfDeveloperWithLimit_NoError(t *testing.T) {
+	d, mock := MockReaderDb()
+	defer d.Close()
+
+	rows := mock.NewRows(appColumns)
+	appRow(rows, "com.ky", "1.0", time.Now())
+	appRow(rows, "com.ky2", "2.0", time.Now())
+	mock.ExpectQuery("^select .+ from apps where developerId = \\? order by bundle, datetime desc limit 1 by bundle limit 10$").
+		WithArgs("devid").
+		WillReturnRows(rows)
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	apps, err := repo.ByDeveloper(context.Background(), "devid", 10)
+	assert.NoError(t, err)
+	assert.Len(t, apps, 2)
+	assert.Equal(t, "com.ky2", apps[1].Bundle)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBundlesMock_ShouldReturnStoredBundles_NoError(t *testing.T) {
+	d, mock := MockReaderDb()
+	defer d.Close()
+
+	mock.ExpectQuery("^select distinct bundle from apps order by bundle$").
+		WillReturnRows(sqlmock.NewRows([]string{"bundle"}).AddRow("com.ky").AddRow("com.ky2"))
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	bundles, err := repo.Bundles(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"com.ky", "com.ky2"}, bundles)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchMock_ShouldMatchAllWordsInTitleOrDescription_NoError(t *testing.T) {
+	d, mock := MockReaderDb()
+	defer d.Close()
+
+	mock.ExpectQuery("^select .+ from apps where \\(positionCaseInsensitiveUTF8\\(title, \\?\\) > 0 or " +
+		"positionCaseInsensitiveUTF8\\(description, \\?\\) > 0\\) and \\(.+\\) order by bundle, datetime desc limit 1 by bundle$").
+		WithArgs("super", "super", "title", "title").
+		WillReturnRows(appRow(mock.NewRows(appColumns), "com.ky", "1.0", time.Now()))
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	apps, err := repo.Search(context.Background(), " super  title ", 0)
+	assert.NoError(t, err)
+	assert.Len(t, apps, 1)
+
+	empty, err := repo.Search(context.Background(), "  ", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, empty)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestByDeveloperDomainMock_ShouldSearchByCleanDomain_NoError(t *testing.T) {
+	d, mock := MockReaderDb()
+	defer d.Close()
+
+	mock.ExpectQuery("^select .+ from apps where developerDomain = \\? order by bundle, datetime desc limit 1 by bundle$").
+		WithArgs("example.com").
+		WillReturnRows(appRow(mock.NewRows(appColumns), "com.ky", "1.0", time.Now()))
+	mock.ExpectQuery("^select .+ from apps where developerEmail = \\? order by bundle, datetime desc limit 1 by bundle limit 5$").
+		WithArgs("dev@example.com").
+		WillReturnRows(mock.NewRows(appColumns))
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	apps, err := repo.ByDeveloperDomain(context.Background(), " WWW.Example.com", 0)
+	assert.NoError(t, err)
+	assert.Len(t, apps, 1)
+
+	apps, err = repo.ByDeveloperEmail(context.Background(), "Dev@Example.com", 5)
+	assert.NoError(t, err)
+	assert.Empty(t, apps)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStreamMock_ShouldPassFilteredSnapshotsToHandler_NoError(t *testing.T) {
+	d, mock := MockReaderDb()
+	defer d.Close()
+
+	from := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	rows := mock.NewRows(appColumns)
+	appRow(rows, "com.ky", "1.0", from)
+	appRow(rows, "com.ky2", "1.0", from)
+	mock.ExpectQuery("^select .+ from apps where categories = \\? and developerId = \\? and datetime >= \\? " +
+		"order by bundle, datetime$").
+		WithArgs("GAME", "devid", "2020-10-01 00:00:00").
+		WillReturnRows(rows)
+
+	repo := db.New(config2.DBConfig{Connection: d})
+	bundles := make([]string, 0)
+	err := repo.Stream(context.Background(), db.AppFilter{Category: "GAME", DeveloperId: "devid", From: from}, func(app db.StoredApp) error {
+		bundles = append(bundles, app.Bundle)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"com.ky", "com.ky2"}, bundles)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
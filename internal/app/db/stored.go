@@ -0,0 +1,53 @@
+package db
+
+import (
+	"Nani/internal/app/config"
+	"Nani/internal/app/inhuman"
+	"fmt"
+	"time"
+)
+
+// StoredWriter writes stored applications to the files
+type StoredWriter interface {
+	AppRepository
+	WriteStored(apps []StoredApp) error
+	Files() []string
+	Close() error
+}
+
+// OpenWriter create file writer of given format
+// @params
+//	format: string (jsonl, csv or parquet)
+//	config: config.FileConfig (path and rotation of files)
+// @return
+//	StoredWriter
+//	error (unknown format or empty path)
+func OpenWriter(format string, config config.FileConfig) (StoredWriter, error) {
+	var w StoredWriter
+	var err error
+	switch format {
+	case "jsonl":
+		w, err = NewJsonl(config)
+	case "csv":
+		w, err = NewCsv(config)
+	case "parquet":
+		w, err = NewParquet(config)
+	default:
+		return nil, fmt.Errorf("unknown file format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// stamp return applications with the time they were stored
+func stamp(apps []*inhuman.App, at time.Time) []StoredApp {
+	stored := make([]StoredApp, len(apps))
+	for i, v := range apps {
+		stored[i] = StoredApp{App: v, Datetime: at}
+	}
+
+	return stored
+}
@@ -0,0 +1,283 @@
+package db
+
+import (
+	"Nani/internal/app/inhuman"
+	"fmt"
+	"database/sql/driver"
+	"github.com/mailru/go-clickhouse"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Column of the table mapped to the struct field by db tag. Tag has format
+// `db:"name"` or `db:"name,Type"` where Type overrides clickhouse type
+// inferred from field type. Fields of struct tagged `db:",inline"` are mapped
+// as columns of the parent struct, fields tagged `db:"-"` are skipped
+type Column struct {
+	Name  string
+	Type  string
+	index []int
+}
+
+// Table is mapping of the stored entity to the database table
+type Table struct {
+	Name    string
+	Columns []Column
+	// Extra columns which are not mapped to entity fields, like datetime
+	// filled by the database
+	Extra []string
+	// Engine part of the table definition
+	Engine string
+	entity reflect.Type
+}
+
+// Stored entities
+var (
+	AppsTable = NewTable("apps", inhuman.App{},
+		"ENGINE = ReplacingMergeTree(datetime) ORDER BY (bundle, developerId, categories, datetime) PARTITION BY (categories)",
+		"developerContacts Nested(email String, contacts String)",
+		"datetime DateTime DEFAULT now()",
+	)
+	ChangesTable = NewTable("app_changes", inhuman.Change{},
+		"ENGINE = MergeTree() ORDER BY (bundle, detected) PARTITION BY toYYYYMM(detected)",
+	)
+	NormalizedTable = NewTable("apps_normalized", inhuman.NormalizedApp{},
+		"ENGINE = ReplacingMergeTree(datetime) ORDER BY bundle",
+		"datetime DateTime DEFAULT now()",
+	)
+)
+
+// Names return comma separated names of table columns
+func (t *Table) Names() string {
+	names := make([]string, len(t.Columns))
+	for i, v := range t.Columns {
+		names[i] = v.Name
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Insert return insert query with placeholders for all columns
+func (t *Table) Insert() string {
+	return fmt.Sprintf("insert into %s (%s) values (%s)", t.Name, t.Names(), placeholders(len(t.Columns)))
+}
+
+// DDL return create table query
+func (t *Table) DDL() string {
+	columns := make([]string, 0, len(t.Columns)+len(t.Extra))
+	for _, v := range t.Columns {
+		columns = append(columns, fmt.Sprintf("    %s %s", v.Name, v.Type))
+	}
+	for _, v := range t.Extra {
+		columns = append(columns, "    "+v)
+	}
+
+	return fmt.Sprintf("create table if not exists %s\n(\n%s\n)   %s", t.Name, strings.Join(columns, ",\n"), t.Engine)
+}
+
+// Values return values of entity fields in the order of columns
+// @params
+//	entity: interface{} (struct or pointer to struct of the table type)
+// @return
+//	[]interface{}
+func (t *Table) Values(entity interface{}) []interface{} {
+	v := t.value(entity)
+	values := make([]interface{}, len(t.Columns))
+	for i, c := range t.Columns {
+		values[i] = v.FieldByIndex(c.index).Interface()
+	}
+
+	return values
+}
+
+// Args return values of entity fields converted to query arguments
+// in the order of columns
+// @params
+//	entity: interface{} (struct or pointer to struct of the table type)
+// @return
+//	[]interface{}
+func (t *Table) Args(entity interface{}) []interface{} {
+	values := t.Values(entity)
+	for i, c := range t.Columns {
+		values[i] = arg(c.Type, values[i])
+	}
+
+	return values
+}
+
+// Validate check that query arguments match columns of the table by number
+// and by clickhouse type, so the row which would break the insert of whole
+// batch is found before it is sent
+// @params
+//	args: []interface{} (arguments returned by Args)
+// @return
+//	error
+func (t *Table) Validate(args []interface{}) error {
+	if len(args) != len(t.Columns) {
+		return fmt.Errorf("table %s has %d columns, got %d values", t.Name, len(t.Columns), len(args))
+	}
+	for i, c := range t.Columns {
+		if !valid(c.Type, args[i]) {
+			return fmt.Errorf("column %s of type %s can not store %T", c.Name, c.Type, args[i])
+		}
+	}
+
+	return nil
+}
+
+// Dest return pointers to entity fields in the order of columns for scan
+// @params
+//	entity: interface{} (pointer to struct of the table type)
+// @return
+//	[]interface{}
+func (t *Table) Dest(entity interface{}) []interface{} {
+	v := t.value(entity)
+	dest := make([]interface{}, len(t.Columns))
+	for i, c := range t.Columns {
+		dest[i] = v.FieldByIndex(c.index).Addr().Interface()
+	}
+
+	return dest
+}
+
+// value return struct value of entity and panic if it has other type
+func (t *Table) value(entity interface{}) reflect.Value {
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	if v.Type() != t.entity {
+		panic(fmt.Sprintf("table %s can not map %s", t.Name, v.Type()))
+	}
+
+	return v
+}
+
+// arg convert value to the query argument of clickhouse type
+func arg(typ string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case []string:
+		return clickhouse.Array(v)
+	case []int64:
+		return clickhouse.Array(v)
+	case time.Time:
+		if strings.HasPrefix(typ, "Nullable") && v.IsZero() {
+			return nil
+		}
+		if strings.Contains(typ, "Date") && !strings.Contains(typ, "DateTime") {
+			return clickhouse.Date(v)
+		}
+	}
+
+	return value
+}
+
+// valid check if argument can be stored in column of clickhouse type
+func valid(typ string, value interface{}) bool {
+	if strings.HasPrefix(typ, "Nullable(") {
+		if value == nil {
+			return true
+		}
+		typ = strings.TrimSuffix(strings.TrimPrefix(typ, "Nullable("), ")")
+	}
+	switch {
+	case strings.HasPrefix(typ, "Array("):
+		_, ok := value.(driver.Valuer)
+		return ok
+	case typ == "Date":
+		_, ok := value.(driver.Valuer)
+		return ok
+	case strings.HasPrefix(typ, "DateTime"):
+		_, ok := value.(time.Time)
+		return ok
+	case typ == "String":
+		_, ok := value.(string)
+		return ok
+	case typ == "Int64":
+		switch value.(type) {
+		case int64, int:
+			return true
+		}
+	case typ == "Float64":
+		_, ok := value.(float64)
+		return ok
+	case typ == "UInt8":
+		switch value.(type) {
+		case bool, uint8:
+			return true
+		}
+	default:
+		return value != nil
+	}
+
+	return false
+}
+
+// columnType return clickhouse type of go type
+func columnType(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return "DateTime"
+	case t.Kind() == reflect.Slice:
+		return fmt.Sprintf("Array(%s)", columnType(t.Elem()))
+	case t.Kind() == reflect.String:
+		return "String"
+	case t.Kind() == reflect.Int64, t.Kind() == reflect.Int:
+		return "Int64"
+	case t.Kind() == reflect.Float64:
+		return "Float64"
+	case t.Kind() == reflect.Bool:
+		return "UInt8"
+	default:
+		panic(fmt.Sprintf("unsupported column type %s", t))
+	}
+}
+
+// columns return columns of all tagged fields of struct type
+func columns(t reflect.Type, parent []int) []Column {
+	result := make([]Column, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("db")
+		if !ok || tag == "-" {
+			continue
+		}
+		index := append(append([]int{}, parent...), i)
+
+		parts := strings.SplitN(tag, ",", 2)
+		if parts[0] == "" && len(parts) == 2 && parts[1] == "inline" {
+			result = append(result, columns(f.Type, index)...)
+			continue
+		}
+		c := Column{Name: parts[0], index: index}
+		if len(parts) == 2 {
+			c.Type = parts[1]
+		} else {
+			c.Type = columnType(f.Type)
+		}
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// Create new table mapping of entity struct
+// @params
+//	name: string (name of table)
+//	entity: interface{} (struct with db tags)
+//	engine: string (engine part of the table definition)
+//	extra: ...string (definitions of columns which are not mapped to entity fields)
+// @return
+//	*Table
+func NewTable(name string, entity interface{}, engine string, extra ...string) *Table {
+	t := reflect.TypeOf(entity)
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("table %s entity must be struct", name))
+	}
+
+	return &Table{
+		Name:    name,
+		Columns: columns(t, nil),
+		Extra:   extra,
+		Engine:  engine,
+		entity:  t,
+	}
+}
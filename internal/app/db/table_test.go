@@ -0,0 +1,157 @@
+package db_test
+
+import (
+	"Nani/internal/app/db"
+	"Nani/internal/app/inhuman"
+	"github.com/mailru/go-clickhouse"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	createTable = regexp.MustCompile(`(?s)^create table if not exists (\w+)\s*\((.*)\)\s+(ENGINE.*)$`)
+	createAs    = regexp.MustCompile(`(?s)^create table if not exists (\w+) as (\w+)\s+(ENGINE.*)$`)
+	alterTable  = regexp.MustCompile(`^alter table (\w+)`)
+	addColumn   = regexp.MustCompile(`add column if not exists (\S+)\s+(\S+)`)
+	renameTable = regexp.MustCompile(`^rename table (.*)$`)
+	renamePair  = regexp.MustCompile(`(\w+) to (\w+)`)
+	dropTable   = regexp.MustCompile(`^drop table if exists (\w+)$`)
+)
+
+// migratedTable is schema of table created by migrations
+type migratedTable struct {
+	columns map[string]string
+	engine  string
+}
+
+// parseTable return schema of table created by query
+func parseTable(query string) *migratedTable {
+	match := createTable.FindStringSubmatch(query)
+	if match == nil {
+		return nil
+	}
+	columns := make(map[string]string)
+	for _, line := range strings.Split(match[2], "\n") {
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), ","))
+		if len(fields) >= 2 {
+			columns[fields[0]] = fields[1]
+		}
+	}
+
+	return &migratedTable{columns: columns, engine: strings.Join(strings.Fields(match[3]), " ")}
+}
+
+// migratedSchema return schema of all tables after all migrations are applied
+func migratedSchema() map[string]*migratedTable {
+	schema := make(map[string]*migratedTable)
+	for _, m := range db.Migrations {
+		for _, q := range m.Up {
+			if match := createTable.FindStringSubmatch(q); match != nil {
+				schema[match[1]] = parseTable(q)
+			} else if match := createAs.FindStringSubmatch(q); match != nil {
+				columns := make(map[string]string)
+				for k, v := range schema[match[2]].columns {
+					columns[k] = v
+				}
+				schema[match[1]] = &migratedTable{columns: columns, engine: strings.Join(strings.Fields(match[3]), " ")}
+			} else if match := alterTable.FindStringSubmatch(q); match != nil {
+				for _, add := range addColumn.FindAllStringSubmatch(q, -1) {
+					schema[match[1]].columns[add[1]] = add[2]
+				}
+			} else if match := renameTable.FindStringSubmatch(q); match != nil {
+				for _, pair := range renamePair.FindAllStringSubmatch(match[1], -1) {
+					schema[pair[2]] = schema[pair[1]]
+					delete(schema, pair[1])
+				}
+			} else if match := dropTable.FindStringSubmatch(q); match != nil {
+				delete(schema, match[1])
+			}
+		}
+	}
+
+	return schema
+}
+
+func TestTables_ShouldMatchSchemaCreatedByMigrations_NoError(t *testing.T) {
+	schema := migratedSchema()
+	for _, table := range []*db.Table{db.AppsTable, db.ChangesTable, db.NormalizedTable} {
+		migrated, ok := schema[table.Name]
+		if !assert.True(t, ok, "migrations do not create table %s", table.Name) {
+			continue
+		}
+		ddl := parseTable(table.DDL())
+		assert.Equal(t, ddl.columns, migrated.columns, "columns of table %s", table.Name)
+		assert.Equal(t, ddl.engine, migrated.engine, "engine of table %s", table.Name)
+	}
+}
+
+func TestTableInsert_ShouldReturnQueryWithPlaceholderForEachColumn_NoError(t *testing.T) {
+	query := db.ChangesTable.Insert()
+
+	assert.Equal(t, "insert into app_changes (bundle, field, oldValue, newValue, detected) values (?, ?, ?, ?, ?)", query)
+	assert.Equal(t, len(db.AppsTable.Columns), strings.Count(db.AppsTable.Insert(), "?"))
+}
+
+func TestTableArgs_ShouldConvertValuesInOrderOfColumns_NoError(t *testing.T) {
+	app := App()
+	app.DeveloperContacts.Domain = "example.com"
+	args := db.AppsTable.Args(app)
+
+	assert.Len(t, args, len(db.AppsTable.Columns))
+	assert.Equal(t, app.Bundle, args[0])
+	assert.Equal(t, clickhouse.Array(app.Screenshots), args[7])
+	assert.Equal(t, app.PrivacyPolicy, args[len(args)-1])
+	assert.Contains(t, args, "example.com")
+
+	n := db.NormalizedTable.Args(&inhuman.NormalizedApp{Bundle: "com.ky", LastUpdateDate: time.Date(2020, 7, 29, 0, 0, 0, 0, time.UTC)})
+	assert.Nil(t, n[7])
+	assert.Equal(t, clickhouse.Date(time.Date(2020, 7, 29, 0, 0, 0, 0, time.UTC)), n[8])
+}
+
+func TestTableValidate_ShouldAcceptArgsOfColumnTypes_NoError(t *testing.T) {
+	assert.NoError(t, db.AppsTable.Validate(db.AppsTable.Args(App())))
+	assert.NoError(t, db.NormalizedTable.Validate(db.NormalizedTable.Args(&inhuman.NormalizedApp{Bundle: "com.ky"})))
+}
+
+func TestTableValidate_ShouldRejectWrongNumberOrTypeOfArgs_Error(t *testing.T) {
+	args := db.AppsTable.Args(App())
+	assert.Error(t, db.AppsTable.Validate(args[1:]))
+
+	args[0] = nil
+	assert.Error(t, db.AppsTable.Validate(args))
+
+	args = db.AppsTable.Args(App())
+	args[7] = []string{"1"}
+	assert.Error(t, db.AppsTable.Validate(args))
+}
+
+func TestTableDest_ShouldReturnPointersToFields_NoError(t *testing.T) {
+	app := &inhuman.App{}
+	dest := db.AppsTable.Dest(app)
+	*(dest[0].(*string)) = "com.ky"
+	*(dest[len(dest)-2].(*string)) = "contacts"
+
+	assert.Equal(t, "com.ky", app.Bundle)
+	assert.Equal(t, "contacts", app.DeveloperContacts.Contacts)
+}
+
+func TestTableDDL_ShouldCreateTableWithMappedColumns_NoError(t *testing.T) {
+	ddl := db.NormalizedTable.DDL()
+
+	assert.True(t, strings.HasPrefix(ddl, "create table if not exists apps_normalized"))
+	assert.Contains(t, ddl, "releaseDate Nullable(Date)")
+	assert.Contains(t, ddl, "ratingHistogram Array(Int64)")
+	assert.Contains(t, ddl, "datetime DateTime DEFAULT now()")
+}
+
+func TestNewTable_ShouldPanicCozEntityIsNotStruct_Error(t *testing.T) {
+	assert.Panics(t, func() {
+		db.NewTable("bad", "string", "")
+	})
+	assert.Panics(t, func() {
+		db.AppsTable.Values(inhuman.Change{})
+	})
+}
@@ -2,10 +2,8 @@ package db
 
 import (
 	config2 "Nani/internal/app/config"
-	"Nani/internal/app/file"
 	"database/sql"
 	"errors"
-	"strings"
 	"time"
 )
 
@@ -50,30 +48,3 @@ func Connect(url string) (*sql.DB, error) {
 
 	return connect, nil
 }
-
-func InitSchema(connection *sql.DB, schemafile string) error {
-	f := file.New(schemafile)
-	b, err := f.ReadAll()
-	if err != nil {
-		return err
-	}
-	schema := string(b)
-	tables := strings.Split(schema, ";\n")
-
-	for _, v := range tables {
-		_, err = connection.Exec(v)
-		if err != nil {
-			if strings.Contains(err.Error(), "Code: 57") {
-				newsql := strings.ReplaceAll(v,"CREATE TABLE", "ATTACH TABLE")
-				if _, err = connection.Exec(newsql); err != nil {
-					return err
-				}
-			} else {
-				return err
-			}
-		}
-	}
-
-
-	return nil
-}
@@ -3,6 +3,7 @@ package db_test
 import (
 	config2 "Nani/internal/app/config"
 	"Nani/internal/app/db"
+	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -14,7 +15,6 @@ func TestConnectionUrl_ShouldReturnRightUrl_NoErrors(t *testing.T) {
 		Password: "123456",
 		Address:  "192.168.99.100",
 		Port:     "8123",
-		Schema:   "",
 	}
 
 	url, err := db.ConnectionUrl(config)
@@ -29,7 +29,6 @@ func TestConnectionUrl_ShouldReturnUrlWithoutUserAndPass_NoError(t *testing.T) {
 		Password: "",
 		Address:  "192.168.99.100",
 		Port:     "8123",
-		Schema:   "",
 	}
 
 	url, err := db.ConnectionUrl(config)
@@ -44,7 +43,6 @@ func TestConnectionUrl_ShouldReturnErrorCozAddressIsEmpty_Error(t *testing.T) {
 		Password: "123456",
 		Address:  "",
 		Port:     "8123",
-		Schema:   "",
 	}
 
 	url, err := db.ConnectionUrl(config)
@@ -60,7 +58,6 @@ func TestConnectionUrl_ShouldReturnErrorCozPortIsEmpty_Error(t *testing.T) {
 		Password: "123456",
 		Address:  "192.168.99.100",
 		Port:     "",
-		Schema:   "",
 	}
 
 	url, err := db.ConnectionUrl(config)
@@ -76,7 +73,6 @@ func TestConnectionUrl_ShouldReturnDefaultDbIfNoPresented_NoError(t *testing.T)
 		Password: "123456",
 		Address:  "192.168.99.100",
 		Port:     "8123",
-		Schema:   "",
 	}
 
 	url, err := db.ConnectionUrl(config)
@@ -89,7 +85,6 @@ func TestConnect_ShouldEstablishNewConnectionToDatabase_NoError(t *testing.T) {
 		Password: "123456",
 		Address:  "192.168.99.100",
 		Port:     "8123",
-		Schema:   "",
 	}
 	url, err := db.ConnectionUrl(config)
 	t.Log(url)
@@ -103,7 +98,6 @@ func TestConnect_ShouldReturnErrorCozDbCanNotEstablishConnection_NoError(t *test
 	config := config2.DBConfig{
 		Address:  "192.168.99.101",
 		Port:     "8123",
-		Schema:   "",
 	}
 	url, err := db.ConnectionUrl(config)
 	assert.NoError(t, err)
@@ -112,11 +106,10 @@ func TestConnect_ShouldReturnErrorCozDbCanNotEstablishConnection_NoError(t *test
 	assert.Nil(t, conn)
 }
 
-func TestInitSchema_ShouldCreateNewTableInDatabase_NoError(t *testing.T) {
+func TestMigrate_ShouldCreateNewTableInDatabase_NoError(t *testing.T) {
 	config := config2.DBConfig{
 		Address:  "192.168.99.100",
 		Port:     "8123",
-		Schema:   "",
 	}
 	url, err := db.ConnectionUrl(config)
 	assert.NoError(t, err)
@@ -124,12 +117,13 @@ func TestInitSchema_ShouldCreateNewTableInDatabase_NoError(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, conn)
 
-	err = db.InitSchema(conn, "../../../config/schema.sql")
+	_, err = db.NewMigrator(conn).Up(context.Background(), false)
 	assert.NoError(t, err)
 
 	_, err = conn.Exec(`select * from apps`)
 	assert.NoError(t, err)
 	_, err = conn.Exec("drop table apps")
 	assert.NoError(t, err)
+	_, err = conn.Exec("drop table schema_migrations")
+	assert.NoError(t, err)
 }
-
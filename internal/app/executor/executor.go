@@ -6,13 +6,18 @@ import (
 	"Nani/internal/app/db"
 	"Nani/internal/app/file"
 	"Nani/internal/app/inhuman"
+	"Nani/internal/app/keywords"
+	"Nani/internal/app/notify"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	murlog "github.com/Melenium2/Murlog"
 	"math"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,18 +34,46 @@ type Executor struct {
 	cache       cache.Storage
 	ctx         context.Context
 	repository  db.AppRepository
+	changes     db.ChangeRepository
+	normalized  db.NormalizedRepository
+	schema      db.SchemaChecker
+	notifier    notify.Notifier
 	keyCache    cache.KeyStorage
+	filter      *keywords.Filter
+	extractor   keywords.Extractor
+	local       *keywords.Local
 	config      config.Config
 	db          databaseCh
 	wait        chan struct{}
-	cancel      bool
 	logger      murlog.Logger
+	started     time.Time
+	// Set to 1 when scraping is stopped, read by parallel workers
+	cancel int32
+	// No run was finished before, stored apps are not new for watchlist
+	seeding bool
 }
 
+// Cache key of time when the first run was finished, apps found after it
+// are notified as new
+const seededKey = "_watch_seeded"
+
+// Number of applications inserted by one batch
+const batchSize = 50
+
 // Scrap starting scraping all apps from scrapfile until error or
 // cancel of scraping
 func (ex *Executor) Scrap(ctx context.Context, scrapfile string) error {
 	ex.ctx = ctx
+	ex.started = time.Now()
+	if _, err := ex.cache.GetV(seededKey); err != nil {
+		ex.seeding = true
+	}
+
+	if ex.schema != nil {
+		if err := ex.schema.CheckSchema(ctx); err != nil {
+			return err
+		}
+	}
 
 	err := ex.declareTask(scrapfile)
 	if err != nil {
@@ -48,33 +81,32 @@ func (ex *Executor) Scrap(ctx context.Context, scrapfile string) error {
 	}
 	go ex.selector()
 	go ex.appsBatch()
+	if ex.notifier != nil {
+		go ex.notifier.Redeliver()
+	}
 
-	last, _ := ex.cache.GetV("last")
-	cachedBundles, err := ex.cache.GetV("bundles")
-	if err != nil {
+	var last string
+	ex.cache.Get("last", &last)
+	var bundles []string
+	if err := ex.cache.Get("bundles", &bundles); err != nil {
 		return err
 	}
-	bundles, ok := cachedBundles.([]string)
 	startAt := 0
 	ex.logger.Log("last bundle", last)
-	if last != nil {
-		l := last.(string)
+	if last != "" {
 		for i, b := range bundles {
-			if b == l {
+			if b == last {
 				startAt = i
 			}
 		}
 	}
-	if !ok {
-		return errors.New("can not convert bundles")
-	}
 
 	ex.storeApps(true, bundles[startAt:]...)
-	if err := ex.keyCache.Distinct(); err != nil {
-		return err
-	}
 
 	<-ex.wait
+	if ex.seeding && !ex.canceled() {
+		ex.cache.Set(seededKey, time.Now())
+	}
 
 	return nil
 }
@@ -109,8 +141,18 @@ func (ex *Executor) declareTask(path string) error {
 //	withKeys: bool (store keywords from app or not)
 //	bundles: ...string (bundles for scraping)
 func (ex *Executor) storeApps(withKeys bool, bundles ...string) {
+	ex.storeAppsAt(0, withKeys, bundles...)
+}
+
+// storeAppsAt store applications found at depth. Cursor of seed list is
+// moved only by seed applications
+// @params
+//	depth: int (hops from the seed list, seed apps have depth 0)
+//	withKeys: bool (store keywords from app or not)
+//	bundles: ...string (bundles for scraping)
+func (ex *Executor) storeAppsAt(depth int, withKeys bool, bundles ...string) {
 	for i, v := range bundles {
-		if ex.cancel {
+		if ex.canceled() {
 			break
 		}
 
@@ -118,38 +160,62 @@ func (ex *Executor) storeApps(withKeys bool, bundles ...string) {
 		if err != nil {
 			ex.logger.Log("log", err, "Bundle", v)
 			ex.saveError("apps", v, fmt.Errorf("error in external api method App() %s", err))
+			if inhuman.IsNotFound(err) {
+				ex.notify(notify.Event{Type: notify.Delisted, Bundle: v, DeveloperId: ex.developer(v), Detected: time.Now()})
+			}
 		} else {
+			if err := app.ValidateContacts(); err != nil {
+				ex.saveError("contacts", v, err)
+			}
 			ex.db <- app
 			if withKeys {
-				go ex.storeKeywords(app)
+				go ex.storeKeywords(app, depth+1)
+			}
+			if withKeys && depth == 0 {
 				ex.cache.Set("last", bundles[i])
 			}
 		}
 	}
 }
 
-// storeKeywords method fetching top keywords from external api and store their to db
+// storeKeywords method fetching top keywords from extractor, external api by default, and store their to db
 // @params
 //	app: *inhuman.App (application)
-func (ex *Executor) storeKeywords(app *inhuman.App) {
-	if ex.cancel {
+//	depth: int (depth of keywords, one more than depth of app)
+func (ex *Executor) storeKeywords(app *inhuman.App, depth int) {
+	if ex.canceled() {
 		return
 	}
 
-	keys, err := ex.externalApi.Keys(app.Title, app.Description, app.ShortDescription, "")
+	var extractor keywords.Extractor = ex.externalApi
+	if ex.extractor != nil {
+		extractor = ex.extractor
+	}
+	keys, err := extractor.Keys(app.Title, app.Description, app.ShortDescription, "")
 	if err != nil {
 		ex.logger.Log("log", err)
 		ex.saveError("keys", app.Bundle, fmt.Errorf("error in external method Keys() %s", err))
 	}
-	ex.db <- keys
+	ex.db <- appKeywords{bundle: app.Bundle, depth: depth, locale: ex.locale(), keys: keys}
+}
+
+// locale return locale of api requests, like ru-RU
+func (ex *Executor) locale() string {
+	if ex.config.Gl == "" {
+		return ex.config.Hl
+	}
+
+	return ex.config.Hl + "-" + strings.ToUpper(ex.config.Gl)
 }
 
 // storeDevApps method fetching developer application by their id
-// and then pass bundles of apps to the storeApps method
+// and then pass bundles of apps to the storeAppsAt method. Keywords of apps
+// are stored while they are not deeper than config.Keywords.MaxDepth
 // @params
+//	depth: int (depth of keyword which found developers)
 //	devid []string (slice of developers ids)
-func (ex *Executor) storeDevApps(devid ...string) {
-	if ex.cancel {
+func (ex *Executor) storeDevApps(depth int, devid ...string) {
+	if ex.canceled() {
 		return
 	}
 
@@ -159,8 +225,17 @@ func (ex *Executor) storeDevApps(devid ...string) {
 			ex.logger.Log("log", err)
 			ex.saveError("devapps", v, fmt.Errorf("error in storeDevApps() method %v", err))
 		}
-		ex.storeApps(false, bundles...)
+		ex.storeAppsAt(depth, depth < ex.maxDepth(), bundles...)
+	}
+}
+
+// maxDepth return the deepest depth of queued keywords
+func (ex *Executor) maxDepth() int {
+	if ex.config.Keywords.MaxDepth < 1 {
+		return 1
 	}
+
+	return ex.config.Keywords.MaxDepth
 }
 
 // getDevApps get developer applications by concrete id
@@ -170,6 +245,12 @@ func (ex *Executor) storeDevApps(devid ...string) {
 // 	[]string slice of apps bundles
 // 	error Error
 func (ex *Executor) getDevApps(devid string) ([]string, error) {
+	key := "_devapps_" + devid
+	var cached []string
+	if err := ex.cache.Get(key, &cached); err == nil {
+		return cached, nil
+	}
+
 	apps, err := ex.externalApi.DevApps(devid)
 	if err != nil {
 		return nil, err
@@ -178,6 +259,9 @@ func (ex *Executor) getDevApps(devid string) ([]string, error) {
 	for i, v := range apps {
 		bundles[i] = v.Bundle
 	}
+	if ex.config.Cache.DevAppsTTL > 0 {
+		ex.cache.SetWithTTL(key, bundles, ex.config.Cache.DevAppsTTL)
+	}
 	return bundles, nil
 }
 
@@ -187,93 +271,404 @@ func (ex *Executor) getDevApps(devid string) ([]string, error) {
 // 	Er: string (error representation)
 // 	Bundle: string (Bundle where error occurred)
 func (ex *Executor) saveError(t, bundle string, er error) {
-	e, err := ex.cache.GetV("_errors")
-	if err != nil {
+	if err := ex.cache.Append("_errors", ExecutorError{t, er.Error(), bundle}); err != nil {
 		ex.logger.Log("log", err)
-		ex.cache.Set("_errors", []ExecutorError{{t, er.Error(), bundle}})
-		return
 	}
-	appErrorsInts, _ := json.Marshal(e)
-	var appErrors []ExecutorError
-	json.Unmarshal(appErrorsInts, &appErrors)
-	appErrors = append(appErrors, ExecutorError{t, er.Error(), bundle})
-	ex.cache.Set("_errors", appErrors)
 }
 
 // selector main loop of channels
 func (ex *Executor) selector() {
 	apps := make([]*inhuman.App, 0)
+	// Batch which failed is kept and retried when next batchSize apps are added
+	limit := batchSize
 
 	for t := range ex.db {
 		switch data := t.(type) {
 		case *inhuman.App:
+			if ex.local != nil {
+				ex.local.Learn(data.Title, data.Description, data.ShortDescription, "")
+			}
 			apps = append(apps, data)
-			if len(apps) > 50 {
-				err := ex.repository.InsertBatch(ex.ctx, apps)
-				if err != nil {
-					ex.logger.Log("log", err)
-					ex.saveError("Db", "", err)
-					continue
+			if len(apps) > limit {
+				if ex.storeBatch(apps) {
+					apps, limit = nil, batchSize
+				} else {
+					limit = len(apps) + batchSize
 				}
-				apps = nil
 			}
+		case appKeywords:
+			ex.queueKeywords(data)
 		case inhuman.Keywords:
-			s := int(math.Min(float64(ex.config.KeysCount), float64(len(data))))
-			keys := SortKeywords(data)[:s]
-			for _, k := range keys {
-				err := ex.keyCache.Set(k)
-				if err != nil {
-					ex.logger.Log("log", err)
-					ex.saveError("keyCache", "", err)
-				}
-			}
+			ex.queueKeywords(appKeywords{locale: ex.locale(), keys: data})
 		}
 	}
 
-	for _, app := range apps {
-		err := ex.repository.Insert(ex.ctx, app)
+	ex.storeBatch(apps)
+
+	if c, ok := ex.repository.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			ex.logger.Log("log", err)
+		}
+	}
+	if f, ok := ex.repository.(*db.FanOut); ok {
+		for _, s := range f.Stats() {
+			ex.logger.Log("sink", s.Name, "written", s.Written, "failed", s.Failed, "dropped", s.Dropped, "retries", s.Retries)
+		}
+	}
+	if ex.notifier != nil {
+		ex.notifier.Close()
+	}
+	ex.saveReport()
+}
+
+// queueKeywords filter and normalize the strongest keywords of application
+// and add them to the keyword queue with their provenance
+func (ex *Executor) queueKeywords(data appKeywords) {
+	s := int(math.Min(float64(ex.config.KeysCount), float64(len(data.keys))))
+	keys := SortKeywords(data.keys)[:s]
+	if data.depth > ex.maxDepth() {
+		return
+	}
+	var sources []string
+	if data.bundle != "" {
+		sources = []string{data.bundle}
+	}
+	locale := data.locale
+	if locale == "" {
+		locale = ex.locale()
+	}
+	lang := strings.SplitN(locale, "-", 2)[0]
+	now := time.Now()
+	for _, k := range keys {
+		if ex.filter != nil && !ex.filter.Allow(k) {
+			continue
+		}
+		norm := keywords.Normalize(k, lang)
+		if norm == "" {
+			continue
+		}
+		err := ex.keyCache.Add(cache.Keyword{
+			Key:     strings.TrimSpace(k),
+			Norm:    norm,
+			Forms:   []string{k},
+			Sources: sources,
+			Weight:  data.keys[k],
+			Locale:  locale,
+			Depth:   data.depth,
+			Seen:    now,
+		})
 		if err != nil {
 			ex.logger.Log("log", err)
-			ex.saveError("Db", "", err)
+			ex.saveError("keyCache", "", err)
+		}
+	}
+}
+
+// storeBatch save applications with their changes and normalized records.
+// Changes are detected against snapshots read before insert, changes and
+// normalized records are saved only for stored applications
+// @params
+//	apps: []*inhuman.App (applications for insert)
+// @return
+//	bool (false if batch was not stored and must be retried)
+func (ex *Executor) storeBatch(apps []*inhuman.App) bool {
+	if len(apps) == 0 {
+		return true
+	}
+
+	last := ex.snapshots(apps)
+	stored, err := ex.insertBatch(apps)
+	if err != nil {
+		return false
+	}
+	ex.trackChanges(stored, last)
+	ex.storeNormalized(stored)
+
+	return true
+}
+
+// insertBatch save applications to the repository. If some rows of the batch
+// failed, they are retried once and rows which failed again are saved as
+// errors. Secondary sinks get only rows accepted by the primary repository,
+// so retried rows are passed to them once. If the whole batch failed, like when connection is lost, error is saved for each row and
+// returned, so the batch can be retried
+// @params
+//	apps: []*inhuman.App (applications for insert)
+// @return
+//	[]*inhuman.App (stored applications)
+//	error (batch is not stored)
+func (ex *Executor) insertBatch(apps []*inhuman.App) ([]*inhuman.App, error) {
+	if len(apps) == 0 {
+		return apps, nil
+	}
+
+	err := ex.repository.InsertBatch(ex.ctx, apps)
+	if err == nil {
+		return apps, nil
+	}
+	ex.logger.Log("log", err)
+
+	var batch *db.BatchError
+	if !errors.As(err, &batch) {
+		for _, v := range apps {
+			ex.saveError("Db", v.Bundle, err)
+		}
+		return nil, err
+	}
+
+	failed := batch.Apps()
+	err = ex.repository.InsertBatch(ex.ctx, failed)
+	if err != nil && !errors.As(err, &batch) {
+		batch = &db.BatchError{Rows: make([]db.RowError, len(failed))}
+		for i, v := range failed {
+			batch.Rows[i] = db.RowError{Index: i, App: v, Err: err}
+		}
+	}
+
+	lost := make(map[*inhuman.App]struct{})
+	if err != nil {
+		for _, row := range batch.Rows {
+			lost[row.App] = struct{}{}
+			ex.saveError("Db", row.App.Bundle, row.Err)
+		}
+	}
+
+	stored := make([]*inhuman.App, 0, len(apps))
+	for _, v := range apps {
+		if _, ok := lost[v]; !ok {
+			stored = append(stored, v)
+		}
+	}
+
+	return stored, nil
+}
+
+// snapshots return the last stored snapshots of applications. Nil is
+// returned if changes are not tracked or snapshots can not be read
+// @params
+//	apps: []*inhuman.App (applications before insert)
+// @return
+//	map[string]*inhuman.App (snapshots by bundle)
+func (ex *Executor) snapshots(apps []*inhuman.App) map[string]*inhuman.App {
+	if ex.changes == nil || len(apps) == 0 {
+		return nil
+	}
+
+	bundles := make([]string, len(apps))
+	for i, v := range apps {
+		bundles[i] = v.Bundle
+	}
+	last, err := ex.changes.Snapshots(ex.ctx, Unique(bundles...))
+	if err != nil {
+		ex.logger.Log("log", err)
+		ex.saveError("changes", "", err)
+		return nil
+	}
+
+	return last
+}
+
+// developer return developer id of the last stored snapshot of application,
+// so events of application which is not available anymore are matched by
+// watched developers. Empty id is returned if application is not stored
+func (ex *Executor) developer(bundle string) string {
+	if ex.notifier == nil || ex.changes == nil {
+		return ""
+	}
+
+	last, err := ex.changes.Snapshots(ex.ctx, []string{bundle})
+	if err != nil {
+		ex.logger.Log("log", err, "Bundle", bundle)
+		return ""
+	}
+	if app, ok := last[bundle]; ok {
+		return app.DeveloperId
+	}
+
+	return ""
+}
+
+// trackChanges compares stored applications with their snapshots read
+// before insert and save detected field changes. Apps without snapshot are
+// not notified as new until the first run is finished, so the initial seed
+// is silent
+// @params
+//	apps: []*inhuman.App (stored applications)
+//	last: map[string]*inhuman.App (snapshots before insert)
+func (ex *Executor) trackChanges(apps []*inhuman.App, last map[string]*inhuman.App) {
+	if last == nil || len(apps) == 0 {
+		return
+	}
+
+	now := time.Now()
+	changes := make([]inhuman.Change, 0)
+	for _, app := range apps {
+		prev, ok := last[app.Bundle]
+		if ok {
+			diff := prev.Diff(*app, now)
+			changes = append(changes, diff...)
+			ex.notifyChanges(app, diff)
+		} else if !ex.seeding {
+			ex.notify(notify.Event{Type: notify.NewApp, Bundle: app.Bundle, DeveloperId: app.DeveloperId, Detected: now})
+		}
+		last[app.Bundle] = app
+	}
+
+	if err := ex.changes.InsertChanges(ex.ctx, changes); err != nil {
+		ex.logger.Log("log", err)
+		ex.saveError("changes", "", err)
+	}
+}
+
+// storeNormalized parse string fields of applications and save
+// typed records. Fields which can not be parsed are saved as errors
+// @params
+//	apps: []*inhuman.App (stored applications)
+func (ex *Executor) storeNormalized(apps []*inhuman.App) {
+	if ex.normalized == nil || len(apps) == 0 {
+		return
+	}
+
+	records := make([]*inhuman.NormalizedApp, len(apps))
+	for i, app := range apps {
+		n, err := inhuman.Normalize(app, ex.config.Hl)
+		if err != nil {
+			ex.saveError("normalize", app.Bundle, err)
+		}
+		records[i] = n
+	}
+
+	if err := ex.normalized.InsertNormalized(ex.ctx, records); err != nil {
+		ex.logger.Log("log", err)
+		ex.saveError("normalize", "", err)
+	}
+}
+
+// notifyChanges send watchlist events about version and price changes
+// @params
+//	app: *inhuman.App (changed application)
+//	changes: []inhuman.Change (detected changes)
+func (ex *Executor) notifyChanges(app *inhuman.App, changes []inhuman.Change) {
+	for _, c := range changes {
+		var t string
+		switch c.Field {
+		case "version":
+			t = notify.NewVersion
+		case "price":
+			t = notify.PriceChange
+		default:
 			continue
 		}
+		ex.notify(notify.Event{
+			Type:        t,
+			Bundle:      app.Bundle,
+			DeveloperId: app.DeveloperId,
+			Old:         c.Old,
+			New:         c.New,
+			Detected:    c.Detected,
+		})
+	}
+}
+
+// notify send event if application or developer is in watchlist
+func (ex *Executor) notify(event notify.Event) {
+	if ex.notifier == nil || !ex.notifier.Watched(event.Bundle, event.DeveloperId) {
+		return
 	}
+
+	ex.notifier.Notify(event)
 }
 
-// AppsBatch scrap new applications while keys still remain
+// AppsBatch scrap new applications while keys still remain.
+// Keywords are expanded by config.Keywords.Workers parallel workers
 func (ex *Executor) appsBatch() {
-	for !ex.cancel {
-		key, err := ex.keyCache.Next()
+	workers := ex.config.Keywords.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ex.keywordWorker()
+		}()
+	}
+	wg.Wait()
+	ex.wait <- struct{}{}
+}
+
+// keywordWorker lease keywords and expand them until queue is over
+func (ex *Executor) keywordWorker() {
+	for !ex.canceled() {
+		leases, err := ex.keyCache.Lease(ex.config.Keywords.Lease)
 		if err != nil {
 			ex.logger.Log("appBatch", err)
 			time.Sleep(time.Second * 5)
-			if err.Error() == "keywords are out of range" {
+			if err == cache.ErrKeywordsOutOfRange {
 				break
 			}
 			continue
 		}
-		ex.logger.Log("next key", key)
-		res, err := ex.externalApi.Flow(key)
-		if err != nil {
-			ex.logger.Log("log", err)
-			ex.saveError("keys", key, err)
-			ex.keyCache.Rollback()
-			continue
-		}
-		devids := make([]string, len(res))
-		for i := 0; i < len(devids); i++ {
-			devids[i] = res[i].DeveloperId
+		for _, l := range leases {
+			if ex.canceled() {
+				// Keyword returns to the queue after visibility timeout
+				break
+			}
+			if err := ex.expandKeyword(l.Key, l.Depth); err != nil {
+				ex.keyCache.Nack(l)
+				continue
+			}
+			ex.keyCache.Ack(l)
 		}
+	}
+}
 
-		ex.storeDevApps(Unique(devids...)...)
+// expandKeyword store applications of developers found by keyword
+// @params
+//	key: string (keyword)
+//	depth: int (depth of keyword, keyword without provenance has depth 1)
+// @return
+//	error (error of flow request, keyword should be retried)
+func (ex *Executor) expandKeyword(key string, depth int) error {
+	ex.logger.Log("next key", key)
+	throttle := "_flow_" + key
+	if _, err := ex.cache.GetV(throttle); err == nil {
+		ex.logger.Log("skip key", key)
+		return nil
 	}
-	ex.wait <- struct{}{}
+	res, err := ex.externalApi.Flow(key)
+	if err != nil {
+		ex.logger.Log("log", err)
+		ex.saveError("keys", key, err)
+		return err
+	}
+	if ex.config.Cache.FlowTTL > 0 {
+		ex.cache.SetWithTTL(throttle, true, ex.config.Cache.FlowTTL)
+	}
+	devids := make([]string, len(res))
+	for i := 0; i < len(devids); i++ {
+		devids[i] = res[i].DeveloperId
+	}
+
+	if depth < 1 {
+		depth = 1
+	}
+	ex.storeDevApps(depth, Unique(devids...)...)
+
+	return nil
+}
+
+// canceled reports whether scraping is stopped
+func (ex *Executor) canceled() bool {
+	return atomic.LoadInt32(&ex.cancel) == 1
 }
 
 // Stop scraping
 func (ex *Executor) Stop() {
 	ex.logger.Log("log", "Starting stopping application")
-	ex.cancel = true
+	atomic.StoreInt32(&ex.cancel, 1)
 	<-ex.wait
 	ex.wait <- struct{}{}
 	time.Sleep(time.Second * 3)
@@ -281,21 +676,90 @@ func (ex *Executor) Stop() {
 	ex.logger.Log("log", "Closing")
 }
 
-// Create new instance of Executor
-func New(api inhuman.ExternalApi, storage cache.Storage, config config.Config) *Executor {
+// Create new instance of Executor. Returns error if config is invalid
+// @params
+//	api: inhuman.ExternalApi
+//	storage: cache.Storage (storage of the job)
+//	config: config.Config
+// @return
+//	*Executor
+//	error
+func New(api inhuman.ExternalApi, storage cache.Storage, config config.Config) (*Executor, error) {
 	mConfig := murlog.NewConfig()
 	mConfig.CallerPref()
 	mConfig.TimePref(time.RFC1123)
 
+	logger := murlog.NewLogger(mConfig)
+	var extractor keywords.Extractor = api
+	var local *keywords.Local
+	switch config.Keywords.Extractor {
+	case "", "api":
+	case "local":
+		local = keywords.NewLocal(config.Hl, config.KeysCount)
+		extractor = local
+	case "fallback":
+		local = keywords.NewLocal(config.Hl, config.KeysCount)
+		extractor = keywords.NewFallback(api, local, func(err error) {
+			logger.Log("log", fmt.Errorf("error in external method Keys(), local extractor is used %s", err))
+		})
+	default:
+		return nil, fmt.Errorf("unknown keyword extractor %s", config.Keywords.Extractor)
+	}
+	filter, err := keywords.NewFilter(config.Keywords)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := db.Open(config.Database)
+	if err != nil {
+		return nil, err
+	}
+	changes, _ := primary.(db.ChangeRepository)
+	normalized, _ := primary.(db.NormalizedRepository)
+	schema, _ := primary.(db.SchemaChecker)
+	repository := primary
+	if len(config.Sinks) > 0 {
+		fanout := db.NewFanOut(primary)
+		for _, s := range config.Sinks {
+			name := s.Database.Driver
+			if s.Database.File.Path != "" {
+				name += ":" + s.Database.File.Path
+			}
+			sink, err := db.Open(s.Database)
+			if err != nil {
+				return nil, fmt.Errorf("sink %s: %s", name, err)
+			}
+			fanout.AddSink(name, sink, s.Buffer, s.Retries)
+		}
+		repository = fanout
+	}
+	keyCache := cache.NewKeyCache(storage)
+	if config.Keywords.Visibility > 0 {
+		keyCache.Visibility = config.Keywords.Visibility
+	}
+	if config.Keywords.MaxAttempts > 0 {
+		keyCache.MaxAttempts = config.Keywords.MaxAttempts
+	}
+	var notifier notify.Notifier
+	if len(config.Watch.Webhooks) > 0 {
+		notifier = notify.New(config.Watch, storage)
+	}
+
 	return &Executor{
 		externalApi: api,
 		cache:       storage,
-		keyCache:    cache.NewKeyCache(storage),
-		repository:  db.New(config.Database),
+		keyCache:    keyCache,
+		filter:      filter,
+		extractor:   extractor,
+		local:       local,
+		repository:  repository,
+		changes:     changes,
+		normalized:  normalized,
+		schema:      schema,
+		notifier:    notifier,
 		config:      config,
 		db:          make(databaseCh, 15),
 		wait:        make(chan struct{}, 1),
-		cancel:      false,
-		logger:      murlog.NewLogger(mConfig),
-	}
+		logger:      logger,
+	}, nil
 }
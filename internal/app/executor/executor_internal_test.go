@@ -1,15 +1,22 @@
 package executor
 
 import (
+	"encoding/json"
 	"Nani/internal/app/cache"
 	"Nani/internal/app/config"
 	"Nani/internal/app/db"
 	"Nani/internal/app/inhuman"
+	"Nani/internal/app/keywords"
+	"Nani/internal/app/notify"
 	"context"
 	"fmt"
 	murlog "github.com/Melenium2/Murlog"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -73,6 +80,80 @@ func (m *mock_storage) GetV(key string) (interface{}, error) {
 	return v, nil
 }
 
+func (m *mock_storage) Get(key string, out interface{}) error {
+	v, err := m.GetV(key)
+	if err != nil {
+		return err
+	}
+	b, _ := json.Marshal(v)
+
+	return json.Unmarshal(b, out)
+}
+
+func (m *mock_storage) Keys(prefix string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	keys := make([]string, 0)
+	for k := range m.cache {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+func (m *mock_storage) Delete(keys ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, k := range keys {
+		delete(m.cache, k)
+	}
+
+	return nil
+}
+
+func (m *mock_storage) Dump() {}
+
+func (m *mock_storage) Append(key string, values ...interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	list, ok := m.cache[key]
+	if !ok {
+		list = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(values[0])), 0, len(values)).Interface()
+	}
+	l := reflect.ValueOf(list)
+	for _, v := range values {
+		l = reflect.Append(l, reflect.ValueOf(v))
+	}
+	m.cache[key] = l.Interface()
+
+	return nil
+}
+
+func (m *mock_storage) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, ok := m.cache[key]
+	if ok != (old != nil) {
+		return false, nil
+	}
+	if ok {
+		a, _ := json.Marshal(v)
+		b, _ := json.Marshal(old)
+		if string(a) != string(b) {
+			return false, nil
+		}
+	}
+	m.cache[key] = new
+
+	return true, nil
+}
+
+func (m *mock_storage) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	m.Set(key, value)
+}
+
 type mock_repo struct {
 	Db map[int]*inhuman.App
 }
@@ -94,6 +175,62 @@ func (m *mock_repo) InsertBatch(ctx context.Context, apps []*inhuman.App) error
 	return nil
 }
 
+type mock_changes struct {
+	snapshots map[string]*inhuman.App
+	changes   []inhuman.Change
+}
+
+func (m *mock_changes) Snapshots(ctx context.Context, bundles []string) (map[string]*inhuman.App, error) {
+	snapshots := make(map[string]*inhuman.App)
+	for _, b := range bundles {
+		if v, ok := m.snapshots[b]; ok {
+			snapshots[b] = v
+		}
+	}
+
+	return snapshots, nil
+}
+
+func (m *mock_changes) InsertChanges(ctx context.Context, changes []inhuman.Change) error {
+	m.changes = append(m.changes, changes...)
+
+	return nil
+}
+
+type mock_normalized struct {
+	apps []*inhuman.NormalizedApp
+}
+
+func (m *mock_normalized) InsertNormalized(ctx context.Context, apps []*inhuman.NormalizedApp) error {
+	m.apps = append(m.apps, apps...)
+
+	return nil
+}
+
+type mock_schema struct {
+	err error
+}
+
+func (m mock_schema) CheckSchema(ctx context.Context) error {
+	return m.err
+}
+
+type mock_notifier struct {
+	events []notify.Event
+}
+
+func (m *mock_notifier) Watched(bundle, devid string) bool {
+	return bundle == "1" || devid == "dev"
+}
+
+func (m *mock_notifier) Notify(event notify.Event) {
+	m.events = append(m.events, event)
+}
+
+func (m *mock_notifier) Redeliver() {}
+
+func (m *mock_notifier) Close() {}
+
 func TestDeclareTaskMock_ShouldLoadToCacheAllBundlesFromFile_NoError(t *testing.T) {
 	ex := Executor{
 		externalApi: mock_api{},
@@ -155,11 +292,14 @@ func TestStoreAppsMock_ShouldStartStoreKeywordFunctionAndStoreBothValues_NoError
 	ex.storeApps(true, apps...)
 	time.Sleep(time.Second * 3)
 
-	for i := 0; i < 150; i++ {
+	// every app has the same keywords, they are queued once
+	for i := 0; i < 3; i++ {
 		key, err := ex.keyCache.Next()
 		assert.NoError(t, err)
 		assert.NotEmpty(t, key)
 	}
+	_, err := ex.keyCache.Next()
+	assert.Equal(t, cache.ErrKeywordsOutOfRange, err)
 
 	v, err := ex.cache.GetV("last")
 	assert.NoError(t, err)
@@ -178,7 +318,7 @@ func TestStoreKeywordsMock_ShouldStoreKeywordsToCache_NoError(t *testing.T) {
 		logger:      murlog.NewNopLogger(),
 	}
 	go ex.selector()
-	ex.storeKeywords(&inhuman.App{})
+	ex.storeKeywords(&inhuman.App{}, 1)
 	time.Sleep(time.Second * 3)
 
 	for i := 0; i < 3; i++ {
@@ -188,6 +328,235 @@ func TestStoreKeywordsMock_ShouldStoreKeywordsToCache_NoError(t *testing.T) {
 	}
 }
 
+func TestStoreKeywordsMock_ShouldQueueNormalizedKeywordsOnce_NoError(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	ex := Executor{
+		cache:    c,
+		keyCache: cache.NewKeyCache(c),
+		db:       make(databaseCh),
+		config:   config.Config{KeysCount: 10, Hl: "ru"},
+		logger:   murlog.NewNopLogger(),
+	}
+	go ex.selector()
+	ex.db <- inhuman.Keywords{"Игры": 5, "игра": 4, "игры!": 3, "и": 2, "гонки": 1}
+	time.Sleep(time.Millisecond * 100)
+
+	keys, err := ex.keyCache.Keywords()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "гонки", keys[0].Key)
+	assert.Equal(t, "гонк", keys[0].Norm)
+	assert.Equal(t, "игр", keys[1].Norm)
+	assert.ElementsMatch(t, []string{"Игры", "игра", "игры!"}, keys[1].Forms)
+}
+
+func TestStoreKeywordsMock_ShouldKeepOriginalKeywordToRequestFlow_NoError(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	ex := Executor{
+		cache:    c,
+		keyCache: cache.NewKeyCache(c),
+		db:       make(databaseCh, 1),
+		config:   config.Config{KeysCount: 10, Hl: "en"},
+		logger:   murlog.NewNopLogger(),
+	}
+	ex.db <- inhuman.Keywords{"C++": 2, " c# compiler ": 1}
+	close(ex.db)
+	ex.selector()
+
+	keys, err := ex.keyCache.Keywords()
+	assert.NoError(t, err)
+	found := make(map[string]string, len(keys))
+	for _, v := range keys {
+		found[v.Key] = v.Norm
+	}
+	assert.Equal(t, map[string]string{"C++": "c", "c# compiler": "c compiler"}, found)
+}
+
+func TestSelectorMock_ShouldSaveKeywordProvenanceToReport_NoError(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	ex := Executor{
+		cache:      c,
+		keyCache:   cache.NewKeyCache(c),
+		repository: &mock_repo{Db: make(map[int]*inhuman.App)},
+		db:         make(databaseCh, 2),
+		config:     config.Config{KeysCount: 10, Hl: "en"},
+		logger:     murlog.NewNopLogger(),
+		started:    time.Now(),
+	}
+	ex.db <- appKeywords{bundle: "com.first", depth: 1, keys: inhuman.Keywords{"Games": 3, "puzzle": 1}}
+	ex.db <- appKeywords{bundle: "com.second", depth: 1, keys: inhuman.Keywords{"game": 2}}
+	close(ex.db)
+	ex.selector()
+
+	keys, err := ex.keyCache.Keywords()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	game := keys[0]
+	if game.Norm != "game" {
+		game = keys[1]
+	}
+	assert.Equal(t, []string{"com.first", "com.second"}, game.Sources)
+	assert.Equal(t, 5, game.Weight)
+	assert.Equal(t, 1, game.Depth)
+	assert.Equal(t, "en", game.Locale)
+	assert.False(t, game.Seen.IsZero())
+
+	var r Report
+	assert.NoError(t, c.Get(ReportKey, &r))
+	assert.Equal(t, 2, r.Keywords)
+	assert.Equal(t, map[int]int{1: 2}, r.Depths)
+	assert.Len(t, r.Top, 2)
+	assert.Equal(t, "game", r.Top[0].Norm)
+	assert.Equal(t, "puzzle", r.Top[1].Key)
+}
+
+func TestSelectorMock_ShouldCountKeywordsRejectedByRules_NoError(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	conf := config.Config{KeysCount: 10, Keywords: config.KeywordsConfig{
+		Deny: []config.KeywordRule{{Name: "brands", Exact: []string{"Nani"}}, {Name: "short", MaxLen: 2}},
+	}}
+	filter, err := keywords.NewFilter(conf.Keywords)
+	assert.NoError(t, err)
+	ex := Executor{
+		cache:      c,
+		keyCache:   cache.NewKeyCache(c),
+		filter:     filter,
+		repository: &mock_repo{Db: make(map[int]*inhuman.App)},
+		db:         make(databaseCh, 1),
+		config:     conf,
+		logger:     murlog.NewNopLogger(),
+	}
+	ex.db <- appKeywords{bundle: "com.first", depth: 1, keys: inhuman.Keywords{"nani": 3, "go": 2, "racing": 1}}
+	close(ex.db)
+	ex.selector()
+
+	keys, err := ex.keyCache.Keywords()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "racing", keys[0].Key)
+
+	var r Report
+	assert.NoError(t, c.Get(ReportKey, &r))
+	assert.Equal(t, map[string]int{"brands": 1, "short": 1}, r.Rejected)
+}
+
+func TestExpandKeywordMock_ShouldQueueKeywordsOfFoundAppsOneLevelDeeper_NoError(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	ex := Executor{
+		cache:       c,
+		externalApi: &mock_dev_api{},
+		keyCache:    cache.NewKeyCache(c),
+		db:          make(databaseCh, 10),
+		config:      config.Config{KeysCount: 10, Hl: "en", Gl: "us", Keywords: config.KeywordsConfig{MaxDepth: 2}},
+		logger:      murlog.NewNopLogger(),
+	}
+	assert.NoError(t, ex.expandKeyword("farm", 1))
+
+	apps, found := 0, 0
+	for apps < 2 || found < 2 {
+		select {
+		case v := <-ex.db:
+			switch data := v.(type) {
+			case *inhuman.App:
+				apps++
+			case appKeywords:
+				found++
+				assert.Equal(t, 2, data.depth)
+				assert.Equal(t, "en-US", data.locale)
+				ex.queueKeywords(data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("keywords of found apps are not stored")
+		}
+	}
+
+	keys, err := ex.keyCache.Keywords()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+	for _, v := range keys {
+		assert.Equal(t, 2, v.Depth)
+		assert.Equal(t, "en-US", v.Locale)
+	}
+	_, err = c.GetV("last")
+	assert.Error(t, err)
+
+	// Keywords deeper than max depth are not queued
+	ex.config.Keywords.MaxDepth = 1
+	ex.queueKeywords(appKeywords{bundle: "com.deep", depth: 2, keys: inhuman.Keywords{"deep": 1}})
+	keys, err = ex.keyCache.Keywords()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+}
+
+type mock_keys_down_api struct {
+	mock_api
+}
+
+func (m mock_keys_down_api) Keys(title, description, shortDescription, reviews string) (inhuman.Keywords, error) {
+	return nil, fmt.Errorf("keywords endpoint is down")
+}
+
+func TestStoreKeywordsMock_ShouldUseLocalExtractorWhenApiFails_NoError(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	local := keywords.NewLocal("en", 10)
+	ex := Executor{
+		cache:       c,
+		externalApi: mock_keys_down_api{},
+		extractor:   keywords.NewFallback(mock_keys_down_api{}, local, nil),
+		local:       local,
+		keyCache:    cache.NewKeyCache(c),
+		repository:  &mock_repo{Db: make(map[int]*inhuman.App)},
+		db:          make(databaseCh, 2),
+		config:      config.Config{KeysCount: 10, Hl: "en"},
+		logger:      murlog.NewNopLogger(),
+	}
+	app := &inhuman.App{Bundle: "com.farm", Title: "Farm Story", ShortDescription: "Farm game"}
+	ex.db <- app
+	ex.storeKeywords(app, 1)
+	close(ex.db)
+	ex.selector()
+
+	keys, err := ex.keyCache.Keywords()
+	assert.NoError(t, err)
+	found := make([]string, 0, len(keys))
+	for _, v := range keys {
+		found = append(found, v.Key)
+		assert.Equal(t, []string{"com.farm"}, v.Sources)
+	}
+	assert.Contains(t, found, "farm")
+	assert.Contains(t, found, "farm story")
+	_, err = c.GetV("_errors")
+	assert.Error(t, err)
+
+	r, err := ex.report()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.Fallbacks)
+}
+
+func TestNew_ShouldReturnErrorCozKeywordsConfigIsInvalid_Error(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	_, err := New(mock_api{}, c, config.Config{Keywords: config.KeywordsConfig{
+		Deny: []config.KeywordRule{{Name: "adult", Regex: "(xxx"}},
+	}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "adult")
+
+	_, err = New(mock_api{}, c, config.Config{Keywords: config.KeywordsConfig{Extractor: "remote"}})
+	assert.Error(t, err)
+}
+
+func TestNew_ShouldReturnErrorCozDatabaseDriverIsUnknown_Error(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	_, err := New(mock_api{}, c, config.Config{Database: config.DBConfig{Driver: "mysql"}})
+	assert.EqualError(t, err, "unknown database driver mysql")
+
+	_, err = New(mock_api{}, c, config.Config{
+		Database: config.DBConfig{Driver: "jsonl", File: config.FileConfig{Path: filepath.Join(t.TempDir(), "apps")}},
+		Sinks:    []config.SinkConfig{{Database: config.DBConfig{Driver: "csv"}}},
+	})
+	assert.EqualError(t, err, "sink csv: empty csv file path")
+}
+
 func TestSaveErrorMock_ShouldSaveNewErrorToCache_NoError(t *testing.T) {
 	ex := Executor{
 		cache:  &mock_storage{cache: make(map[string]interface{})},
@@ -226,7 +595,7 @@ func TestSelectorMock_ShouldSaveAppsIfApplicationCanceled_NoError(t *testing.T)
 		ex.db <- &inhuman.App{Bundle: "1"}
 	}
 
-	ex.cancel = true
+	ex.cancel = 1
 	close(ex.db)
 
 	time.Sleep(time.Second * 3)
@@ -252,8 +621,8 @@ func TestAppsBatchMock_ShouldStoreApplicationDataFromMainPage_NoError(t *testing
 	go ex.selector()
 
 	ex.keyCache.Set("123")
-	ex.keyCache.Set("123")
-	ex.keyCache.Set("123")
+	ex.keyCache.Set("124")
+	ex.keyCache.Set("125")
 
 	ex.appsBatch()
 	ex.Stop()
@@ -286,7 +655,7 @@ func TestStoreApps_ShouldReturnCorrectObject_NoError(t *testing.T) {
 
 	bundles := []string{"com.dragonscapes.global", "com.funplus.townkins.global", "com.bigpoint.wefarm", "com.SocialInfinite.FNFamilyRelics"}
 	ex.storeApps(false, bundles...)
-	ex.cancel = true
+	ex.cancel = 1
 	close(ex.db)
 
 	time.Sleep(time.Second * 1)
@@ -308,6 +677,7 @@ func TestStoreApps_ShouldGetApplicationAndSaveToDb_NoError(t *testing.T) {
 	conn, _ := db.Connect(url)
 
 	conf.Database.Connection = conn
+	db.NewMigrator(conn).Up(context.Background(), false)
 
 	ex := Executor{
 		cache:       c,
@@ -323,7 +693,7 @@ func TestStoreApps_ShouldGetApplicationAndSaveToDb_NoError(t *testing.T) {
 
 	bundles := []string{"com.dragonscapes.global", "com.funplus.townkins.global", "com.bigpoint.wefarm", "com.SocialInfinite.FNFamilyRelics"}
 	ex.storeApps(false, bundles...)
-	ex.cancel = true
+	ex.cancel = 1
 	close(ex.db)
 
 	time.Sleep(time.Second * 1)
@@ -342,6 +712,7 @@ func TestStoreApps_ShouldGetApplicationAndSaveToDb_NoError(t *testing.T) {
 	assert.Nil(t, e)
 
 	conn.Exec(fmt.Sprint("drop table apps"))
+	conn.Exec(fmt.Sprint("drop table schema_migrations"))
 }
 
 func TestStoreKeywords_ShouldStoreKeywordsToMockCache_NoError(t *testing.T) {
@@ -368,7 +739,7 @@ func TestStoreKeywords_ShouldStoreKeywordsToMockCache_NoError(t *testing.T) {
 		ShortDescription: "Пустись в тропическое приключение на таинственных островах и найди драконов!",
 	}
 
-	ex.storeKeywords(app)
+	ex.storeKeywords(app, 1)
 
 	time.Sleep(time.Second * 1)
 
@@ -394,6 +765,7 @@ func TestAppBatch_ShouldSaveSomeApplicationToDbWhileTimeIsNotExpired(t *testing.
 	conn, _ := db.Connect(url)
 
 	conf.Database.Connection = conn
+	db.NewMigrator(conn).Up(context.Background(), false)
 
 	ex := &Executor{
 		cache:       c,
@@ -431,9 +803,10 @@ func TestAppBatch_ShouldSaveSomeApplicationToDbWhileTimeIsNotExpired(t *testing.
 	assert.Nil(t, e)
 
 	conn.Exec(fmt.Sprint("drop table apps"))
+	conn.Exec(fmt.Sprint("drop table schema_migrations"))
 }
 
-func TestScrap_ShouldScrapAppsWithWithKeywordsAndThenDistinct_NoError(t *testing.T) {
+func TestScrap_ShouldScrapAppsWithWithDistinctKeywords_NoError(t *testing.T) {
 	conf := config.New()
 	conf.KeysCount = 10
 	conf.AppsCount = 10
@@ -460,8 +833,6 @@ func TestScrap_ShouldScrapAppsWithWithKeywordsAndThenDistinct_NoError(t *testing
 	ex.wait <- struct{}{}
 	ex.Stop()
 
-	assert.NoError(t, ex.keyCache.Distinct())
-
 	distinct := make(map[string]int)
 	for {
 		key, err := ex.keyCache.Next()
@@ -475,3 +846,420 @@ func TestScrap_ShouldScrapAppsWithWithKeywordsAndThenDistinct_NoError(t *testing
 		assert.Equal(t, 1, v)
 	}
 }
+
+func TestTrackChangesMock_ShouldSaveChangesComparedWithLastSnapshots_NoError(t *testing.T) {
+	ch := &mock_changes{snapshots: map[string]*inhuman.App{
+		"1": {Bundle: "1", Version: "1.0", Price: ""},
+	}}
+	ex := Executor{
+		cache:   &mock_storage{cache: make(map[string]interface{})},
+		changes: ch,
+		ctx:     context.Background(),
+		logger:  murlog.NewNopLogger(),
+	}
+
+	apps := []*inhuman.App{
+		{Bundle: "1", Version: "1.1", Price: ""},
+		{Bundle: "2", Version: "1.0"},
+		{Bundle: "1", Version: "1.1", Price: "99"},
+	}
+	ex.trackChanges(apps, ex.snapshots(apps))
+
+	assert.Len(t, ch.changes, 2)
+	assert.Equal(t, "version", ch.changes[0].Field)
+	assert.Equal(t, "1.0", ch.changes[0].Old)
+	assert.Equal(t, "1.1", ch.changes[0].New)
+	assert.Equal(t, "price", ch.changes[1].Field)
+	assert.Equal(t, "99", ch.changes[1].New)
+}
+
+func TestTrackChangesMock_ShouldNotifyAboutWatchedApplications_NoError(t *testing.T) {
+	n := &mock_notifier{}
+	ex := Executor{
+		cache: &mock_storage{cache: make(map[string]interface{})},
+		changes: &mock_changes{snapshots: map[string]*inhuman.App{
+			"1": {Bundle: "1", Version: "1.0", Price: "", Rating: "4.0"},
+			"2": {Bundle: "2", Version: "1.0"},
+		}},
+		notifier: n,
+		ctx:      context.Background(),
+		logger:   murlog.NewNopLogger(),
+	}
+
+	apps := []*inhuman.App{
+		{Bundle: "1", Version: "1.1", Price: "99", Rating: "4.1"},
+		{Bundle: "2", Version: "1.1"},
+		{Bundle: "3", DeveloperId: "dev"},
+		{Bundle: "4", DeveloperId: "dev2"},
+	}
+	ex.trackChanges(apps, ex.snapshots(apps))
+
+	assert.Len(t, n.events, 3)
+	assert.Equal(t, notify.NewVersion, n.events[0].Type)
+	assert.Equal(t, "1.1", n.events[0].New)
+	assert.Equal(t, notify.PriceChange, n.events[1].Type)
+	assert.Equal(t, "99", n.events[1].New)
+	assert.Equal(t, notify.NewApp, n.events[2].Type)
+	assert.Equal(t, "3", n.events[2].Bundle)
+}
+
+type mock_delisted_api struct {
+	mock_api
+}
+
+func (m mock_delisted_api) App(bundle string) (*inhuman.App, error) {
+	return nil, &inhuman.StatusError{Code: 404}
+}
+
+func TestStoreAppsMock_ShouldNotifyDelistedAppWithDeveloperOfLastSnapshot_NoError(t *testing.T) {
+	n := &mock_notifier{}
+	ex := Executor{
+		externalApi: mock_delisted_api{},
+		cache:       &mock_storage{cache: make(map[string]interface{})},
+		changes: &mock_changes{snapshots: map[string]*inhuman.App{
+			"2": {Bundle: "2", DeveloperId: "dev"},
+		}},
+		notifier: n,
+		ctx:      context.Background(),
+		logger:   murlog.NewNopLogger(),
+	}
+
+	ex.storeApps(false, "2", "3")
+
+	assert.Len(t, n.events, 1)
+	assert.Equal(t, notify.Delisted, n.events[0].Type)
+	assert.Equal(t, "2", n.events[0].Bundle)
+	assert.Equal(t, "dev", n.events[0].DeveloperId)
+}
+
+func TestTrackChangesMock_ShouldNotNotifyNewAppsWhileSeeding_NoError(t *testing.T) {
+	n := &mock_notifier{}
+	ch := &mock_changes{snapshots: map[string]*inhuman.App{
+		"1": {Bundle: "1", Version: "1.0"},
+	}}
+	ex := Executor{
+		cache:    &mock_storage{cache: make(map[string]interface{})},
+		changes:  ch,
+		notifier: n,
+		seeding:  true,
+		ctx:      context.Background(),
+		logger:   murlog.NewNopLogger(),
+	}
+
+	apps := []*inhuman.App{
+		{Bundle: "1", Version: "1.1"},
+		{Bundle: "3", DeveloperId: "dev"},
+	}
+	ex.trackChanges(apps, ex.snapshots(apps))
+
+	assert.Len(t, n.events, 1)
+	assert.Equal(t, notify.NewVersion, n.events[0].Type)
+	assert.Len(t, ch.changes, 1)
+}
+
+func TestStoreNormalizedMock_ShouldSaveTypedRecordsAndParseErrors_NoError(t *testing.T) {
+	n := &mock_normalized{}
+	c := &mock_storage{cache: make(map[string]interface{})}
+	ex := Executor{
+		cache:      c,
+		normalized: n,
+		config:     config.Config{Hl: "ru"},
+		ctx:        context.Background(),
+		logger:     murlog.NewNopLogger(),
+	}
+
+	ex.storeNormalized([]*inhuman.App{
+		{Bundle: "1", Rating: "4,5", Installs: "1 000+"},
+		{Bundle: "2", Installs: "many"},
+	})
+
+	assert.Len(t, n.apps, 2)
+	assert.Equal(t, 4.5, n.apps[0].Rating)
+	assert.Equal(t, int64(1000), n.apps[0].MinInstalls)
+	assert.Equal(t, "2", n.apps[1].Bundle)
+
+	e, err := c.GetV("_errors")
+	assert.NoError(t, err)
+	ers := e.([]ExecutorError)
+	assert.Len(t, ers, 1)
+	assert.Equal(t, "normalize", ers[0].T)
+	assert.Equal(t, "2", ers[0].Bundle)
+}
+
+func TestScrapMock_ShouldRefuseToStartIfSchemaIsBehind_Error(t *testing.T) {
+	ex := Executor{
+		cache:  &mock_storage{cache: make(map[string]interface{})},
+		schema: mock_schema{err: &db.SchemaBehindError{Current: 1, Latest: 3}},
+		logger: murlog.NewNopLogger(),
+	}
+
+	err := ex.Scrap(context.Background(), "bundles.txt")
+	assert.EqualError(t, err, "database schema version 1 is behind binary version 3, run migrate")
+}
+
+type mock_flaky_repo struct {
+	mock_repo
+	fails   map[string]int
+	batches [][]*inhuman.App
+}
+
+func (m *mock_flaky_repo) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	m.batches = append(m.batches, apps)
+	rows := make([]db.RowError, 0)
+	stored := make([]*inhuman.App, 0)
+	for i, v := range apps {
+		if m.fails[v.Bundle] > 0 {
+			m.fails[v.Bundle]--
+			rows = append(rows, db.RowError{Index: i, App: v, Err: fmt.Errorf("bad row %s", v.Bundle)})
+			continue
+		}
+		stored = append(stored, v)
+	}
+	m.mock_repo.InsertBatch(ctx, stored)
+	if len(rows) > 0 {
+		return &db.BatchError{Rows: rows}
+	}
+
+	return nil
+}
+
+func TestInsertBatchMock_ShouldRetryOnlyFailedRowsAndSaveRowErrors_NoError(t *testing.T) {
+	r := &mock_flaky_repo{
+		mock_repo: mock_repo{Db: make(map[int]*inhuman.App)},
+		fails:     map[string]int{"2": 1, "3": 2},
+	}
+	c := &mock_storage{cache: make(map[string]interface{})}
+	ex := Executor{
+		cache:      c,
+		repository: r,
+		ctx:        context.Background(),
+		logger:     murlog.NewNopLogger(),
+	}
+
+	apps := []*inhuman.App{{Bundle: "1"}, {Bundle: "2"}, {Bundle: "3"}}
+	stored, err := ex.insertBatch(apps)
+	assert.NoError(t, err)
+
+	assert.Len(t, r.batches, 2)
+	assert.Equal(t, []*inhuman.App{apps[1], apps[2]}, r.batches[1])
+	assert.Equal(t, []*inhuman.App{apps[0], apps[1]}, stored)
+	assert.Len(t, r.Db, 2)
+
+	e, err := c.GetV("_errors")
+	assert.NoError(t, err)
+	ers := e.([]ExecutorError)
+	assert.Len(t, ers, 1)
+	assert.Equal(t, "Db", ers[0].T)
+	assert.Equal(t, "3", ers[0].Bundle)
+}
+
+func TestInsertBatchMock_ShouldPassEachStoredRowToSinksOnce_NoError(t *testing.T) {
+	r := &mock_flaky_repo{
+		mock_repo: mock_repo{Db: make(map[int]*inhuman.App)},
+		fails:     map[string]int{"2": 1},
+	}
+	s := &mock_flaky_repo{mock_repo: mock_repo{Db: make(map[int]*inhuman.App)}}
+	fanout := db.NewFanOut(r)
+	fanout.AddSink("mock", s, 10, 1)
+	ex := Executor{
+		cache:      &mock_storage{cache: make(map[string]interface{})},
+		repository: fanout,
+		ctx:        context.Background(),
+		logger:     murlog.NewNopLogger(),
+	}
+
+	apps := []*inhuman.App{{Bundle: "1"}, {Bundle: "2"}}
+	stored, err := ex.insertBatch(apps)
+	assert.NoError(t, err)
+	assert.NoError(t, fanout.Close())
+
+	assert.Equal(t, apps, stored)
+	assert.Len(t, r.batches, 2)
+	assert.Equal(t, [][]*inhuman.App{{apps[0]}, {apps[1]}}, s.batches)
+}
+
+type mock_failed_repo struct {
+	mock_repo
+}
+
+func (m *mock_failed_repo) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	return fmt.Errorf("connection refused")
+}
+
+func TestInsertBatchMock_ShouldSaveErrorOfEachRowIfBatchFailedWithoutRowErrors_Error(t *testing.T) {
+	c := &mock_storage{cache: make(map[string]interface{})}
+	ex := Executor{
+		cache:      c,
+		repository: &mock_failed_repo{},
+		ctx:        context.Background(),
+		logger:     murlog.NewNopLogger(),
+	}
+
+	apps := []*inhuman.App{{Bundle: "1"}, {Bundle: "2"}}
+	stored, err := ex.insertBatch(apps)
+	assert.EqualError(t, err, "connection refused")
+	assert.Empty(t, stored)
+
+	e, err := c.GetV("_errors")
+	assert.NoError(t, err)
+	ers := e.([]ExecutorError)
+	assert.Len(t, ers, 2)
+	assert.Equal(t, "1", ers[0].Bundle)
+	assert.Equal(t, "2", ers[1].Bundle)
+}
+
+func TestSelectorMock_ShouldKeepAndRetryBatchWhileRepositoryIsDown_NoError(t *testing.T) {
+	r := &mock_flaky_repo{mock_repo: mock_repo{Db: make(map[int]*inhuman.App)}}
+	ch := &mock_changes{snapshots: map[string]*inhuman.App{}}
+	n := &mock_normalized{}
+	ex := Executor{
+		cache:      &mock_storage{cache: make(map[string]interface{})},
+		repository: &mock_down_repo{mock_flaky_repo: r, down: 1},
+		changes:    ch,
+		normalized: n,
+		db:         make(databaseCh, batchSize*3),
+		ctx:        context.Background(),
+		logger:     murlog.NewNopLogger(),
+	}
+	for i := 0; i < batchSize*3; i++ {
+		ex.db <- &inhuman.App{Bundle: strconv.Itoa(i), Version: "1.0"}
+	}
+	close(ex.db)
+	ex.selector()
+
+	assert.Len(t, r.Db, batchSize*3)
+	assert.Len(t, n.apps, batchSize*3)
+}
+
+type mock_down_repo struct {
+	*mock_flaky_repo
+	down int
+}
+
+func (m *mock_down_repo) InsertBatch(ctx context.Context, apps []*inhuman.App) error {
+	if m.down > 0 {
+		m.down--
+		return fmt.Errorf("connection refused")
+	}
+
+	return m.mock_flaky_repo.InsertBatch(ctx, apps)
+}
+
+type mock_dev_api struct {
+	mock_api
+	calls int
+}
+
+func (m *mock_dev_api) DevApps(devid string) ([]inhuman.App, error) {
+	m.calls++
+	return []inhuman.App{{Bundle: devid + ".1"}, {Bundle: devid + ".2"}}, nil
+}
+
+func TestGetDevAppsMock_ShouldCacheDeveloperApplications_NoError(t *testing.T) {
+	api := &mock_dev_api{}
+	ex := Executor{
+		cache:       &mock_storage{cache: make(map[string]interface{})},
+		externalApi: api,
+		config:      config.Config{Cache: config.CacheConfig{DevAppsTTL: time.Hour}},
+		logger:      murlog.NewNopLogger(),
+	}
+
+	for i := 0; i < 3; i++ {
+		bundles, err := ex.getDevApps("dev")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"dev.1", "dev.2"}, bundles)
+	}
+	assert.Equal(t, 1, api.calls)
+}
+
+type mock_flow_api struct {
+	mock_api
+	calls map[string]int
+	mutex sync.Mutex
+}
+
+func (m *mock_flow_api) Flow(key string) ([]inhuman.App, error) {
+	m.mutex.Lock()
+	m.calls[key]++
+	m.mutex.Unlock()
+	if key == "broken" {
+		return nil, fmt.Errorf("flow error")
+	}
+
+	return []inhuman.App{{DeveloperId: "dev_" + key}}, nil
+}
+
+func (m *mock_flow_api) DevApps(devid string) ([]inhuman.App, error) {
+	return nil, nil
+}
+
+func TestAppsBatchMock_ShouldExpandKeywordsWithParallelWorkers_NoError(t *testing.T) {
+	api := &mock_flow_api{calls: make(map[string]int)}
+	c := &mock_storage{cache: make(map[string]interface{})}
+	ex := &Executor{
+		cache:       c,
+		externalApi: api,
+		keyCache:    cache.NewKeyCache(c),
+		config:      config.Config{Keywords: config.KeywordsConfig{Workers: 3, Lease: 2}},
+		wait:        make(chan struct{}, 1),
+		logger:      murlog.NewNopLogger(),
+	}
+	keys := []string{"key1", "key2", "broken", "key3", "key4", "key5"}
+	for _, k := range keys {
+		assert.NoError(t, ex.keyCache.Set(k))
+	}
+
+	ex.appsBatch()
+	<-ex.wait
+
+	for _, k := range keys {
+		if k == "broken" {
+			assert.Equal(t, cache.DefaultMaxAttempts, api.calls[k])
+			continue
+		}
+		assert.Equal(t, 1, api.calls[k], k)
+	}
+	failed, err := ex.keyCache.Failed()
+	assert.NoError(t, err)
+	assert.Len(t, failed, 1)
+	assert.Equal(t, "broken", failed[0].Key)
+	leases, err := ex.keyCache.Leases()
+	assert.NoError(t, err)
+	assert.Empty(t, leases)
+}
+
+func BenchmarkStoreKeywords_Parallel(b *testing.B) {
+	dir, err := ioutil.TempDir("", "executor")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := cache.Open(config.CacheConfig{Path: filepath.Join(dir, "cache.json")}, false)
+	defer c.Close()
+
+	ex := Executor{
+		cache:       c,
+		externalApi: mock_api{},
+		keyCache:    cache.NewKeyCache(c),
+		repository:  &mock_repo{},
+		db:          make(databaseCh, 100),
+		config:      config.Config{KeysCount: 3},
+		ctx:         context.Background(),
+		logger:      murlog.NewNopLogger(),
+	}
+	done := make(chan struct{})
+	go func() {
+		ex.selector()
+		close(done)
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		app := &inhuman.App{Title: "title", Description: "description"}
+		for pb.Next() {
+			ex.storeKeywords(app, 1)
+		}
+	})
+	close(ex.db)
+	<-done
+}
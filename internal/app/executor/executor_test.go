@@ -17,7 +17,11 @@ func exe(newstorage bool) *executor.Executor {
 	config := config2.New()
 	api := inhuman.New(config)
 	storage := cache.New(newstorage)
-	return executor.New(api, storage, config)
+	ex, err := executor.New(api, storage, config)
+	if err != nil {
+		panic(err)
+	}
+	return ex
 }
 
 func TestScrap_ShouldStartingScrapingFor5Seconds_NoError(t *testing.T)  {
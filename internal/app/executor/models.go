@@ -1,5 +1,11 @@
 package executor
 
+import (
+	"Nani/internal/app/cache"
+	"Nani/internal/app/inhuman"
+	"time"
+)
+
 type ExecutorError struct {
 	T      string `json:"t,omitempty"`
 	Er     string `json:"er,omitempty"`
@@ -7,3 +13,32 @@ type ExecutorError struct {
 }
 
 type databaseCh chan interface{}
+
+// appKeywords are keywords of application with their provenance
+type appKeywords struct {
+	bundle string
+	depth  int
+	// Locale of the request which returned keywords
+	locale string
+	keys   inhuman.Keywords
+}
+
+// Report of the run, it is saved to the cache when run is over
+type Report struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Number of queued keywords
+	Keywords int `json:"keywords"`
+	// Number of keywords by discovery depth
+	Depths map[int]int `json:"depths,omitempty"`
+	// Keywords which are still leased or wait for retry
+	Leased []cache.Lease `json:"leased,omitempty"`
+	// Keywords which failed too many times
+	Failed []cache.Lease `json:"failed,omitempty"`
+	// Number of keywords rejected by filter rules
+	Rejected map[string]int `json:"rejected,omitempty"`
+	// Number of times local extractor was used because api failed
+	Fallbacks int `json:"fallbacks,omitempty"`
+	// Strongest keywords with their provenance
+	Top []cache.Keyword `json:"top,omitempty"`
+}
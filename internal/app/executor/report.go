@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"Nani/internal/app/keywords"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cache key of the report of the last run
+const ReportKey = "_report"
+
+// Number of the strongest keywords in the report
+const reportTop = 20
+
+// report collects provenance of queued keywords
+// @return
+//	Report
+//	error
+func (ex *Executor) report() (Report, error) {
+	r := Report{Started: ex.started, Finished: time.Now(), Depths: make(map[int]int)}
+
+	keys, err := ex.keyCache.Keywords()
+	if err != nil {
+		return r, err
+	}
+	r.Keywords = len(keys)
+	for _, v := range keys {
+		r.Depths[v.Depth]++
+	}
+	if r.Leased, err = ex.keyCache.Leases(); err != nil {
+		return r, err
+	}
+	if r.Failed, err = ex.keyCache.Failed(); err != nil {
+		return r, err
+	}
+	if ex.filter != nil {
+		r.Rejected = ex.filter.Rejected()
+	}
+	if f, ok := ex.extractor.(*keywords.Fallback); ok {
+		r.Fallbacks = f.Used()
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].Weight > keys[j].Weight
+	})
+	if len(keys) > reportTop {
+		keys = keys[:reportTop]
+	}
+	r.Top = keys
+
+	return r, nil
+}
+
+// saveReport save report of the run to the cache and log it
+func (ex *Executor) saveReport() {
+	if ex.keyCache == nil {
+		return
+	}
+
+	r, err := ex.report()
+	if err != nil {
+		ex.logger.Log("log", err)
+		ex.saveError("report", "", err)
+		return
+	}
+	ex.cache.Set(ReportKey, r)
+
+	ex.logger.Log("keywords", r.Keywords, "leased", len(r.Leased), "failed", len(r.Failed))
+	for k, v := range r.Rejected {
+		ex.logger.Log("rejected", k, "keywords", v)
+	}
+	if r.Fallbacks > 0 {
+		ex.logger.Log("fallbacks", r.Fallbacks)
+	}
+	for _, v := range r.Top {
+		ex.logger.Log("keyword", v.Key, "weight", v.Weight, "depth", v.Depth, "sources", strings.Join(v.Sources, ","))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 )
@@ -21,6 +22,46 @@ func ReadAll(path string) (string, error) {
 	return string(d), nil
 }
 
+// Write data to file atomically. Data is written to the temporary file in
+// the same directory, synced to the disk and renamed over the path, so the
+// file contains either old or new content even after crash
+// @path: string (path to file)
+// @data: []byte (new content of file)
+// @return Error
+func WriteAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Sync directory so the rename itself survives crash
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
 type LocalFileWorker interface {
 	ChangePath(path string)
 	Read(lines ...int) ([]string, error)
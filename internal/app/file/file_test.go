@@ -122,3 +122,25 @@ func TestWriteLines_ShouldCreateNewFileThenWriteLines_NoError(t *testing.T) {
 
 	assert.NoError(t, removeFile(filename))
 }
+
+func TestWriteAtomic_ShouldReplaceFileContent_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := dir + "/data.json"
+
+	assert.NoError(t, file.WriteAtomic(filename, []byte("old")))
+	assert.NoError(t, file.WriteAtomic(filename, []byte("new")))
+
+	f, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(f))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestWriteAtomic_ShouldReturnErrorCozDirNotExist_Error(t *testing.T) {
+	assert.Error(t, file.WriteAtomic("not/exist/dir/data.json", []byte("data")))
+}
@@ -0,0 +1,215 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateWriter writes data to the sequence of files and switches
+// to the next file when current one is too big or too old
+type RotateWriter struct {
+	// OnOpen called for each new file, for example to write header
+	OnOpen   func(w io.Writer) error
+	path     string
+	maxSize  int64
+	interval time.Duration
+	gzip     bool
+	file     *os.File
+	gz       *gzip.Writer
+	size     int64
+	opened   time.Time
+	index    int
+	files    []string
+	mutex    sync.Mutex
+}
+
+// Write p to the current file. Before writing checks if file should be rotated,
+// so one call of Write is never split across files
+// @p: []byte (data for writing)
+// @return int (written bytes) @error Error
+func (r *RotateWriter) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil || r.expired() {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+	var err error
+	if r.gz != nil {
+		n, err = r.gz.Write(p)
+	} else {
+		n, err = r.file.Write(p)
+	}
+	r.size += int64(n)
+
+	return n, err
+}
+
+// Flush buffered compressed data to the file
+// @return Error
+func (r *RotateWriter) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.gz != nil {
+		return r.gz.Flush()
+	}
+
+	return nil
+}
+
+// Rotate close current file and open the next one
+// @return Error
+func (r *RotateWriter) Rotate() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.rotate()
+}
+
+// Files return names of all files created by writer
+// @return []string (file paths)
+func (r *RotateWriter) Files() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	files := make([]string, len(r.files))
+	copy(files, r.files)
+
+	return files
+}
+
+// Size return count of bytes written to the current file before compression
+// @return int64
+func (r *RotateWriter) Size() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.size
+}
+
+// Close current file
+// @return Error
+func (r *RotateWriter) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.close()
+}
+
+// expired check if current file reached max size or max age
+func (r *RotateWriter) expired() bool {
+	if r.maxSize > 0 && r.size >= r.maxSize {
+		return true
+	}
+	if r.interval > 0 && time.Since(r.opened) >= r.interval {
+		return true
+	}
+
+	return false
+}
+
+func (r *RotateWriter) rotate() error {
+	if err := r.close(); err != nil {
+		return err
+	}
+
+	r.index++
+	name := r.name()
+	if dir := filepath.Dir(name); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.size = 0
+	r.opened = time.Now()
+	r.files = append(r.files, name)
+
+	var w io.Writer = f
+	if r.gzip {
+		r.gz = gzip.NewWriter(f)
+		w = r.gz
+	}
+	if r.OnOpen != nil {
+		cw := &countWriter{w: w}
+		err := r.OnOpen(cw)
+		r.size += cw.n
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *RotateWriter) close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	var err error
+	if r.gz != nil {
+		err = r.gz.Close()
+		r.gz = nil
+	}
+	if e := r.file.Close(); err == nil {
+		err = e
+	}
+	r.file = nil
+
+	return err
+}
+
+// name of the next file, like apps-20201020T101010-0001.jsonl.gz
+func (r *RotateWriter) name() string {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	name := fmt.Sprintf("%s-%s-%04d%s", base, time.Now().Format("20060102T150405"), r.index, ext)
+	if r.gzip {
+		name += ".gz"
+	}
+
+	return name
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// Create new instance of RotateWriter. File is opened on the first write
+// @path: string (base file path, timestamp and sequence number are added to the name)
+// @maxSize: int64 (max size of file in bytes before compression, 0 is unlimited)
+// @interval: time.Duration (max age of file, 0 is unlimited)
+// @gzip: bool (compress files with gzip)
+// @return *RotateWriter
+func NewRotateWriter(path string, maxSize int64, interval time.Duration, gzip bool) *RotateWriter {
+	return &RotateWriter{
+		path:     path,
+		maxSize:  maxSize,
+		interval: interval,
+		gzip:     gzip,
+	}
+}
@@ -0,0 +1,75 @@
+package file_test
+
+import (
+	"Nani/internal/app/file"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotateWriter_ShouldRotateFileWhenMaxSizeReached_NoError(t *testing.T) {
+	w := file.NewRotateWriter(filepath.Join(t.TempDir(), "out", "apps.txt"), 10, 0, false)
+	for i := 0; i < 3; i++ {
+		_, err := w.Write([]byte("0123456789"))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	files := w.Files()
+	assert.Len(t, files, 3)
+	for _, f := range files {
+		assert.Equal(t, ".txt", filepath.Ext(f))
+		b, err := ioutil.ReadFile(f)
+		assert.NoError(t, err)
+		assert.Equal(t, "0123456789", string(b))
+	}
+}
+
+func TestRotateWriter_ShouldWriteHeaderToEachFile_NoError(t *testing.T) {
+	w := file.NewRotateWriter(filepath.Join(t.TempDir(), "apps.csv"), 8, 0, false)
+	w.OnOpen = func(w io.Writer) error {
+		_, err := w.Write([]byte("h\n"))
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		_, err := w.Write([]byte("row\n"))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Rotate())
+	_, err := w.Write([]byte("row\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	files := w.Files()
+	assert.Len(t, files, 2)
+	b, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "h\nrow\nrow\n", string(b))
+	b, err = ioutil.ReadFile(files[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "h\nrow\n", string(b))
+}
+
+func TestRotateWriter_ShouldCompressFilesWithGzip_NoError(t *testing.T) {
+	w := file.NewRotateWriter(filepath.Join(t.TempDir(), "apps.jsonl"), 0, 0, true)
+	_, err := w.Write([]byte("{}\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	files := w.Files()
+	assert.Len(t, files, 1)
+	assert.Equal(t, ".gz", filepath.Ext(files[0]))
+
+	f, err := os.Open(files[0])
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}\n", string(b))
+}
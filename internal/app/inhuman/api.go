@@ -137,7 +137,7 @@ func (api *InhumanApi) Request(endpoint, method string, data interface{}, respon
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode > 200 {
-		return fmt.Errorf("external api response with status %d", resp.StatusCode)
+		return &StatusError{Code: resp.StatusCode}
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
@@ -0,0 +1,113 @@
+package inhuman
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// ValidateContacts clean developer contacts of application. Contacts which
+// are not valid are removed from application
+// @return
+//	error (*NormalizeError with invalid contacts)
+func (a *App) ValidateContacts() error {
+	c := &a.DeveloperContacts
+	fails := make(map[string]error)
+	var err error
+
+	if c.Email, err = ParseEmail(c.Email); err != nil {
+		fails["email"] = err
+	}
+	if c.Website, err = ParseWebsite(c.Website); err != nil {
+		fails["website"] = err
+	}
+	if c.Phone, err = ParsePhone(c.Phone); err != nil {
+		fails["phone"] = err
+	}
+	c.Address = strings.Join(strings.Fields(c.Address), " ")
+	c.Contacts = strings.TrimSpace(c.Contacts)
+	c.Domain = ContactsDomain(*c)
+
+	if len(fails) > 0 {
+		return &NormalizeError{Bundle: a.Bundle, Fields: fails}
+	}
+
+	return nil
+}
+
+// ContactsDomain return domain of developer website or email without www prefix
+func ContactsDomain(c DeveloperContacts) string {
+	if u, err := url.Parse(c.Website); err == nil && u.Hostname() != "" {
+		return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	}
+	if i := strings.LastIndex(c.Email, "@"); i >= 0 {
+		return strings.ToLower(c.Email[i+1:])
+	}
+
+	return ""
+}
+
+// ParseEmail return email address in lower case, empty email is valid
+func ParseEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid email %q", s)
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
+
+// ParseWebsite return absolute http(s) url of website, url without
+// scheme is treated as https. Empty website is valid
+func ParseWebsite(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(u.Hostname(), ".") {
+		return "", fmt.Errorf("invalid website %q", s)
+	}
+
+	return u.String(), nil
+}
+
+// ParsePhone return phone with digits and leading plus only. Phone must
+// contain from 5 to 15 digits, empty phone is valid
+func ParsePhone(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+
+	var b strings.Builder
+	digits := 0
+	for i, r := range s {
+		switch {
+		case unicode.IsDigit(r):
+			b.WriteRune(r)
+			digits++
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || strings.ContainsRune("-().", r):
+		default:
+			return "", fmt.Errorf("invalid phone %q", s)
+		}
+	}
+	if digits < 5 || digits > 15 {
+		return "", fmt.Errorf("invalid phone %q", s)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,49 @@
+package inhuman_test
+
+import (
+	"Nani/internal/app/inhuman"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateContacts_ShouldCleanValidContacts_NoError(t *testing.T) {
+	app := &inhuman.App{
+		Bundle: "com.ky",
+		DeveloperContacts: inhuman.DeveloperContacts{
+			Email:   " Support@Example.COM ",
+			Website: "www.example.com/about",
+			Address: " 1 Main st,\n  Springfield ",
+			Phone:   "+1 (555) 123-45-67",
+		},
+	}
+
+	assert.NoError(t, app.ValidateContacts())
+	assert.Equal(t, "support@example.com", app.DeveloperContacts.Email)
+	assert.Equal(t, "https://www.example.com/about", app.DeveloperContacts.Website)
+	assert.Equal(t, "1 Main st, Springfield", app.DeveloperContacts.Address)
+	assert.Equal(t, "+15551234567", app.DeveloperContacts.Phone)
+	assert.Equal(t, "example.com", app.DeveloperContacts.Domain)
+}
+
+func TestValidateContacts_ShouldRemoveInvalidContacts_Error(t *testing.T) {
+	app := &inhuman.App{
+		Bundle: "com.ky",
+		DeveloperContacts: inhuman.DeveloperContacts{
+			Email:   "not an email",
+			Website: "ftp://example.com",
+			Phone:   "call me",
+		},
+	}
+
+	err := app.ValidateContacts()
+	var e *inhuman.NormalizeError
+	assert.True(t, errors.As(err, &e))
+	assert.Len(t, e.Fields, 3)
+	assert.Equal(t, inhuman.DeveloperContacts{}, app.DeveloperContacts)
+}
+
+func TestDeveloperContactsDomain_ShouldFallbackToEmailDomain_NoError(t *testing.T) {
+	assert.Equal(t, "mail.ru", inhuman.ContactsDomain(inhuman.DeveloperContacts{Email: "dev@mail.ru"}))
+	assert.Equal(t, "", inhuman.ContactsDomain(inhuman.DeveloperContacts{}))
+}
@@ -2,14 +2,16 @@ package inhuman
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"reflect"
+	"net/http"
+	"time"
 )
 
 type App struct {
-	Id                int64             `json:"-" db:"id"`
+	Id                int64             `json:"-" db:"-"`
 	Bundle            string            `json:"bundle" db:"bundle"`
-	DeveloperId       string            `json:"developerId" db:"developer_id"`
+	DeveloperId       string            `json:"developerId" db:"developerId"`
 	Developer         string            `json:"developer" db:"developer"`
 	Title             string            `json:"title" db:"title"`
 	Categories        string            `json:"categories" db:"categories"`
@@ -17,24 +19,20 @@ type App struct {
 	Picture           string            `json:"picture" db:"picture"`
 	Screenshots       []string          `json:"screenshots" db:"screenshots"`
 	Rating            string            `json:"rating" db:"rating"`
-	ReviewCount       string            `json:"reviewCount" db:"review_count"`
-	RatingHistogram   []string          `json:"ratingHistogram" db:"rating_histogram"`
+	ReviewCount       string            `json:"reviewCount" db:"reviewCount"`
+	RatingHistogram   []string          `json:"ratingHistogram" db:"ratingHistogram"`
 	Description       string            `json:"description" db:"description"`
-	ShortDescription  string            `json:"shortDescription" db:"short_description"`
-	RecentChanges     string            `json:"recentChanges" db:"recent_changes"`
-	ReleaseDate       string            `json:"releaseDate" db:"release_date"`
-	LastUpdateDate    string            `json:"lastUpdateDate" db:"last_update_date"`
-	AppSize           string            `json:"appSize" db:"app_size"`
+	ShortDescription  string            `json:"shortDescription" db:"shortDescription"`
+	RecentChanges     string            `json:"recentChanges" db:"recentChanges"`
+	ReleaseDate       string            `json:"releaseDate" db:"releaseDate"`
+	LastUpdateDate    string            `json:"lastUpdateDate" db:"lastUpdateDate"`
+	AppSize           string            `json:"appSize" db:"appSize"`
 	Installs          string            `json:"installs" db:"installs"`
 	Version           string            `json:"version" db:"version"`
-	AndroidVersion    string            `json:"androidVersion" db:"android_version"`
-	ContentRating     string            `json:"contentRating" db:"content_rating"`
-	DeveloperContacts DeveloperContacts `json:"developerContacts" db:"developer_contacts"`
-	PrivacyPolicy     string            `json:"privacyPolicy,omitempty"`
-}
-
-func (a App) Fields() string {
-	return StructFields(reflect.TypeOf(a))[4:]
+	AndroidVersion    string            `json:"androidVersion" db:"androidVersion"`
+	ContentRating     string            `json:"contentRating" db:"contentRating"`
+	DeveloperContacts DeveloperContacts `json:"developerContacts" db:",inline"`
+	PrivacyPolicy     string            `json:"privacyPolicy,omitempty" db:"privacyPolicy"`
 }
 
 func (a App) String() string {
@@ -77,8 +75,77 @@ func (a App) String() string {
 }
 
 type DeveloperContacts struct {
-	Email    string `json:"email,omitempty"`
-	Contacts string `json:"contacts,omitempty"`
+	Email    string `json:"email,omitempty" db:"developerEmail"`
+	Website  string `json:"website,omitempty" db:"developerWebsite"`
+	Address  string `json:"address,omitempty" db:"developerAddress"`
+	Phone    string `json:"phone,omitempty" db:"developerPhone"`
+	Domain   string `json:"domain,omitempty" db:"developerDomain"`
+	Contacts string `json:"contacts,omitempty" db:"developerContactsText"`
 }
 
 type Keywords map[string]int
+
+// Diff compares application snapshot with the next one and return
+// changes of tracked fields
+// @params
+//	next: App (newer application snapshot)
+//	at: time.Time (time when changes was detected)
+// @return
+//	[]Change (field level changes)
+func (a App) Diff(next App, at time.Time) []Change {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"version", a.Version, next.Version},
+		{"rating", a.Rating, next.Rating},
+		{"installs", a.Installs, next.Installs},
+		{"price", a.Price, next.Price},
+		{"description", a.Description, next.Description},
+	}
+
+	changes := make([]Change, 0)
+	for _, f := range fields {
+		if f.old == f.new {
+			continue
+		}
+		changes = append(changes, Change{
+			Bundle:   next.Bundle,
+			Field:    f.name,
+			Old:      f.old,
+			New:      f.new,
+			Detected: at,
+		})
+	}
+
+	return changes
+}
+
+// Change of application field between two snapshots
+type Change struct {
+	Bundle   string    `json:"bundle" db:"bundle"`
+	Field    string    `json:"field" db:"field"`
+	Old      string    `json:"old" db:"oldValue"`
+	New      string    `json:"new" db:"newValue"`
+	Detected time.Time `json:"detected" db:"detected"`
+}
+
+// StatusError returned if external api response with unsuccessful status
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("external api response with status %d", e.Code)
+}
+
+// IsNotFound reports whether the error is the external api response
+// with status 404
+func IsNotFound(err error) bool {
+	var e *StatusError
+	if errors.As(err, &e) {
+		return e.Code == http.StatusNotFound
+	}
+
+	return false
+}
@@ -2,7 +2,11 @@ package inhuman_test
 
 import (
 	"Nani/internal/app/inhuman"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestAppString_ShouldReturnStringRepresentationOfFields_NoError(t *testing.T) {
@@ -32,6 +36,31 @@ func TestAppString_ShouldReturnStringRepresentationOfFields_NoError(t *testing.T
 		PrivacyPolicy:     "http://localhost/hello",
 	}
 
-	str := app.Fields()
+	str := app.String()
 	t.Log(str)
 }
+
+func TestAppDiff_ShouldReturnChangesOfTrackedFields_NoError(t *testing.T) {
+	prev := inhuman.App{Bundle: "com.ky", Version: "1.0", Rating: "4.3", Price: "", Title: "title"}
+	next := inhuman.App{Bundle: "com.ky", Version: "1.1", Rating: "4.3", Price: "99", Title: "new title"}
+	at := time.Now()
+
+	changes := prev.Diff(next, at)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, inhuman.Change{Bundle: "com.ky", Field: "version", Old: "1.0", New: "1.1", Detected: at}, changes[0])
+	assert.Equal(t, inhuman.Change{Bundle: "com.ky", Field: "price", Old: "", New: "99", Detected: at}, changes[1])
+}
+
+func TestAppDiff_ShouldReturnEmptySliceCozNothingChanged_NoError(t *testing.T) {
+	app := inhuman.App{Bundle: "com.ky", Version: "1.0", Description: "hi"}
+
+	assert.Empty(t, app.Diff(app, time.Now()))
+}
+
+func TestIsNotFound_ShouldReturnTrueOnlyFor404StatusError_NoError(t *testing.T) {
+	assert.True(t, inhuman.IsNotFound(&inhuman.StatusError{Code: 404}))
+	assert.True(t, inhuman.IsNotFound(fmt.Errorf("wrapped %w", &inhuman.StatusError{Code: 404})))
+	assert.False(t, inhuman.IsNotFound(&inhuman.StatusError{Code: 500}))
+	assert.False(t, inhuman.IsNotFound(errors.New("external api response with status 404")))
+	assert.Equal(t, "external api response with status 404", (&inhuman.StatusError{Code: 404}).Error())
+}
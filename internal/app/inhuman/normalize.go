@@ -0,0 +1,329 @@
+package inhuman
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// NormalizedApp is typed representation of application string fields
+type NormalizedApp struct {
+	Bundle          string    `json:"bundle" db:"bundle"`
+	Rating          float64   `json:"rating" db:"rating"`
+	ReviewCount     int64     `json:"reviewCount" db:"reviewCount"`
+	MinInstalls     int64     `json:"minInstalls" db:"minInstalls"`
+	PriceMinor      int64     `json:"priceMinor" db:"priceMinor"`
+	Currency        string    `json:"currency" db:"currency"`
+	SizeBytes       int64     `json:"sizeBytes" db:"sizeBytes"`
+	ReleaseDate     time.Time `json:"releaseDate" db:"releaseDate,Nullable(Date)"`
+	LastUpdateDate  time.Time `json:"lastUpdateDate" db:"lastUpdateDate,Nullable(Date)"`
+	RatingHistogram []int64   `json:"ratingHistogram" db:"ratingHistogram"`
+}
+
+// NormalizeError contains all fields which can not be parsed
+type NormalizeError struct {
+	Bundle string
+	Fields map[string]error
+}
+
+func (e *NormalizeError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for k, v := range e.Fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", k, v))
+	}
+
+	return fmt.Sprintf("can not normalize app %s (%s)", e.Bundle, strings.Join(fields, "; "))
+}
+
+var currencies = []struct {
+	symbol string
+	code   string
+}{
+	{"US$", "USD"},
+	{"$", "USD"},
+	{"₽", "RUB"},
+	{"руб.", "RUB"},
+	{"€", "EUR"},
+	{"£", "GBP"},
+	{"₴", "UAH"},
+	{"₸", "KZT"},
+	{"₹", "INR"},
+	{"¥", "JPY"},
+	{"₩", "KRW"},
+}
+
+// minorUnits is exponent of minor unit for currencies which differ
+// from default cents, like JPY without minor unit at all
+var minorUnits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+}
+
+var multipliers = map[string]float64{
+	"k":    1e3,
+	"тыс.": 1e3,
+	"тыс":  1e3,
+	"m":    1e6,
+	"млн":  1e6,
+	"млн.": 1e6,
+	"b":    1e9,
+	"млрд": 1e9,
+}
+
+var sizes = map[string]float64{
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"кб": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"мб": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+	"гб": 1 << 30,
+}
+
+var months = map[string]time.Month{
+	"янв": time.January, "фев": time.February, "мар": time.March, "апр": time.April,
+	"мая": time.May, "май": time.May, "июн": time.June, "июл": time.July, "авг": time.August,
+	"сен": time.September, "окт": time.October, "ноя": time.November, "дек": time.December,
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// Normalize parse string fields of application to typed record
+// @params
+//	app: *App (application)
+//	locale: string (language of application fields, ru or en)
+// @return
+//	*NormalizedApp (typed record, fields which can not be parsed are zero)
+//	error (*NormalizeError if some fields can not be parsed)
+func Normalize(app *App, locale string) (*NormalizedApp, error) {
+	n := &NormalizedApp{
+		Bundle:          app.Bundle,
+		RatingHistogram: make([]int64, len(app.RatingHistogram)),
+	}
+	fails := make(map[string]error)
+	var err error
+
+	if n.Rating, err = ParseDecimal(app.Rating, locale); err != nil {
+		fails["rating"] = err
+	}
+	if n.ReviewCount, err = ParseCount(app.ReviewCount, locale); err != nil {
+		fails["reviewCount"] = err
+	}
+	if n.MinInstalls, err = ParseCount(app.Installs, locale); err != nil {
+		fails["installs"] = err
+	}
+	if n.PriceMinor, n.Currency, err = ParsePrice(app.Price, locale); err != nil {
+		fails["price"] = err
+	}
+	if n.SizeBytes, err = ParseSize(app.AppSize, locale); err != nil {
+		fails["appSize"] = err
+	}
+	if n.ReleaseDate, err = ParseDate(app.ReleaseDate); err != nil {
+		fails["releaseDate"] = err
+	}
+	if n.LastUpdateDate, err = ParseDate(app.LastUpdateDate); err != nil {
+		fails["lastUpdateDate"] = err
+	}
+	for i, v := range app.RatingHistogram {
+		if n.RatingHistogram[i], err = ParseCount(v, locale); err != nil {
+			fails["ratingHistogram"] = err
+		}
+	}
+
+	if len(fails) > 0 {
+		return n, &NormalizeError{Bundle: app.Bundle, Fields: fails}
+	}
+
+	return n, nil
+}
+
+// ParseDecimal parse decimal number in format of given locale,
+// for example 4.5 or 1,234.5 for en and 4,5 or 1 234,5 for ru
+func ParseDecimal(s, locale string) (float64, error) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return 0, nil
+	}
+
+	if commaDecimal(locale) {
+		s = strings.ReplaceAll(s, ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// commaDecimal check if locale writes decimal point as comma
+func commaDecimal(locale string) bool {
+	return locale == "ru"
+}
+
+// ParseCount parse count like 10 002, 1,000,000+, 10K+ or 5 млн+ in format
+// of given locale. Comma is decimal point for ru, like 1,2 млн, and
+// thousands separator for en. Fractional counts are rounded
+func ParseCount(s, locale string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "+")))
+	if s == "" {
+		return 0, nil
+	}
+
+	var digits, suffix strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsDigit(r):
+			digits.WriteRune(r)
+		case r == '.' && suffix.Len() == 0:
+			digits.WriteRune(r)
+		case r == ',' && suffix.Len() == 0 && commaDecimal(locale):
+			digits.WriteRune('.')
+		case unicode.IsLetter(r) || suffix.Len() > 0:
+			suffix.WriteRune(r)
+		}
+	}
+	if digits.Len() == 0 {
+		return 0, fmt.Errorf("no digits in %q", s)
+	}
+
+	m := 1.0
+	if suffix.Len() > 0 {
+		v, ok := multipliers[strings.TrimSpace(suffix.String())]
+		if !ok {
+			return 0, fmt.Errorf("unknown multiplier in %q", s)
+		}
+		m = v
+	}
+
+	if !strings.Contains(digits.String(), ".") {
+		v, err := strconv.ParseInt(digits.String(), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return v * int64(m), nil
+	}
+	v, err := strconv.ParseFloat(digits.String(), 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(math.Round(v * m)), nil
+}
+
+// ParsePrice parse price like $0.99 or 149,00 ₽ to minor units and currency code.
+// Minor units are cents for most currencies and whole units for JPY and KRW.
+// Empty and free prices are 0 without currency
+func ParsePrice(s, locale string) (int64, string, error) {
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	if s == "" || s == "0" || lower == "free" || lower == "бесплатно" {
+		return 0, "", nil
+	}
+
+	currency := ""
+	for _, c := range currencies {
+		if strings.Contains(s, c.symbol) {
+			currency = c.code
+			s = strings.ReplaceAll(s, c.symbol, "")
+			break
+		}
+	}
+	if currency == "" {
+		fields := strings.Fields(s)
+		for _, f := range fields {
+			if len(f) == 3 && strings.ToUpper(f) == f && !unicode.IsDigit(rune(f[0])) {
+				currency = f
+				s = strings.ReplaceAll(s, f, "")
+				break
+			}
+		}
+	}
+
+	v, err := ParseDecimal(s, locale)
+	if err != nil {
+		return 0, "", err
+	}
+
+	exp, ok := minorUnits[currency]
+	if !ok {
+		exp = 2
+	}
+
+	return int64(math.Round(v * math.Pow10(exp))), currency, nil
+}
+
+// ParseSize parse application size like 10M, 1,5 ГБ or 512k to bytes.
+// Size which varies with device is 0
+func ParseSize(s, locale string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || strings.HasPrefix(s, "varies") || strings.HasPrefix(s, "зависит") {
+		return 0, nil
+	}
+
+	i := strings.IndexFunc(s, unicode.IsLetter)
+	if i < 0 {
+		v, err := ParseDecimal(s, locale)
+		return int64(v), err
+	}
+	m, ok := sizes[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit in %q", s)
+	}
+	v, err := ParseDecimal(s[:i], locale)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(math.Round(v * m)), nil
+}
+
+// ParseDate parse date in formats 2020-06-20, June 20, 2020 or 20 июня 2020 г.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+	if len(fields) < 3 {
+		return time.Time{}, fmt.Errorf("unknown date format %q", s)
+	}
+
+	day, month := fields[0], fields[1]
+	if _, err := strconv.Atoi(day); err != nil {
+		day, month = month, day
+	}
+	d, err := strconv.Atoi(day)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown date format %q", s)
+	}
+	y, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown date format %q", s)
+	}
+	runes := []rune(month)
+	if len(runes) < 3 {
+		return time.Time{}, fmt.Errorf("unknown month in %q", s)
+	}
+	m, ok := months[string(runes[:3])]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown month in %q", s)
+	}
+
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+}
@@ -0,0 +1,154 @@
+package inhuman_test
+
+import (
+	"Nani/internal/app/inhuman"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNormalize_ShouldParseRuApplicationFields_NoError(t *testing.T) {
+	app := &inhuman.App{
+		Bundle:          "com.ky",
+		Rating:          "4,3",
+		ReviewCount:     "10 002",
+		Installs:        "1 000 000+",
+		Price:           "149,00 ₽",
+		AppSize:         "1,5 ГБ",
+		ReleaseDate:     "20 июня 2020 г.",
+		LastUpdateDate:  "29 июля 2020 г.",
+		RatingHistogram: []string{"515", "1 323", "12333"},
+	}
+
+	n, err := inhuman.Normalize(app, "ru")
+	assert.NoError(t, err)
+	assert.Equal(t, "com.ky", n.Bundle)
+	assert.Equal(t, 4.3, n.Rating)
+	assert.Equal(t, int64(10002), n.ReviewCount)
+	assert.Equal(t, int64(1000000), n.MinInstalls)
+	assert.Equal(t, int64(14900), n.PriceMinor)
+	assert.Equal(t, "RUB", n.Currency)
+	assert.Equal(t, int64(1610612736), n.SizeBytes)
+	assert.Equal(t, time.Date(2020, time.June, 20, 0, 0, 0, 0, time.UTC), n.ReleaseDate)
+	assert.Equal(t, time.Date(2020, time.July, 29, 0, 0, 0, 0, time.UTC), n.LastUpdateDate)
+	assert.Equal(t, []int64{515, 1323, 12333}, n.RatingHistogram)
+}
+
+func TestNormalize_ShouldParseRuCountsWithDecimalComma_NoError(t *testing.T) {
+	app := &inhuman.App{Bundle: "com.ky", ReviewCount: "4,5 тыс.", Installs: "1,2 млн+"}
+
+	n, err := inhuman.Normalize(app, "ru")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4500), n.ReviewCount)
+	assert.Equal(t, int64(1200000), n.MinInstalls)
+}
+
+func TestNormalize_ShouldParseEnApplicationFields_NoError(t *testing.T) {
+	app := &inhuman.App{
+		Bundle:         "com.ky",
+		Rating:         "4.5",
+		ReviewCount:    "1,234,567",
+		Installs:       "10M+",
+		Price:          "$1,299.99",
+		AppSize:        "25M",
+		ReleaseDate:    "June 20, 2020",
+		LastUpdateDate: "2020-07-29",
+	}
+
+	n, err := inhuman.Normalize(app, "en")
+	assert.NoError(t, err)
+	assert.Equal(t, 4.5, n.Rating)
+	assert.Equal(t, int64(1234567), n.ReviewCount)
+	assert.Equal(t, int64(10000000), n.MinInstalls)
+	assert.Equal(t, int64(129999), n.PriceMinor)
+	assert.Equal(t, "USD", n.Currency)
+	assert.Equal(t, int64(25*1024*1024), n.SizeBytes)
+	assert.Equal(t, time.Date(2020, time.June, 20, 0, 0, 0, 0, time.UTC), n.ReleaseDate)
+	assert.Equal(t, time.Date(2020, time.July, 29, 0, 0, 0, 0, time.UTC), n.LastUpdateDate)
+}
+
+func TestNormalize_ShouldReturnZeroValuesForEmptyAndFreeFields_NoError(t *testing.T) {
+	app := &inhuman.App{Bundle: "com.ky", Price: "Бесплатно", AppSize: "Зависит от устройства"}
+
+	n, err := inhuman.Normalize(app, "ru")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, n.Rating)
+	assert.Equal(t, int64(0), n.PriceMinor)
+	assert.Equal(t, "", n.Currency)
+	assert.Equal(t, int64(0), n.SizeBytes)
+	assert.True(t, n.ReleaseDate.IsZero())
+}
+
+func TestNormalize_ShouldReturnPartialRecordAndFieldsErrors_Error(t *testing.T) {
+	app := &inhuman.App{Bundle: "com.ky", Rating: "4.1", Installs: "many", ReleaseDate: "yesterday"}
+
+	n, err := inhuman.Normalize(app, "en")
+	assert.Error(t, err)
+	assert.NotNil(t, n)
+	assert.Equal(t, 4.1, n.Rating)
+
+	var e *inhuman.NormalizeError
+	assert.True(t, errors.As(err, &e))
+	assert.Len(t, e.Fields, 2)
+	assert.Contains(t, e.Fields, "installs")
+	assert.Contains(t, e.Fields, "releaseDate")
+}
+
+func TestParseCount_ShouldParseCountsWithMultipliers_NoError(t *testing.T) {
+	cases := map[string]int64{
+		"100000+":   100000,
+		"5 млн+":    5000000,
+		"10 тыс.+":  10000,
+		"1.5K":      1500,
+		"1,000,000": 1000000,
+		"4.5":       5,
+		"1,234.4":   1234,
+		"":          0,
+	}
+	for s, expected := range cases {
+		v, err := inhuman.ParseCount(s, "en")
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, v, s)
+	}
+}
+
+func TestParseCount_ShouldParseRuCountsWithDecimalComma_NoError(t *testing.T) {
+	cases := map[string]int64{
+		"1,2 млн":     1200000,
+		"4,5 тыс.":    4500,
+		"1,5 млрд+":   1500000000,
+		"10 000 000+": 10000000,
+		"5 млн+":      5000000,
+		"1\u00a0234":  1234,
+		"":            0,
+	}
+	for s, expected := range cases {
+		v, err := inhuman.ParseCount(s, "ru")
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, v, s)
+	}
+}
+
+func TestParsePrice_ShouldParsePricesWithDifferentCurrencies_NoError(t *testing.T) {
+	cases := []struct {
+		s, locale, currency string
+		minor               int64
+	}{
+		{"$0.99", "en", "USD", 99},
+		{"US$4.99", "en", "USD", 499},
+		{"99 ₽", "ru", "RUB", 9900},
+		{"1,09 €", "ru", "EUR", 109},
+		{"¥120", "en", "JPY", 120},
+		{"₩1,200", "en", "KRW", 1200},
+		{"£1.50", "en", "GBP", 150},
+		{"0", "en", "", 0},
+		{"Free", "en", "", 0},
+	}
+	for _, c := range cases {
+		minor, currency, err := inhuman.ParsePrice(c.s, c.locale)
+		assert.NoError(t, err, c.s)
+		assert.Equal(t, c.minor, minor, c.s)
+		assert.Equal(t, c.currency, currency, c.s)
+	}
+}
@@ -0,0 +1,241 @@
+package keywords
+
+import (
+	"Nani/internal/app/inhuman"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Extractor returns keywords of application text, it has the same
+// contract as inhuman.ExternalApi Keys
+type Extractor interface {
+	Keys(title, description, shortDescription, reviews string) (inhuman.Keywords, error)
+}
+
+const (
+	// Longest phrase of keyword in words
+	maxNgram = 2
+	// Shortest word of keyword in letters
+	minWord = 3
+	// Max number of terms in document frequencies of corpus
+	maxVocabulary = 100000
+	// Number of keywords returned if count is not set
+	defaultCount = 10
+)
+
+// Weights of application fields in term frequency
+const (
+	titleWeight       = 3.0
+	shortWeight       = 2.0
+	descriptionWeight = 1.0
+	reviewsWeight     = 1.0
+)
+
+// Local extracts keywords without external api. Candidates are words and
+// phrases of application text without stopwords, they are scored by TF-IDF
+// over the corpus of applications learned so far. Longer phrases score higher
+type Local struct {
+	rules language
+	count int
+	docs  int
+	df    map[string]int
+	mutex sync.RWMutex
+}
+
+// Learn adds application text to the corpus
+func (l *Local) Learn(title, description, shortDescription, reviews string) {
+	terms := make(map[string]struct{})
+	for _, text := range []string{title, description, shortDescription, reviews} {
+		for _, t := range l.terms(text) {
+			terms[t] = struct{}{}
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.docs++
+	for t := range terms {
+		if _, ok := l.df[t]; ok || len(l.df) < maxVocabulary {
+			l.df[t]++
+		}
+	}
+}
+
+// Keys return the strongest keywords of application text. Weight of keyword
+// is its score multiplied by 10, so weights are comparable in one text only
+// @params
+//	title: string
+//	description: string
+//	shortDescription: string
+//	reviews: string
+// @return
+//	inhuman.Keywords
+//	error
+func (l *Local) Keys(title, description, shortDescription, reviews string) (inhuman.Keywords, error) {
+	tf := make(map[string]float64)
+	fields := []struct {
+		text   string
+		weight float64
+	}{
+		{title, titleWeight},
+		{shortDescription, shortWeight},
+		{description, descriptionWeight},
+		{reviews, reviewsWeight},
+	}
+	for _, f := range fields {
+		for _, t := range l.terms(f.text) {
+			tf[t] += f.weight
+		}
+	}
+
+	type scored struct {
+		term  string
+		score float64
+	}
+	scores := make([]scored, 0, len(tf))
+	l.mutex.RLock()
+	for t, f := range tf {
+		idf := math.Log(float64(1+l.docs)/float64(1+l.df[t])) + 1
+		scores = append(scores, scored{t, f * idf * float64(strings.Count(t, " ")+1)})
+	}
+	l.mutex.RUnlock()
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].score != scores[j].score {
+			return scores[i].score > scores[j].score
+		}
+		return scores[i].term < scores[j].term
+	})
+	if len(scores) > l.count {
+		scores = scores[:l.count]
+	}
+
+	keys := make(inhuman.Keywords, len(scores))
+	for _, v := range scores {
+		keys[v.term] = int(math.Max(1, math.Round(v.score*10)))
+	}
+
+	return keys, nil
+}
+
+// terms return candidate keywords of text. Text is split to phrases by
+// punctuation and stopwords, candidates are n-grams of phrase
+func (l *Local) terms(text string) []string {
+	terms := make([]string, 0)
+	for _, phrase := range l.phrases(text) {
+		for n := 1; n <= maxNgram; n++ {
+			for i := 0; i+n <= len(phrase); i++ {
+				terms = append(terms, strings.Join(phrase[i:i+n], " "))
+			}
+		}
+	}
+
+	return terms
+}
+
+// phrases split text to the sequences of folded words which are not stopwords
+func (l *Local) phrases(text string) [][]string {
+	chunks := strings.FieldsFunc(strings.Map(fold, text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	})
+
+	phrases := make([][]string, 0)
+	for _, c := range chunks {
+		phrase := make([]string, 0)
+		for _, w := range strings.Fields(c) {
+			if _, ok := l.rules.stopwords[w]; ok || !isWord(w) {
+				if len(phrase) > 0 {
+					phrases = append(phrases, phrase)
+				}
+				phrase = make([]string, 0)
+				continue
+			}
+			phrase = append(phrase, w)
+		}
+		if len(phrase) > 0 {
+			phrases = append(phrases, phrase)
+		}
+	}
+
+	return phrases
+}
+
+// isWord check if word is long enough and is not a number
+func isWord(w string) bool {
+	if utf8.RuneCountInString(w) < minWord {
+		return false
+	}
+	for _, r := range w {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Fallback uses secondary extractor when primary fails and counts
+// how many times it was used
+type Fallback struct {
+	primary   Extractor
+	secondary Extractor
+	onFail    func(err error)
+	used      int
+	mutex     sync.Mutex
+}
+
+func (f *Fallback) Keys(title, description, shortDescription, reviews string) (inhuman.Keywords, error) {
+	keys, err := f.primary.Keys(title, description, shortDescription, reviews)
+	if err == nil {
+		return keys, nil
+	}
+
+	f.mutex.Lock()
+	f.used++
+	f.mutex.Unlock()
+	if f.onFail != nil {
+		f.onFail(err)
+	}
+
+	return f.secondary.Keys(title, description, shortDescription, reviews)
+}
+
+// Used return number of times secondary extractor was used
+func (f *Fallback) Used() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.used
+}
+
+// Create new extractor which uses secondary extractor if primary returns error
+// @params
+//	primary: Extractor (like external api)
+//	secondary: Extractor (like local extractor)
+//	onFail: func(err error) (called with error of primary, can be nil)
+// @return
+//	*Fallback
+func NewFallback(primary, secondary Extractor, onFail func(err error)) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary, onFail: onFail}
+}
+
+// Create new local extractor
+// @params
+//	lang: string (language of stopwords, like config.Hl)
+//	count: int (max number of keywords, like config.KeysCount)
+// @return
+//	*Local
+func NewLocal(lang string, count int) *Local {
+	if count <= 0 {
+		count = defaultCount
+	}
+
+	return &Local{
+		rules: languages[strings.ToLower(lang)],
+		count: count,
+		df:    make(map[string]int),
+	}
+}
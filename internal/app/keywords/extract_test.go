@@ -0,0 +1,80 @@
+package keywords_test
+
+import (
+	"Nani/internal/app/inhuman"
+	"Nani/internal/app/keywords"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type failingExtractor struct{}
+
+func (failingExtractor) Keys(title, description, shortDescription, reviews string) (inhuman.Keywords, error) {
+	return nil, fmt.Errorf("endpoint is down")
+}
+
+type staticExtractor struct{}
+
+func (staticExtractor) Keys(title, description, shortDescription, reviews string) (inhuman.Keywords, error) {
+	return inhuman.Keywords{"api": 1}, nil
+}
+
+func TestLocalKeys_ShouldExtractKeywordsWithoutStopwords_NoError(t *testing.T) {
+	l := keywords.NewLocal("en", 5)
+	keys, err := l.Keys(
+		"Farm Story: Harvest Town",
+		"Build your farm, harvest crops and trade with the town. The best farm game of 2020!",
+		"Farm game for the whole family",
+		"",
+	)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 5)
+	assert.Contains(t, keys, "farm")
+	assert.Contains(t, keys, "farm game")
+	for k, v := range keys {
+		assert.NotContains(t, []string{"the", "and", "with", "2020"}, k)
+		assert.True(t, v > 0, k)
+	}
+	assert.True(t, keys["farm game"] > keys["harvest"])
+}
+
+func TestLocalKeys_ShouldPreferRareTermsOfCorpus_NoError(t *testing.T) {
+	l := keywords.NewLocal("ru", 10)
+	for i := 0; i < 10; i++ {
+		l.Learn("Игра", fmt.Sprintf("Лучшая игра номер %d", i), "", "")
+	}
+
+	keys, err := l.Keys("Игра про ферму", "Лучшая игра про ферму и урожай", "", "")
+	assert.NoError(t, err)
+	assert.True(t, keys["ферму"] > keys["игра"])
+	assert.True(t, keys["урожай"] > keys["лучшая"])
+	assert.NotContains(t, keys, "про")
+	assert.NotContains(t, keys, "и")
+}
+
+func TestLocalKeys_ShouldReturnEmptyKeywordsForEmptyText_NoError(t *testing.T) {
+	keys, err := keywords.NewLocal("en", 0).Keys("", "", "", "!!!")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestFallback_ShouldUseSecondaryExtractorWhenPrimaryFails_NoError(t *testing.T) {
+	local := keywords.NewLocal("en", 3)
+	var failed []error
+	f := keywords.NewFallback(failingExtractor{}, local, func(err error) { failed = append(failed, err) })
+	keys, err := f.Keys("Racing cars", "", "", "")
+	assert.NoError(t, err)
+	assert.Contains(t, keys, "racing cars")
+	assert.Equal(t, 1, f.Used())
+	assert.Len(t, failed, 1)
+
+	f = keywords.NewFallback(staticExtractor{}, local, nil)
+	keys, err = f.Keys("Racing cars", "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, inhuman.Keywords{"api": 1}, keys)
+	assert.Equal(t, 0, f.Used())
+
+	_, err = keywords.NewFallback(failingExtractor{}, failingExtractor{}, nil).Keys("Racing cars", "", "", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,149 @@
+package keywords
+
+import (
+	"Nani/internal/app/config"
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+// Name of rejection when keyword does not match any allow rule
+const NotAllowed = "allow"
+
+// rule is compiled config.KeywordRule
+type rule struct {
+	name   string
+	exact  map[string]struct{}
+	regex  *regexp.Regexp
+	minLen int
+	maxLen int
+}
+
+// match check if all set conditions of rule match keyword. Regex matches
+// keyword as api returned it, other conditions match cleaned keyword
+func (r rule) match(raw, key string) bool {
+	if r.exact != nil {
+		if _, ok := r.exact[key]; !ok {
+			return false
+		}
+	}
+	if r.regex != nil && !r.regex.MatchString(raw) {
+		return false
+	}
+	n := utf8.RuneCountInString(key)
+	if r.minLen > 0 && n < r.minLen {
+		return false
+	}
+	if r.maxLen > 0 && n > r.maxLen {
+		return false
+	}
+
+	return true
+}
+
+// Filter decides which keywords are queued by allow and deny rules
+// and counts rejected keywords by rule
+type Filter struct {
+	allow    []rule
+	deny     []rule
+	rejected map[string]int
+	mutex    sync.Mutex
+}
+
+// Allow check if keyword passes the rules. Keyword matching any deny rule
+// is rejected, then keyword must match one of allow rules if they are set
+// @params
+//	raw: string (keyword as it is returned by api)
+// @return
+//	bool
+func (f *Filter) Allow(raw string) bool {
+	key := Clean(raw)
+	for _, r := range f.deny {
+		if r.match(raw, key) {
+			f.reject(r.name)
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, r := range f.allow {
+		if r.match(raw, key) {
+			return true
+		}
+	}
+	f.reject(NotAllowed)
+
+	return false
+}
+
+// Rejected return number of rejected keywords by rule name
+func (f *Filter) Rejected() map[string]int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	rejected := make(map[string]int, len(f.rejected))
+	for k, v := range f.rejected {
+		rejected[k] = v
+	}
+
+	return rejected
+}
+
+func (f *Filter) reject(name string) {
+	f.mutex.Lock()
+	f.rejected[name]++
+	f.mutex.Unlock()
+}
+
+// compile rules of config, rule without name is named by kind and index
+func compile(kind string, rules []config.KeywordRule) ([]rule, error) {
+	compiled := make([]rule, len(rules))
+	for i, v := range rules {
+		r := rule{name: v.Name, minLen: v.MinLen, maxLen: v.MaxLen}
+		if r.name == "" {
+			r.name = fmt.Sprintf("%s:%d", kind, i)
+		}
+		if len(v.Exact) > 0 {
+			r.exact = make(map[string]struct{}, len(v.Exact))
+			for _, e := range v.Exact {
+				r.exact[Clean(e)] = struct{}{}
+			}
+		}
+		if v.Regex != "" {
+			regex, err := regexp.Compile(v.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex of keyword rule %s: %s", r.name, err)
+			}
+			r.regex = regex
+		}
+		compiled[i] = r
+	}
+
+	return compiled, nil
+}
+
+// Create new filter of keywords. Returns error which names the rule
+// if its regex is invalid
+// @params
+//	conf: config.KeywordsConfig (allow and deny rules)
+// @return
+//	*Filter
+//	error
+func NewFilter(conf config.KeywordsConfig) (*Filter, error) {
+	allow, err := compile("allow", conf.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := compile("deny", conf.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{
+		allow:    allow,
+		deny:     deny,
+		rejected: make(map[string]int),
+	}, nil
+}
@@ -0,0 +1,57 @@
+package keywords_test
+
+import (
+	"Nani/internal/app/config"
+	"Nani/internal/app/keywords"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilter_ShouldRejectKeywordsByDenyRules_NoError(t *testing.T) {
+	f, err := keywords.NewFilter(config.KeywordsConfig{
+		Deny: []config.KeywordRule{
+			{Name: "brands", Exact: []string{"Nani", "Our Game"}},
+			{Name: "adult", Regex: `(?i)(^|\s)(18\+|xxx)(\s|$)`},
+			{Name: "short", MaxLen: 2},
+			{Regex: `(?i)^casino`, MinLen: 10},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.False(t, f.Allow("NANI"))
+	assert.False(t, f.Allow("our  game!"))
+	assert.True(t, f.Allow("nani games"))
+	assert.False(t, f.Allow("games 18+"))
+	assert.True(t, f.Allow("games 18"))
+	assert.False(t, f.Allow("Go"))
+	assert.True(t, f.Allow("игра"))
+	assert.True(t, f.Allow("casino"))
+	assert.False(t, f.Allow("casino slots"))
+
+	assert.Equal(t, map[string]int{"brands": 2, "adult": 1, "short": 1, "deny:3": 1}, f.Rejected())
+}
+
+func TestFilter_ShouldQueueOnlyAllowedKeywords_NoError(t *testing.T) {
+	f, err := keywords.NewFilter(config.KeywordsConfig{
+		Allow: []config.KeywordRule{{Name: "cyrillic", Regex: `(?i)^[а-яё0-9 ]+$`, MinLen: 3}},
+		Deny:  []config.KeywordRule{{Name: "brands", Exact: []string{"игры"}}},
+	})
+	assert.NoError(t, err)
+
+	assert.True(t, f.Allow("Гонки"))
+	assert.False(t, f.Allow("games"))
+	assert.False(t, f.Allow("ии"))
+	assert.False(t, f.Allow("Игры"))
+
+	assert.Equal(t, map[string]int{keywords.NotAllowed: 2, "brands": 1}, f.Rejected())
+}
+
+func TestNewFilter_ShouldReturnErrorWithRuleNameCozRegexIsInvalid_Error(t *testing.T) {
+	_, err := keywords.NewFilter(config.KeywordsConfig{Deny: []config.KeywordRule{{Name: "adult", Regex: "("}}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "adult")
+
+	_, err = keywords.NewFilter(config.KeywordsConfig{Allow: []config.KeywordRule{{}, {Regex: "[a-"}}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "allow:1")
+}
@@ -0,0 +1,87 @@
+package keywords
+
+import (
+	"strings"
+	"unicode"
+)
+
+// language rules of keyword normalization
+type language struct {
+	stopwords map[string]struct{}
+	stem      func(word string) string
+}
+
+// Languages supported by normalization, other languages are only cleaned
+var languages = map[string]language{
+	"ru": {stopwords: set(ruStopwords), stem: stemRu},
+	"en": {stopwords: set(enStopwords), stem: stemEn},
+}
+
+// Clean return keyword in folded case with words separated by one space.
+// Punctuation and symbols are removed, digits are kept
+// @params
+//	key: string (keyword as it is returned by api)
+// @return
+//	string
+func Clean(key string) string {
+	return strings.Join(words(key), " ")
+}
+
+// Normalize return form of keyword which is the same for its near-duplicates.
+// Keyword is cleaned, stopwords are removed and words are stemmed by rules
+// of language. Empty string is returned if keyword has only stopwords
+// @params
+//	key: string (keyword as it is returned by api)
+//	lang: string (language of keyword, like config.Hl)
+// @return
+//	string
+func Normalize(key, lang string) string {
+	ws := words(key)
+	rules, ok := languages[strings.ToLower(lang)]
+	if !ok {
+		return strings.Join(ws, " ")
+	}
+
+	res := make([]string, 0, len(ws))
+	for _, w := range ws {
+		if _, ok := rules.stopwords[w]; ok {
+			continue
+		}
+		res = append(res, rules.stem(w))
+	}
+
+	return strings.Join(res, " ")
+}
+
+// words split keyword to the folded words
+func words(key string) []string {
+	return strings.FieldsFunc(strings.Map(fold, key), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// fold return the same rune for all cases of letter. Cyrillic ё is folded
+// to е, they are used interchangeably
+func fold(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	r = unicode.ToLower(min)
+	if r == 'ё' {
+		return 'е'
+	}
+
+	return r
+}
+
+func set(words []string) map[string]struct{} {
+	m := make(map[string]struct{}, len(words))
+	for _, v := range words {
+		m[v] = struct{}{}
+	}
+
+	return m
+}
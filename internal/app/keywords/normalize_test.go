@@ -0,0 +1,45 @@
+package keywords_test
+
+import (
+	"Nani/internal/app/keywords"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalize_ShouldMergeRuNearDuplicates_NoError(t *testing.T) {
+	for _, v := range []string{"игры", "игра", "Игры", " ИГРЫ! ", "игр"} {
+		assert.Equal(t, "игр", keywords.Normalize(v, "ru"), v)
+	}
+	assert.Equal(t, "игр гонк", keywords.Normalize("Игры и гонки", "ru"))
+	assert.Equal(t, "елк", keywords.Normalize("Ёлки", "ru"))
+	assert.Equal(t, "игров автомат", keywords.Normalize("игровые автоматы", "ru"))
+	assert.Equal(t, "игров автомат", keywords.Normalize("Игровой автомат", "RU"))
+}
+
+func TestNormalize_ShouldMergeEnNearDuplicates_NoError(t *testing.T) {
+	for _, v := range []string{"Games", "game", "GAME", "the games"} {
+		assert.Equal(t, "game", keywords.Normalize(v, "en"), v)
+	}
+	assert.Equal(t, "story", keywords.Normalize("Stories", "en"))
+	assert.Equal(t, "bus", keywords.Normalize("bus", "en"))
+	assert.Equal(t, "class", keywords.Normalize("class", "en"))
+	assert.Equal(t, "wi fi 5g", keywords.Normalize("Wi-Fi 5G", "en"))
+}
+
+func TestNormalize_ShouldReturnEmptyStringForStopwords_NoError(t *testing.T) {
+	assert.Empty(t, keywords.Normalize("и в на", "ru"))
+	assert.Empty(t, keywords.Normalize("The, of!", "en"))
+	assert.Empty(t, keywords.Normalize(" ... ", "en"))
+}
+
+func TestNormalize_ShouldOnlyCleanUnknownLanguage_NoError(t *testing.T) {
+	assert.Equal(t, "die spiele", keywords.Normalize("Die  Spiele!", "de"))
+	assert.Equal(t, "игры и гонки", keywords.Normalize("Игры и гонки", ""))
+}
+
+func TestClean_ShouldFoldCaseAndRemovePunctuation_NoError(t *testing.T) {
+	assert.Equal(t, "игры для детей", keywords.Clean("  Игры, для  ДЕТЕЙ!"))
+	assert.Equal(t, "wi fi", keywords.Clean("WI-FI"))
+	assert.Equal(t, "k", keywords.Clean("K"))
+	assert.Empty(t, keywords.Clean("?!"))
+}
@@ -0,0 +1,46 @@
+package keywords
+
+import "strings"
+
+// Minimal length of russian stem in runes
+const ruMinStem = 3
+
+// Endings of russian nouns and adjectives, longer endings go first
+var ruEndings = []string{
+	"ями", "ами", "иях", "ыми", "ими", "ого", "его", "ому", "ему",
+	"ия", "ию", "ии", "ая", "яя", "ое", "ее", "ые", "ие", "ый", "ий", "ой",
+	"ую", "юю", "ых", "их", "ым", "им", "ов", "ев", "ей", "ам", "ям",
+	"ах", "ях", "ом", "ем",
+	"а", "я", "ы", "и", "е", "у", "ю", "о", "ь", "й",
+}
+
+// stemRu removes inflection ending of russian word, so singular and plural
+// forms of noun and adjective have the same stem
+func stemRu(word string) string {
+	runes := []rune(word)
+	for _, e := range ruEndings {
+		n := len([]rune(e))
+		if len(runes)-n >= ruMinStem && strings.HasSuffix(word, e) {
+			return string(runes[:len(runes)-n])
+		}
+	}
+
+	return word
+}
+
+// stemEn removes plural ending of english word (S-stemmer)
+func stemEn(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies") && !strings.HasSuffix(word, "eies") && !strings.HasSuffix(word, "aies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "es") && !strings.HasSuffix(word, "aes") && !strings.HasSuffix(word, "ees") && !strings.HasSuffix(word, "oes"):
+		return word[:len(word)-1]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+
+	return word
+}
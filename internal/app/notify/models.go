@@ -0,0 +1,28 @@
+package notify
+
+import "time"
+
+const (
+	NewVersion  = "new_version"
+	PriceChange = "price_change"
+	Delisted    = "delisted"
+	NewApp      = "new_app"
+)
+
+// Event about watched application
+type Event struct {
+	Type        string    `json:"type"`
+	Bundle      string    `json:"bundle"`
+	DeveloperId string    `json:"developerId,omitempty"`
+	Old         string    `json:"old,omitempty"`
+	New         string    `json:"new,omitempty"`
+	Detected    time.Time `json:"detected"`
+}
+
+// Delivery of event to webhook which was failed
+type Delivery struct {
+	Url      string `json:"url"`
+	Event    Event  `json:"event"`
+	Attempts int    `json:"attempts"`
+	Er       string `json:"er,omitempty"`
+}
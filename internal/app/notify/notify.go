@@ -0,0 +1,331 @@
+package notify
+
+import (
+	"Nani/internal/app/cache"
+	"Nani/internal/app/config"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache keys of failed deliveries which are redelivered and deliveries
+// which failed max attempts
+const (
+	webhooksKey = "_webhooks"
+	deadKey     = "_webhooks_dead"
+)
+
+// Notifier sends events about watched applications
+type Notifier interface {
+	Watched(bundle, devid string) bool
+	Notify(event Event)
+	Redeliver()
+	Close()
+}
+
+// Webhooks posts signed json events to the configured webhook urls
+type Webhooks struct {
+	Backoff    time.Duration
+	webhooks   map[string]config.WebhookConfig
+	bundles    map[string]struct{}
+	developers map[string]struct{}
+	retries    int
+	attempts   int
+	cache      cache.Storage
+	client     *http.Client
+	events     chan Event
+	done       chan struct{}
+	mutex      sync.Mutex
+	// Guards events channel, so it is never used after close
+	state  sync.RWMutex
+	closed bool
+	// Set while failed deliveries are redelivered
+	redelivering int32
+}
+
+// Watched reports whether application bundle or its developer is in watchlist
+func (w *Webhooks) Watched(bundle, devid string) bool {
+	if _, ok := w.bundles[bundle]; ok {
+		return true
+	}
+	_, ok := w.developers[devid]
+
+	return ok
+}
+
+// Notify queue event for delivering to all webhooks. If the queue is full
+// or notifier is closed event deliveries saved as failed and will be
+// redelivered later
+func (w *Webhooks) Notify(event Event) {
+	w.state.RLock()
+	defer w.state.RUnlock()
+
+	reason := "notifier is closed"
+	if !w.closed {
+		select {
+		case w.events <- event:
+			return
+		default:
+			reason = "notify queue is full"
+		}
+	}
+
+	failed := make([]Delivery, 0, len(w.webhooks))
+	for url := range w.webhooks {
+		failed = append(failed, Delivery{Url: url, Event: event, Er: reason})
+	}
+	w.fail(failed...)
+}
+
+// Redeliver try to send again all failed deliveries. Delivery is removed
+// only after it is sent, delivery which failed max attempts is moved
+// to the dead deliveries. Call made while other one is redelivering
+// returns at once, so deliveries are not sent twice
+func (w *Webhooks) Redeliver() {
+	if !atomic.CompareAndSwapInt32(&w.redelivering, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&w.redelivering, 0)
+
+	w.mutex.Lock()
+	deliveries := w.failed()
+	w.mutex.Unlock()
+
+	for _, d := range deliveries {
+		hook, ok := w.webhooks[d.Url]
+		if !ok {
+			w.settle(d, fmt.Errorf("webhook %s is not configured", d.Url), true)
+			continue
+		}
+		body, err := json.Marshal(d.Event)
+		if err != nil {
+			w.settle(d, err, true)
+			continue
+		}
+		err = w.post(hook, d.Event.Type, body)
+		w.settle(d, err, false)
+	}
+}
+
+// settle update saved delivery after redelivering. Sent delivery is removed,
+// failed one is kept with new number of attempts or moved to the dead
+// deliveries if it can not be sent anymore
+func (w *Webhooks) settle(d Delivery, err error, dead bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	deliveries := w.failed()
+	i := index(deliveries, d)
+	if i < 0 {
+		return
+	}
+	if err == nil {
+		w.cache.Set(webhooksKey, append(deliveries[:i:i], deliveries[i+1:]...))
+		return
+	}
+
+	if !dead {
+		d.Attempts += w.retries
+	}
+	d.Er = err.Error()
+	if dead || d.Attempts >= w.attempts {
+		if err := w.cache.Append(deadKey, d); err != nil {
+			log.Print(err)
+		}
+		w.cache.Set(webhooksKey, append(deliveries[:i:i], deliveries[i+1:]...))
+		return
+	}
+	// Slice is returned by the cache, so it is not changed in place
+	updated := make([]Delivery, len(deliveries))
+	copy(updated, deliveries)
+	updated[i] = d
+	w.cache.Set(webhooksKey, updated)
+}
+
+// Close stops delivering loop after all queued events are sent.
+// Events notified after close are saved as failed deliveries
+func (w *Webhooks) Close() {
+	w.state.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.events)
+	}
+	w.state.Unlock()
+	<-w.done
+}
+
+// run delivers queued events and periodically redelivers failed
+func (w *Webhooks) run(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	defer close(w.done)
+
+	for {
+		select {
+		case e, ok := <-w.events:
+			if !ok {
+				return
+			}
+			w.deliver(e)
+		case <-ticker.C:
+			w.Redeliver()
+		}
+	}
+}
+
+// deliver send event to all webhooks
+func (w *Webhooks) deliver(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	failed := make([]Delivery, 0)
+	for url, hook := range w.webhooks {
+		if err := w.post(hook, event.Type, body); err != nil {
+			failed = append(failed, Delivery{Url: url, Event: event, Attempts: w.retries, Er: err.Error()})
+		}
+	}
+	w.fail(failed...)
+}
+
+// post send body to webhook with retries and exponential backoff
+func (w *Webhooks) post(hook config.WebhookConfig, t string, body []byte) error {
+	var err error
+	for i := 0; i < w.retries; i++ {
+		if i > 0 {
+			time.Sleep(w.Backoff * time.Duration(1<<(i-1)))
+		}
+		if err = w.request(hook, t, body); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// request make single signed post request to webhook
+func (w *Webhooks) request(hook config.WebhookConfig, t string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Nani-Event", t)
+	req.Header.Set("X-Nani-Signature", Sign(hook.Secret, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook response with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// fail save deliveries to the cache
+func (w *Webhooks) fail(deliveries ...Delivery) {
+	if len(deliveries) == 0 {
+		return
+	}
+
+	values := make([]interface{}, len(deliveries))
+	for i, v := range deliveries {
+		values[i] = v
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.cache.Append(webhooksKey, values...); err != nil {
+		log.Print(err)
+	}
+}
+
+// failed return deliveries saved to the cache
+func (w *Webhooks) failed() []Delivery {
+	var deliveries []Delivery
+	if err := w.cache.Get(webhooksKey, &deliveries); err != nil {
+		return []Delivery{}
+	}
+
+	return deliveries
+}
+
+// index return index of the same delivery or -1
+func index(deliveries []Delivery, d Delivery) int {
+	for i, v := range deliveries {
+		if v.Url == d.Url && v.Attempts == d.Attempts && v.Event.Type == d.Event.Type &&
+			v.Event.Bundle == d.Event.Bundle && v.Event.Old == d.Event.Old &&
+			v.Event.New == d.Event.New && v.Event.Detected.Equal(d.Event.Detected) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Sign return hmac sha256 signature of body
+// @params
+//	secret: string (webhook secret)
+//	body: []byte (request body)
+// @return
+//	string (signature in format sha256=<hex>)
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Create new instance of Webhooks and start delivering loop
+func New(watch config.WatchConfig, storage cache.Storage) *Webhooks {
+	retries := watch.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+	attempts := watch.MaxAttempts
+	if attempts <= 0 {
+		attempts = retries * 5
+	}
+	every := watch.RetryEvery
+	if every <= 0 {
+		every = time.Minute * 10
+	}
+
+	w := &Webhooks{
+		Backoff:    time.Second,
+		webhooks:   make(map[string]config.WebhookConfig),
+		bundles:    make(map[string]struct{}),
+		developers: make(map[string]struct{}),
+		retries:    retries,
+		attempts:   attempts,
+		cache:      storage,
+		client:     &http.Client{Timeout: time.Second * 10},
+		events:     make(chan Event, 100),
+		done:       make(chan struct{}),
+	}
+	for _, v := range watch.Webhooks {
+		w.webhooks[v.Url] = v
+	}
+	for _, v := range watch.Bundles {
+		w.bundles[v] = struct{}{}
+	}
+	for _, v := range watch.Developers {
+		w.developers[v] = struct{}{}
+	}
+
+	go w.run(every)
+	return w
+}
@@ -0,0 +1,339 @@
+package notify_test
+
+import (
+	"Nani/internal/app/cache"
+	"Nani/internal/app/config"
+	"Nani/internal/app/notify"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockCache struct {
+	cache map[string]interface{}
+	mutex sync.Mutex
+}
+
+func (m *mockCache) Set(key string, value interface{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cache[key] = value
+}
+
+func (m *mockCache) GetV(key string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, ok := m.cache[key]
+	if !ok {
+		return nil, fmt.Errorf("error key")
+	}
+	return v, nil
+}
+
+func (m *mockCache) Get(key string, out interface{}) error {
+	v, err := m.GetV(key)
+	if err != nil {
+		return err
+	}
+	b, _ := json.Marshal(v)
+
+	return json.Unmarshal(b, out)
+}
+
+func (m *mockCache) Keys(prefix string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	keys := make([]string, 0)
+	for k := range m.cache {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+func (m *mockCache) Delete(keys ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, k := range keys {
+		delete(m.cache, k)
+	}
+
+	return nil
+}
+
+func (m *mockCache) Dump() {}
+
+func (m *mockCache) Append(key string, values ...interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	list, ok := m.cache[key]
+	if !ok {
+		list = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(values[0])), 0, len(values)).Interface()
+	}
+	l := reflect.ValueOf(list)
+	for _, v := range values {
+		l = reflect.Append(l, reflect.ValueOf(v))
+	}
+	m.cache[key] = l.Interface()
+
+	return nil
+}
+
+func (m *mockCache) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, ok := m.cache[key]
+	if ok != (old != nil) {
+		return false, nil
+	}
+	if ok {
+		a, _ := json.Marshal(v)
+		b, _ := json.Marshal(old)
+		if string(a) != string(b) {
+			return false, nil
+		}
+	}
+	m.cache[key] = new
+
+	return true, nil
+}
+
+func (m *mockCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	m.Set(key, value)
+}
+
+type hook struct {
+	fails    int
+	requests int
+	events   []notify.Event
+	mutex    sync.Mutex
+}
+
+func (h *hook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.requests++
+	body, _ := ioutil.ReadAll(r.Body)
+	if h.fails > 0 || r.Header.Get("X-Nani-Signature") != notify.Sign("secret", body) {
+		h.fails--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var e notify.Event
+	json.Unmarshal(body, &e)
+	h.events = append(h.events, e)
+}
+
+func webhooks(url string, c *mockCache) *notify.Webhooks {
+	w := notify.New(config.WatchConfig{
+		Bundles:    []string{"com.ky"},
+		Developers: []string{"dev"},
+		Webhooks:   []config.WebhookConfig{{Url: url, Secret: "secret"}},
+		Retries:    2,
+	}, c)
+	w.Backoff = time.Millisecond
+
+	return w
+}
+
+func TestSign_ShouldReturnHmacSignatureOfBody_NoError(t *testing.T) {
+	sign := notify.Sign("secret", []byte(`{"type":"new_app"}`))
+	assert.Equal(t, "sha256=", sign[:7])
+	assert.Len(t, sign, 7+64)
+	assert.Equal(t, sign, notify.Sign("secret", []byte(`{"type":"new_app"}`)))
+	assert.NotEqual(t, sign, notify.Sign("secret2", []byte(`{"type":"new_app"}`)))
+}
+
+func TestWatched_ShouldReturnTrueForWatchedBundleOrDeveloper_NoError(t *testing.T) {
+	w := webhooks("http://localhost", &mockCache{cache: make(map[string]interface{})})
+	defer w.Close()
+
+	assert.True(t, w.Watched("com.ky", ""))
+	assert.True(t, w.Watched("com.other", "dev"))
+	assert.False(t, w.Watched("com.other", "dev2"))
+}
+
+func TestNotify_ShouldDeliverSignedEventToWebhook_NoError(t *testing.T) {
+	h := &hook{}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	w := webhooks(server.URL, &mockCache{cache: make(map[string]interface{})})
+	w.Notify(notify.Event{Type: notify.NewVersion, Bundle: "com.ky", Old: "1.0", New: "1.1"})
+	w.Close()
+
+	assert.Len(t, h.events, 1)
+	assert.Equal(t, notify.NewVersion, h.events[0].Type)
+	assert.Equal(t, "1.1", h.events[0].New)
+}
+
+func TestNotify_ShouldRetryDeliveryAfterFail_NoError(t *testing.T) {
+	h := &hook{fails: 1}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	c := &mockCache{cache: make(map[string]interface{})}
+	w := webhooks(server.URL, c)
+	w.Notify(notify.Event{Type: notify.PriceChange, Bundle: "com.ky"})
+	w.Close()
+
+	assert.Equal(t, 2, h.requests)
+	assert.Len(t, h.events, 1)
+	_, err := c.GetV("_webhooks")
+	assert.Error(t, err)
+}
+
+func TestNotify_ShouldSaveFailedDeliveryAndRedeliverLater_NoError(t *testing.T) {
+	h := &hook{fails: 2}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	c := &mockCache{cache: make(map[string]interface{})}
+	w := webhooks(server.URL, c)
+	w.Notify(notify.Event{Type: notify.Delisted, Bundle: "com.ky"})
+	w.Close()
+
+	assert.Len(t, h.events, 0)
+	v, err := c.GetV("_webhooks")
+	assert.NoError(t, err)
+	failed := v.([]notify.Delivery)
+	assert.Len(t, failed, 1)
+	assert.Equal(t, server.URL, failed[0].Url)
+	assert.Equal(t, 2, failed[0].Attempts)
+
+	w.Redeliver()
+
+	assert.Len(t, h.events, 1)
+	assert.Equal(t, notify.Delisted, h.events[0].Type)
+	v, err = c.GetV("_webhooks")
+	assert.NoError(t, err)
+	assert.Len(t, v.([]notify.Delivery), 0)
+}
+
+func TestRedeliver_ShouldKeepDeliveryUntilItIsSent_NoError(t *testing.T) {
+	c := &mockCache{cache: make(map[string]interface{})}
+	kept := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var deliveries []notify.Delivery
+		kept = c.Get("_webhooks", &deliveries) == nil && len(deliveries) == 1
+	}))
+	defer server.Close()
+
+	w := webhooks(server.URL, c)
+	w.Close()
+	c.Set("_webhooks", []notify.Delivery{{Url: server.URL, Event: notify.Event{Type: notify.NewApp, Bundle: "com.ky"}, Attempts: 2}})
+	w.Redeliver()
+
+	assert.True(t, kept)
+	v, err := c.GetV("_webhooks")
+	assert.NoError(t, err)
+	assert.Len(t, v.([]notify.Delivery), 0)
+}
+
+func TestRedeliver_ShouldMoveDeliveryToDeadAfterMaxAttempts_Error(t *testing.T) {
+	h := &hook{fails: 100}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	c := &mockCache{cache: make(map[string]interface{})}
+	w := notify.New(config.WatchConfig{
+		Webhooks:    []config.WebhookConfig{{Url: server.URL, Secret: "secret"}},
+		Retries:     2,
+		MaxAttempts: 6,
+	}, c)
+	w.Backoff = time.Millisecond
+	w.Notify(notify.Event{Type: notify.Delisted, Bundle: "com.ky"})
+	w.Close()
+
+	w.Redeliver()
+	var failed []notify.Delivery
+	assert.NoError(t, c.Get("_webhooks", &failed))
+	assert.Len(t, failed, 1)
+	assert.Equal(t, 4, failed[0].Attempts)
+	_, err := c.GetV("_webhooks_dead")
+	assert.Error(t, err)
+
+	w.Redeliver()
+	assert.NoError(t, c.Get("_webhooks", &failed))
+	assert.Len(t, failed, 0)
+	var dead []notify.Delivery
+	assert.NoError(t, c.Get("_webhooks_dead", &dead))
+	assert.Len(t, dead, 1)
+	assert.Equal(t, 6, dead[0].Attempts)
+	assert.Equal(t, "webhook response with status 500", dead[0].Er)
+	assert.Equal(t, 6, h.requests)
+}
+
+func TestNotify_ShouldSaveEventAfterCloseAsFailedDelivery_NoError(t *testing.T) {
+	c := &mockCache{cache: make(map[string]interface{})}
+	w := webhooks("http://localhost", c)
+	w.Close()
+
+	assert.NotPanics(t, func() {
+		w.Notify(notify.Event{Type: notify.NewApp, Bundle: "com.ky"})
+		w.Close()
+	})
+	var failed []notify.Delivery
+	assert.NoError(t, c.Get("_webhooks", &failed))
+	assert.Len(t, failed, 1)
+	assert.Equal(t, "notifier is closed", failed[0].Er)
+}
+
+func TestRedeliver_ShouldSendDeliveryOnceIfCalledConcurrently_NoError(t *testing.T) {
+	c := &mockCache{cache: make(map[string]interface{})}
+	h := &hook{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 50)
+		h.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	w := webhooks(server.URL, c)
+	w.Close()
+	c.Set("_webhooks", []notify.Delivery{{Url: server.URL, Event: notify.Event{Type: notify.NewApp, Bundle: "com.ky"}}})
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Redeliver()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, h.requests)
+}
+
+func TestRedeliver_ShouldNotChangeSliceReturnedByCache_NoError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := cache.Open(config.CacheConfig{Path: filepath.Join(dir, "cache.json")}, false)
+	defer c.Close()
+	server := httptest.NewServer(&hook{fails: 10})
+	defer server.Close()
+
+	w := notify.New(config.WatchConfig{Webhooks: []config.WebhookConfig{{Url: server.URL}}, Retries: 2}, c)
+	w.Backoff = time.Millisecond
+	w.Close()
+	stored := []notify.Delivery{{Url: server.URL, Event: notify.Event{Type: notify.NewApp, Bundle: "com.ky"}}}
+	c.Set("_webhooks", stored)
+	w.Redeliver()
+
+	assert.Equal(t, 0, stored[0].Attempts)
+	var failed []notify.Delivery
+	assert.NoError(t, c.Get("_webhooks", &failed))
+	assert.Equal(t, 2, failed[0].Attempts)
+}
@@ -2,18 +2,28 @@ package main
 
 import (
 	"Nani/internal/app/cache"
+	"Nani/internal/app/cli"
 	"Nani/internal/app/config"
 	"Nani/internal/app/executor"
 	"Nani/internal/app/inhuman"
 	"context"
 	"flag"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 )
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := cli.Run(os.Args[1], os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	var bundles string
 	bundles = os.Getenv("bundle")
 	var cacheDir string
@@ -21,10 +31,10 @@ func main() {
 
 	var configDir string
 	flag.StringVar(&configDir, "config", "config/dev.yml", "Application config file")
-	var schemaDir string
-	flag.StringVar(&schemaDir, "schema", "config/schema.sql", "Database schema")
+	var namespace string
+	flag.StringVar(&namespace, "namespace", "", "Cache namespace of job, by default namespace from config")
 	if cacheDir == "" {
-		flag.StringVar(&cacheDir, "cache", "internal/app/cache/cache.json", "Cache file dir")
+		flag.StringVar(&cacheDir, "cache", "", "Cache file, by default path from config")
 	}
 	if bundles == "" {
 		flag.StringVar(&bundles, "e", "bundles.txt", "The file from which to parse")
@@ -35,15 +45,35 @@ func main() {
 	//Just for test case
 	//os.Setenv("api_key", "Security 3923cf9a417e73be95b40dc5db60c97dcb876a61")
 	conf := config.New(configDir)
-	conf.Database.Schema = schemaDir
 	conf.KeysCount = 10
 	conf.AppsCount = 250
 
 	api := inhuman.New(conf)
 
-	storage := cache.New(false, cacheDir)
+	if cacheDir != "" {
+		conf.Cache.Path = cacheDir
+	}
+	if conf.Cache.Path == "" {
+		conf.Cache.Path = "internal/app/cache/cache.json"
+	}
+	if namespace != "" {
+		conf.Cache.Namespace = namespace
+	}
+	storage, err := cache.OpenStorage(conf.Cache)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jobStorage := storage
+	if conf.Cache.Namespace != "" {
+		if jobStorage, err = cache.NewNamespace(storage, conf.Cache.Namespace); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	ex := executor.New(api, storage, conf)
+	ex, err := executor.New(api, jobStorage, conf)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	go func() {
 		sig := make(chan os.Signal, 1)
@@ -57,9 +87,14 @@ func main() {
 			log.Printf("recovered from panic err = %v", r)
 		}
 		storage.Dump()
+		if c, ok := storage.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Print(err)
+			}
+		}
 	}()
 
-	err := ex.Scrap(context.Background(), bundles)
+	err = ex.Scrap(context.Background(), bundles)
 	if err != nil {
 		log.Fatal(err)
 	}